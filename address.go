@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+// Bech32 prefixes of account addresses
+const HrpMainnet = "bnb"
+const HrpTestnet = "tbnb"
+
+// Validator operator addresses use the same prefix on all networks
+const HrpValoper = "bva"
+
+const NetworkNameMainnet = "mainnet"
+const NetworkNameTestnet = "testnet"
+
+// Account addresses are 20 bytes
+const AddressLength = 20
+
+type ValidateAddressMessage struct {
+	Address string
+}
+
+type AddressMessage struct {
+	BasicMessage
+	// Return the validator operator address as well
+	IncludeValoper bool
+	// Prefix of untagged wallets, "testnet" or "mainnet"
+	Network string
+}
+
+// Account and validator operator address of the same key
+type WalletAddresses struct {
+	Address        string
+	ValoperAddress string
+}
+
+type AddressValidationResponse struct {
+	Address string
+	Valid   bool
+	Hrp     string `json:",omitempty"`
+	Network string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// Returns the network name for the given account address prefix.
+func networkForHrp(hrp string) (string, bool) {
+	switch hrp {
+	case HrpMainnet:
+		return NetworkNameMainnet, true
+	case HrpTestnet:
+		return NetworkNameTestnet, true
+	}
+	return "", false
+}
+
+// Returns the account address prefix of a network name.
+func hrpForNetwork(name string) (string, bool) {
+	switch name {
+	case NetworkNameMainnet:
+		return HrpMainnet, true
+	case NetworkNameTestnet:
+		return HrpTestnet, true
+	}
+	return "", false
+}
+
+// Derives both addresses from the wallet key. Wallets tagged with a
+// network use its prefix, others the default of the SDK.
+func (w *Wallet) GetAddresses() (*WalletAddresses, error) {
+	km, err := w.GetKeyManager()
+	if err != nil {
+		return nil, err
+	}
+	addr := km.GetAddr()
+
+	address := addr.String()
+	if hrp, ok := hrpForNetwork(w.Network); ok {
+		address, err = bech32.ConvertAndEncode(hrp, addr.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+	valoper, err := bech32.ConvertAndEncode(HrpValoper, addr.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &WalletAddresses{Address: address, ValoperAddress: valoper}, nil
+}
+
+// Encodes an address with the prefix of a BroadcastNetwork. Unknown
+// networks use the default of the SDK.
+func addressForNetwork(addr types.AccAddress, network int) (string, error) {
+	name, ok := networkName(network)
+	if !ok {
+		return addr.String(), nil
+	}
+	hrp, _ := hrpForNetwork(name)
+	return bech32.ConvertAndEncode(hrp, addr.Bytes())
+}
+
+func isNetworkName(name string) bool {
+	return name == NetworkNameMainnet || name == NetworkNameTestnet
+}
+
+// Values of BroadcastNetwork and QueryNetwork are the ChainNetwork of
+// the SDK, which selects the address prefix of the client:
+// 0 is the testnet (chain ID Binance-Chain-Ganges, prefix tbnb),
+// 1 the mainnet (chain ID Binance-Chain-Tigris, prefix bnb).
+func validateNetwork(network int) error {
+	if _, ok := networkName(network); !ok {
+		return fmt.Errorf("Unknown network %d, use 0 for testnet or 1 for mainnet.", network)
+	}
+	return nil
+}
+
+// Maps a network name to its BroadcastNetwork.
+func networkForName(name string) (int, bool) {
+	switch name {
+	case NetworkNameTestnet:
+		return int(types.TestNetwork), true
+	case NetworkNameMainnet:
+		return int(types.ProdNetwork), true
+	}
+	return 0, false
+}
+
+// Maps a BroadcastNetwork to its name.
+func networkName(network int) (string, bool) {
+	switch types.ChainNetwork(network) {
+	case types.TestNetwork:
+		return NetworkNameTestnet, true
+	case types.ProdNetwork:
+		return NetworkNameMainnet, true
+	}
+	return "", false
+}
+
+// Rejects broadcasts of tagged wallets to a different network.
+// Untagged wallets may broadcast to any network.
+func checkWalletNetwork(datastore *DexVaultDatastore, wallet string, network int) error {
+	w := datastore.GetWallet(wallet)
+	if w == nil || w.Network == "" {
+		return nil
+	}
+	name, ok := networkName(network)
+	if !ok || name != w.Network {
+		return fmt.Errorf("Wallet %s is tagged for %s and can not broadcast to network %d.", wallet, w.Network, network)
+	}
+	return nil
+}
+
+func validateAddress(address string) AddressValidationResponse {
+	result := AddressValidationResponse{Address: address}
+
+	hrp, data, err := bech32.DecodeAndConvert(address)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Hrp = hrp
+
+	network, ok := networkForHrp(hrp)
+	if !ok {
+		result.Error = "Unknown address prefix: " + hrp
+		return result
+	}
+	if len(data) != AddressLength {
+		result.Error = fmt.Sprintf("Invalid address length: %d", len(data))
+		return result
+	}
+
+	result.Network = network
+	result.Valid = true
+	return result
+}
+
+// Stateless, so only a valid token is required.
+func validateAddressHandler(w http.ResponseWriter, r *http.Request) {
+	data := &ValidateAddressMessage{}
+	err := decodePayload(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeAddressValidation, validateAddress(data.Address))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
+)
+
+func TestAddressPrefixOfNetwork(t *testing.T) {
+	datastore := testDatastore()
+	wallet := datastore.GetWallet("mnemonic")
+	keyManager, err := wallet.GetKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := keyManager.GetAddr()
+
+	for network, hrp := range map[string]string{NetworkNameMainnet: "bnb", NetworkNameTestnet: "tbnb"} {
+		wallet.Network = network
+		addresses, err := wallet.GetAddresses()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix, bz, err := bech32.DecodeAndConvert(addresses.Address)
+		if err != nil || prefix != hrp || !bytes.Equal(bz, addr.Bytes()) {
+			t.Errorf("%s wallet has address %s, want the key with prefix %s", network, addresses.Address, hrp)
+		}
+		if !strings.HasPrefix(addresses.ValoperAddress, HrpValoper+"1") {
+			t.Errorf("%s wallet has validator address %s", network, addresses.ValoperAddress)
+		}
+	}
+
+	for network, hrp := range map[types.ChainNetwork]string{types.ProdNetwork: "bnb1", types.TestNetwork: "tbnb1"} {
+		address, err := addressForNetwork(addr, int(network))
+		if err != nil || !strings.HasPrefix(address, hrp) {
+			t.Errorf("address %s on network %d, want prefix %s", address, network, hrp)
+		}
+	}
+	if validateNetwork(7) == nil {
+		t.Error("network 7 accepted")
+	}
+}
+
+func TestAddressHandlerNetwork(t *testing.T) {
+	datastore := testDatastore()
+	datastore.Wallets[1].Network = NetworkNameMainnet
+
+	for _, test := range []struct {
+		wallet  string
+		network string
+		prefix  string
+		code    ErrorCode
+	}{
+		{"mnemonic", NetworkNameTestnet, "tbnb1", ""},
+		{"mnemonic", NetworkNameMainnet, "bnb1", ""},
+		{"key", "", "bnb1", ""},
+		{"key", NetworkNameTestnet, "", ErrorCodeNetworkMismatch},
+		{"mnemonic", "devnet", "", ErrorCodeInvalidPayload},
+	} {
+		data := &AddressMessage{Network: test.network}
+		data.Wallet = test.wallet
+		r := testRequest("POST", "/v1/wallet/address", "alice", data, datastore, &DexVaultConfiguration{})
+		w := serveSigning(getAddressHandler, r)
+		if test.code != "" {
+			if w.Code != http.StatusBadRequest || errorCode(t, w) != test.code {
+				t.Errorf("%s on %s: status %d, want code %s: %s", test.wallet, test.network, w.Code, test.code, w.Body.String())
+			}
+			continue
+		}
+		response := struct {
+			Data string
+		}{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil || !strings.HasPrefix(response.Data, test.prefix) {
+			t.Errorf("%s on %s: %s, want prefix %s", test.wallet, test.network, w.Body.String(), test.prefix)
+		}
+	}
+	// Asking for a prefix does not tag the wallet.
+	if network := datastore.GetWallet("mnemonic").Network; network != "" {
+		t.Errorf("wallet tagged for %s", network)
+	}
+}
@@ -2,19 +2,88 @@ package main
 
 import (
 	"github.com/binance-chain/go-sdk/types/msg"
+	"time"
 )
 
 type BasicMessage struct {
 	Wallet string
 }
 
+// Base for read requests against a node. Without a QueryHost the
+// configured broadcast hosts are used.
+type QueryMessage struct {
+	QueryHost    string
+	QueryNetwork int
+	// Tried in order if the query of QueryHost fails
+	QueryHosts []string
+}
+
+type CreateWalletMessage struct {
+	BasicMessage
+	// Network the wallet is intended for, "testnet" or "mainnet"
+	Network string
+	// Send BNB from the funding wallet, see wallet_funding
+	Fund bool
+	// Return the wallet if it already exists instead of an error
+	Idempotent bool
+}
+
+type ImportWalletMessage struct {
+	BasicMessage
+	// BIP39 mnemonic of the key
+	Mnemonic string
+	// Optional derivation path, e.g. "44'/714'/0'/0/1"
+	KeyPath string
+	// Hex-encoded private key, instead of a Mnemonic
+	PrivateKey string
+	// Network the wallet is intended for, "testnet" or "mainnet"
+	Network string
+}
+
+type ExportWalletMessage struct {
+	BasicMessage
+	// Encrypts the keystore, at least MinKeystorePasswordLength long
+	Password string
+}
+
+type DeleteWalletMessage struct {
+	BasicMessage
+	// Must repeat the name of the wallet, the key is gone afterwards
+	Confirm string
+}
+
+type RenameWalletMessage struct {
+	BasicMessage
+	NewName string
+}
+
 type SignedMessage struct {
 	BasicMessage
 	BroadcastHost    string
 	BroadcastNetwork int
-	ChainId          string
-	AccountNumber    int64
-	Sequence         int64
+	// Tried in order if the broadcast to BroadcastHost fails
+	BroadcastHosts []string
+	// Override the configured broadcast policy of the action
+	BroadcastMode BroadcastMode
+	Confirmations int64
+	ChainId       string
+	AccountNumber int64
+	Sequence      int64
+	// Fetch AccountNumber and Sequence from the node instead
+	AutoSequence bool
+	// Only fill in the AccountNumber, which is cached
+	AutoAccountNumber bool
+	// Set when resubmitting an action that required approval
+	ApprovalId string
+	// Wallet that should pay the fee. Binance Chain always charges
+	// the signer, so this is rejected if set.
+	FeePayer string
+	// Memo of the transaction, at most 128 bytes
+	Memo string
+	// Not supported by Binance Chain, rejected if set
+	TimeoutHeight int64
+	// Sign, but never broadcast, even if BroadcastHost is set
+	DryRun bool
 }
 
 type CreateOrder struct {
@@ -24,6 +93,18 @@ type CreateOrder struct {
 	Op               int8
 	Price            int64
 	Quantity         int64
+	// Skip the minimum notional check, see min_notionals
+	SkipNotionalCheck bool
+	// Skip the price deviation check, see price_deviation
+	SkipPriceCheck bool
+	// Optional reference the order can be cancelled by
+	ClientOrderId string
+}
+
+// A CreateOrder signed now, to be broadcast at ValidFrom.
+type ScheduleOrder struct {
+	CreateOrder
+	ValidFrom time.Time
 }
 
 type CancelOrder struct {
@@ -31,6 +112,22 @@ type CancelOrder struct {
 	BaseAssetSymbol  string
 	QuoteAssetSymbol string
 	RefId            string
+	// Cancel by the reference given at creation instead of RefId
+	ClientOrderId string
+}
+
+type ReplaceOrder struct {
+	SignedMessage
+	BaseAssetSymbol  string
+	QuoteAssetSymbol string
+	// Order to cancel
+	RefId string
+	// New order
+	Op                int8
+	Price             int64
+	Quantity          int64
+	SkipNotionalCheck bool
+	SkipPriceCheck    bool
 }
 
 type TokenBurn struct {
@@ -59,6 +156,24 @@ type IssueToken struct {
 	Supply   int64
 	Mintable bool
 	// Owner string
+	// Issue a mini-token (BEP-69) instead of a regular token
+	MiniToken bool
+	TokenURI  string
+}
+
+type IssueMiniToken struct {
+	SignedMessage
+	Name     string
+	Symbol   string
+	Supply   int64
+	Mintable bool
+	TokenURI string
+}
+
+type SetTokenURI struct {
+	SignedMessage
+	Symbol   string
+	TokenURI string
 }
 
 type ListPair struct {
@@ -78,6 +193,10 @@ type MintToken struct {
 type SendToken struct {
 	SignedMessage
 	Transfers []msg.Transfer
+	// Defaults to the default memo of the wallet
+	Memo *string
+	// Skip checking whether recipients require a memo
+	SkipMemoCheck bool
 }
 
 type SubmitProposal struct {
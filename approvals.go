@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/go-chi/render"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An action that was requested by one user but needs to be approved
+// by other users before it is signed.
+type PendingAction struct {
+	Id          string
+	Action      Permission
+	Wallet      string
+	Initiator   string
+	PayloadHash string
+	Summary     PendingSummary
+	Created     time.Time
+	Required    int
+	Approvals   []string
+}
+
+type PendingActionResponse struct {
+	Id        string
+	Action    Permission
+	Wallet    string
+	Initiator string
+	Summary   PendingSummary
+	Created   time.Time
+	Required  int
+	Current   int
+	Approvals []string
+}
+
+// What a pending action does, decoded from its payload so approvers
+// can see what they approve. Only the fields of the action are set.
+type PendingSummary struct {
+	// Recipients of transfers and HTLTs
+	Outputs  []TransferSummary `json:",omitempty"`
+	Symbol   string            `json:",omitempty"`
+	Side     string            `json:",omitempty"`
+	Price    int64             `json:",omitempty"`
+	Quantity int64             `json:",omitempty"`
+	// Amount of the symbol, or Coins for actions with several
+	Amount int64       `json:",omitempty"`
+	Coins  types.Coins `json:",omitempty"`
+	Memo   string      `json:",omitempty"`
+}
+
+type PendingActionsResponse struct {
+	Pending []PendingActionResponse
+}
+
+type ApproveMessage struct {
+	ApprovalId string
+}
+
+// Guards PendingActions in the datastore.
+var approvalsMutex sync.Mutex
+
+func (p *PendingAction) Response() PendingActionResponse {
+	return PendingActionResponse{
+		Id:        p.Id,
+		Action:    p.Action,
+		Wallet:    p.Wallet,
+		Initiator: p.Initiator,
+		Summary:   p.Summary,
+		Created:   p.Created,
+		Required:  p.Required,
+		Current:   len(p.Approvals),
+		Approvals: p.Approvals,
+	}
+}
+
+func (p *PendingAction) HasApproval(user string) bool {
+	for _, a := range p.Approvals {
+		if a == user {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *DexVaultDatastore) GetPendingAction(id string) *PendingAction {
+	for _, p := range b.PendingActions {
+		if p.Id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (b *DexVaultDatastore) RemovePendingAction(id string) {
+	for i, p := range b.PendingActions {
+		if p.Id == id {
+			b.PendingActions = append(b.PendingActions[:i], b.PendingActions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Hashes the request payload without the ApprovalId, so that a
+// resubmitted request can be matched against its pending action.
+// The Nonce and IssuedAt are left out as well: the nonce is consumed
+// by the first request, so the resubmission carries fresh ones, which
+// the replay protection checks like those of any other request.
+func approvalPayloadHash(r *http.Request) (string, error) {
+	fields := map[string]interface{}{}
+	err := decodePayload(r, &fields)
+	if err != nil {
+		return "", err
+	}
+	for k := range fields {
+		if strings.EqualFold(k, "ApprovalId") || strings.EqualFold(k, "Nonce") || strings.EqualFold(k, "IssuedAt") {
+			delete(fields, k)
+		}
+	}
+
+	j, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(j)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Decodes the fields of the payload that tell approvers what the
+// action does. Amount is the amount of a symbol in most payloads and
+// coins in those of HTLTs.
+func summarizePayload(r *http.Request) (PendingSummary, error) {
+	data := &struct {
+		Transfers        []msg.Transfer
+		Outputs          []MultiSendOutput
+		To               string
+		Symbol           string
+		BaseAssetSymbol  string
+		QuoteAssetSymbol string
+		Op               int8
+		Price            int64
+		Quantity         int64
+		Supply           int64
+		Amount           json.RawMessage
+		Memo             *string
+	}{}
+	err := decodePayload(r, data)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+
+	s := PendingSummary{Symbol: data.Symbol, Price: data.Price, Quantity: data.Quantity, Amount: data.Supply}
+	for _, t := range data.Transfers {
+		s.Outputs = append(s.Outputs, TransferSummary{To: t.ToAddr.String(), Coins: t.Coins})
+	}
+	for _, o := range data.Outputs {
+		s.Outputs = append(s.Outputs, TransferSummary{To: o.Address.String(), Coins: o.Coins})
+	}
+	if data.BaseAssetSymbol != "" {
+		s.Symbol = data.BaseAssetSymbol + "_" + data.QuoteAssetSymbol
+	}
+	switch data.Op {
+	case msg.OrderSide.BUY:
+		s.Side = "buy"
+	case msg.OrderSide.SELL:
+		s.Side = "sell"
+	}
+	if len(data.Amount) > 0 && json.Unmarshal(data.Amount, &s.Amount) != nil {
+		err = json.Unmarshal(data.Amount, &s.Coins)
+		if err != nil {
+			return PendingSummary{}, err
+		}
+	}
+	if data.To != "" {
+		s.Outputs = []TransferSummary{{To: data.To, Coins: s.Coins}}
+		s.Coins = nil
+	}
+	if data.Memo != nil {
+		s.Memo = *data.Memo
+	}
+	return s, nil
+}
+
+// Removes pending actions older than approval_ttl. Must hold the
+// approvalsMutex.
+func prunePendingActions(cfg *DexVaultConfiguration, datastore *DexVaultDatastore) {
+	ttl := time.Duration(cfg.ApprovalTTL) * time.Second
+	pending := []*PendingAction{}
+	for _, p := range datastore.PendingActions {
+		if time.Since(p.Created) <= ttl {
+			pending = append(pending, p)
+		} else {
+			fmt.Println("Pending action " + p.Id + " expired.")
+		}
+	}
+	if len(pending) != len(datastore.PendingActions) {
+		datastore.PendingActions = pending
+		datastore.persist()
+	}
+}
+
+// Enforces the configured approval threshold for the action.
+// Returns true if the request was handled and signing must not continue.
+func requireApproval(w http.ResponseWriter, r *http.Request, action Permission) bool {
+	return requireApprovals(w, r, action, GetRequestConfig(r).ApprovalThresholds[action])
+}
+
+// The first request for an action that needs approval is queued as a
+// pending action. Once enough users approved it, the initiator
+// resubmits the same request with the ApprovalId to have it signed.
+//
+// Returns true if the request was handled and signing must not continue.
+func requireApprovals(w http.ResponseWriter, r *http.Request, action Permission, required int) bool {
+	if required <= 0 {
+		return false
+	}
+
+	cfg := GetRequestConfig(r)
+	datastore := GetRequestDatastore(r)
+	user := GetRequestUser(r)
+
+	data := &SignedMessage{}
+	err := decodePayload(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return true
+	}
+	hash, err := approvalPayloadHash(r)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return true
+	}
+	summary, err := summarizePayload(r)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return true
+	}
+
+	approvalsMutex.Lock()
+	defer approvalsMutex.Unlock()
+	prunePendingActions(cfg, datastore)
+
+	if data.ApprovalId == "" {
+		bytes, err := GenerateRandomBytes(16)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return true
+		}
+		p := &PendingAction{
+			Id:          hex.EncodeToString(bytes),
+			Action:      action,
+			Wallet:      data.Wallet,
+			Initiator:   user,
+			PayloadHash: hash,
+			Summary:     summary,
+			Created:     time.Now(),
+			Required:    required,
+			Approvals:   []string{},
+		}
+		fmt.Println("Queueing " + string(action) + " by " + user + " for approval: " + p.Id)
+		datastore.PendingActions = append(datastore.PendingActions, p)
+		err = datastore.persist()
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return true
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		WriteTypedResponse(w, r, ResponseTypePending, p.Response())
+		return true
+	}
+
+	p := datastore.GetPendingAction(data.ApprovalId)
+	if p == nil {
+		render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeApprovalPending, errors.New("No matching pending action could be found."))))
+		return true
+	}
+	if p.Initiator != user || p.Action != action || p.Wallet != data.Wallet || p.PayloadHash != hash {
+		render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeApprovalPending, errors.New("Request does not match the pending action."))))
+		return true
+	}
+	if len(p.Approvals) < p.Required {
+		render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeApprovalPending, fmt.Errorf("Pending action has %d of %d required approvals.", len(p.Approvals), p.Required))))
+		return true
+	}
+
+	fmt.Println("Pending action approved, signing: " + p.Id)
+	datastore.RemovePendingAction(p.Id)
+	datastore.persist()
+	return false
+}
+
+func getPendingActionsHandler(w http.ResponseWriter, r *http.Request) {
+	datastore := GetRequestDatastore(r)
+	user := GetRequestUser(r)
+	u := datastore.GetUser(user)
+	if !u.HasPermission(PermissionRead) {
+		render.Render(w, r, ErrPermissionDenied())
+		return
+	}
+
+	approvalsMutex.Lock()
+	defer approvalsMutex.Unlock()
+	prunePendingActions(GetRequestConfig(r), datastore)
+
+	prs := PendingActionsResponse{Pending: []PendingActionResponse{}}
+	for _, p := range datastore.PendingActions {
+		prs.Pending = append(prs.Pending, p.Response())
+	}
+
+	WriteTypedResponse(w, r, ResponseTypePendingList, prs)
+}
+
+func approveHandler(w http.ResponseWriter, r *http.Request) {
+	data := &ApproveMessage{}
+	datastore, user, err := decodeRequestBasic(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	u := datastore.GetUser(user)
+
+	if !u.HasPermission(PermissionApprove) {
+		render.Render(w, r, ErrPermissionDenied())
+		return
+	}
+
+	approvalsMutex.Lock()
+	defer approvalsMutex.Unlock()
+	prunePendingActions(GetRequestConfig(r), datastore)
+
+	p := datastore.GetPendingAction(data.ApprovalId)
+	if p == nil {
+		render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeApprovalPending, errors.New("No matching pending action could be found."))))
+		return
+	}
+	if !datastore.IsPermitted(user, p.Wallet, PermissionApprove) {
+		render.Render(w, r, ErrPermissionDenied())
+		return
+	}
+	if p.Initiator == user {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Pending actions cannot be approved by their initiator.")))
+		return
+	}
+	if p.HasApproval(user) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Pending action was already approved by this user.")))
+		return
+	}
+
+	fmt.Println("Pending action " + p.Id + " approved by " + user)
+	p.Approvals = append(p.Approvals, user)
+	err = datastore.persist()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	WriteTypedResponse(w, r, ResponseTypePending, p.Response())
+}
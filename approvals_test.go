@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A transfer with the Nonce and IssuedAt required by require_nonce.
+type nonceTransfer struct {
+	*SendToken
+	NonceMessage
+	IssuedAtMessage
+}
+
+func noncePayload(send *SendToken, nonce string, issuedAt time.Time) *nonceTransfer {
+	return &nonceTransfer{SendToken: send, NonceMessage: NonceMessage{Nonce: nonce}, IssuedAtMessage: IssuedAtMessage{IssuedAt: &issuedAt}}
+}
+
+// Runs the request through the replay protection and the signing
+// middleware like the router does.
+func serveProtected(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	IssuedAtWindow(ReplayProtection(SigningReservations(handler))).ServeHTTP(w, r)
+	return w
+}
+
+func TestApprovalResubmissionWithRequiredNonce(t *testing.T) {
+	nonceStore = newMemoryNonceStore()
+	cfg, datastore := limitsTest(t, 10000)
+	cfg.RequireNonce = true
+	cfg.MaxIssuedAtAge = 300
+	cfg.MaxIssuedAtFuture = 60
+	cfg.NonceTTL = 360
+	cfg.ApprovalTTL = 86400
+	cfg.ApprovalThresholds = map[Permission]int{PermissionSendToken: 1}
+	datastore.Users = append(datastore.Users, &DexVaultAuth{Name: "bob", Permissions: []Permission{PermissionAll, PermissionApprove}})
+
+	// Issued close to the end of the window, so it is too old by the
+	// time the approval arrives.
+	issued := time.Now().Add(-290 * time.Second)
+	r := testRequest("POST", "/v1/token/send", "alice", noncePayload(sendTokenPayload(500, ""), "first", issued), datastore, cfg)
+	w := serveProtected(sendTokenHandler, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body.String())
+	}
+	pending := struct {
+		Data PendingActionResponse
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &pending)
+	if err != nil || pending.Data.Id == "" {
+		t.Fatalf("no pending action: %s", w.Body.String())
+	}
+	to := testTransfers(500)[0]
+	if outputs := pending.Data.Summary.Outputs; len(outputs) != 1 || outputs[0].To != to.ToAddr.String() || !outputs[0].Coins.IsEqual(to.Coins) {
+		t.Errorf("summary %+v, want %v to %s", pending.Data.Summary, to.Coins, to.ToAddr)
+	}
+
+	// Approvers need the permission on the wallet of the action.
+	datastore.Users = append(datastore.Users, &DexVaultAuth{Name: "carol", Permissions: []Permission{PermissionRead}})
+	r = testRequest("POST", "/v1/approval/approve", "carol", &ApproveMessage{ApprovalId: pending.Data.Id}, datastore, cfg)
+	if w := serveProtected(approveHandler, r); w.Code == http.StatusOK {
+		t.Errorf("approved without PermissionApprove: %s", w.Body.String())
+	}
+
+	r = testRequest("POST", "/v1/approval/approve", "bob", &ApproveMessage{ApprovalId: pending.Data.Id}, datastore, cfg)
+	if w := serveProtected(approveHandler, r); w.Code != http.StatusOK {
+		t.Fatalf("approval status %d: %s", w.Code, w.Body.String())
+	}
+
+	resubmit := sendTokenPayload(500, "")
+	resubmit.ApprovalId = pending.Data.Id
+	// The nonce of the first request is used up.
+	r = testRequest("POST", "/v1/token/send", "alice", noncePayload(resubmit, "first", time.Now()), datastore, cfg)
+	if w := serveProtected(sendTokenHandler, r); w.Code != http.StatusBadRequest || errorCode(t, w) != ErrorCodeNonceReused {
+		t.Errorf("resubmission with the used nonce: status %d: %s", w.Code, w.Body.String())
+	}
+	// So is the IssuedAt, once the window passed.
+	r = testRequest("POST", "/v1/token/send", "alice", noncePayload(resubmit, "second", issued.Add(-20*time.Second)), datastore, cfg)
+	if w := serveProtected(sendTokenHandler, r); w.Code != http.StatusBadRequest || errorCode(t, w) != ErrorCodeClockDrift {
+		t.Errorf("resubmission with the stale IssuedAt: status %d: %s", w.Code, w.Body.String())
+	}
+
+	r = testRequest("POST", "/v1/token/send", "alice", noncePayload(resubmit, "third", time.Now()), datastore, cfg)
+	w = serveProtected(sendTokenHandler, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("resubmission status %d: %s", w.Code, w.Body.String())
+	}
+	signedTx(t, w)
+	if len(datastore.PendingActions) != 0 {
+		t.Errorf("%d pending actions left after signing", len(datastore.PendingActions))
+	}
+	if spent(datastore) != 500 {
+		t.Errorf("spent %d, want 500", spent(datastore))
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/go-chi/render"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A signing recorded in the audit chain. Hash covers all other fields,
+// including PrevHash, so changing, removing or reordering an entry
+// breaks the chain from that entry on.
+type AuditEntry struct {
+	Seq         int64
+	Time        time.Time
+	User        string
+	Wallet      string
+	Action      Permission
+	TxHash      string
+	PayloadHash string
+	PrevHash    string
+	Hash        string
+}
+
+// Result of walking the audit chain.
+type AuditLogReport struct {
+	Entries int64
+	Valid   bool
+	// Hash of the last entry, to compare with a copy kept elsewhere, as
+	// entries cut off at the end leave a valid chain
+	LastHash string `json:",omitempty"`
+	// First entry that does not match the chain, counted from 1
+	BrokenAt int64  `json:",omitempty"`
+	Reason   string `json:",omitempty"`
+}
+
+// Append-only file of all signings, see audit_chain_file.
+type AuditLog struct {
+	mutex    sync.Mutex
+	file     *os.File
+	seq      int64
+	lastHash string
+}
+
+// The audit chain of this instance, nil unless audit_chain_file is set.
+var auditChain *AuditLog
+
+func (e *AuditEntry) computeHash() string {
+	c := *e
+	c.Hash = ""
+	j, _ := json.Marshal(c)
+	sum := sha256.Sum256(j)
+	return hex.EncodeToString(sum[:])
+}
+
+// Re-walks the audit chain in the file and reports the first broken
+// link. A missing file is an empty, valid chain.
+func GetAuditLog(path string) (*AuditLogReport, error) {
+	report := &AuditLogReport{Valid: true}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		n := report.Entries + 1
+		broken := func(reason string) (*AuditLogReport, error) {
+			report.Valid = false
+			report.BrokenAt = n
+			report.Reason = reason
+			return report, nil
+		}
+		e := AuditEntry{}
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			return broken("Entry is not valid JSON.")
+		}
+		if e.Seq != n {
+			return broken("Entry has sequence " + strconv.FormatInt(e.Seq, 10) + ".")
+		}
+		if e.PrevHash != report.LastHash {
+			return broken("Entry does not link to the previous entry.")
+		}
+		if e.computeHash() != e.Hash {
+			return broken("Hash of the entry does not match its contents.")
+		}
+		report.Entries = n
+		report.LastHash = e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Opens the audit chain for appending. The existing chain is verified
+// first, a new entry is never linked to a broken chain.
+func openAuditLog(path string) (*AuditLog, error) {
+	report, err := GetAuditLog(path)
+	if err != nil {
+		return nil, err
+	}
+	if !report.Valid {
+		return nil, fmt.Errorf("Entry %d is broken: %s", report.BrokenAt, report.Reason)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f, seq: report.Entries, lastHash: report.LastHash}, nil
+}
+
+// Appends an entry and syncs it to disk before returning.
+func (l *AuditLog) Append(user string, wallet string, action Permission, txHash string, payloadHash string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	e := AuditEntry{
+		Seq:         l.seq + 1,
+		Time:        time.Now().UTC(),
+		User:        user,
+		Wallet:      wallet,
+		Action:      action,
+		TxHash:      txHash,
+		PayloadHash: payloadHash,
+		PrevHash:    l.lastHash,
+	}
+	e.Hash = e.computeHash()
+	j, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(j, '\n'))
+	if err != nil {
+		return err
+	}
+	err = l.file.Sync()
+	if err != nil {
+		return err
+	}
+	l.seq = e.Seq
+	l.lastHash = e.Hash
+	return nil
+}
+
+// SHA-256 of the payload claim of the request.
+func payloadHash(r *http.Request) string {
+	token, _, err := jwtauth.FromContext(r.Context())
+	if err != nil || token == nil {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	payload, _ := claims["payload"].(string)
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// Records a signed transaction in the audit chain. Handlers call it
+// right after signing and do not release the transaction if it fails,
+// so every transaction that leaves DexVault is in the chain.
+func recordSigning(r *http.Request, wallet string, action Permission, hexTx []byte) error {
+	if auditChain != nil {
+		err := auditChain.Append(GetRequestUser(r), wallet, action, txHash(hexTx), payloadHash(r))
+		if err != nil {
+			fmt.Println("Audit chain failed: " + err.Error())
+			return &RequestError{
+				HTTPStatusCode: http.StatusServiceUnavailable,
+				StatusText:     "Audit log is unavailable.",
+				Err:            errors.New("The signing could not be recorded."),
+			}
+		}
+	}
+	signedTxMetric.Inc(string(action))
+	return nil
+}
+
+// Verifies the audit chain, e.g. before archiving it.
+func getAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	_, _, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	cfg := GetRequestConfig(r)
+	if cfg.AuditChainFile == "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("No audit_chain_file is configured.")))
+		return
+	}
+	// Entries are appended under the mutex, so the walk sees whole lines.
+	auditChain.mutex.Lock()
+	report, err := GetAuditLog(cfg.AuditChainFile)
+	auditChain.mutex.Unlock()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	WriteTypedResponse(w, r, ResponseTypeAuditLog, report)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audit log formats
+const AuditLogFormatText = "text"
+const AuditLogFormatJSON = "json"
+
+// Outcome of a request that was denied before anything was signed
+const AuditResultDenied = "denied"
+
+// An entry of the audit log. Events of signings carry the wallet,
+// action and transaction hash, the others only describe the event.
+type AuditEvent struct {
+	Time   time.Time
+	User   string
+	IP     string
+	Event  string
+	Wallet string     `json:",omitempty"`
+	Action Permission `json:",omitempty"`
+	TxHash string     `json:",omitempty"`
+	Host   string     `json:",omitempty"`
+	// A SigningOutcome or AuditResultDenied
+	Result string `json:",omitempty"`
+	Error  string `json:",omitempty"`
+}
+
+// Receives every audit event. Operators that need another sink, e.g.
+// a SIEM, implement it and set auditLogger at startup. Log must not
+// block for long, it is called while handling the request.
+type AuditLogger interface {
+	Log(e *AuditEvent)
+}
+
+// Writes the "Audit: ..." lines of the console log.
+type textAuditLogger struct {
+	sync.Mutex
+	out io.Writer
+}
+
+func (l *textAuditLogger) Log(e *AuditEvent) {
+	l.Lock()
+	defer l.Unlock()
+	fmt.Fprintln(l.out, "Audit: "+e.Event+" (user "+e.User+" from "+e.IP+")")
+}
+
+// Writes one JSON object per line.
+type jsonAuditLogger struct {
+	sync.Mutex
+	out io.Writer
+}
+
+func (l *jsonAuditLogger) Log(e *AuditEvent) {
+	j, err := json.Marshal(e)
+	if err != nil {
+		fmt.Println("Failed to encode audit event: " + err.Error())
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.out.Write(append(j, '\n'))
+}
+
+// Where audit events go, set from audit_log_format and audit_log_output.
+var auditLogger AuditLogger = &textAuditLogger{out: os.Stdout}
+
+// Creates the logger configured by audit_log_format and
+// audit_log_output, which takes the same values as request_log_output.
+func newAuditLogger(cfg *DexVaultConfiguration) (AuditLogger, error) {
+	out, err := openRequestLog(cfg.AuditLogOutput)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.AuditLogFormat {
+	case AuditLogFormatText:
+		return &textAuditLogger{out: out}, nil
+	case AuditLogFormatJSON:
+		return &jsonAuditLogger{out: out}, nil
+	}
+	return nil, errors.New("Unknown audit_log_format: " + cfg.AuditLogFormat)
+}
+
+func newAuditEvent(r *http.Request, event string) *AuditEvent {
+	return &AuditEvent{Time: time.Now().UTC(), User: GetRequestUser(r), IP: ClientIP(r), Event: event}
+}
+
+// Records the outcome of a signing, with the host it was broadcast to
+// and the error of the broadcast if any.
+func auditSigning(r *http.Request, wallet string, action Permission, hexTx []byte, host string, outcome SigningOutcome, err error) {
+	e := newAuditEvent(r, "Signing with wallet "+wallet+" for "+string(action)+": "+string(outcome))
+	e.Wallet = wallet
+	e.Action = action
+	e.TxHash = txHash(hexTx)
+	e.Host = host
+	e.Result = string(outcome)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	auditLogger.Log(e)
+}
+
+// Records a signing request that was rejected before signing.
+func auditDenied(r *http.Request, wallet string, action Permission, err error) {
+	e := newAuditEvent(r, "Denied "+string(action)+" with wallet "+wallet+": "+err.Error())
+	e.Wallet = wallet
+	e.Action = action
+	e.Result = AuditResultDenied
+	e.Error = err.Error()
+	auditLogger.Log(e)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Events about signings and denials, without the free-form ones.
+func (l *testAuditLogger) results() []*AuditEvent {
+	events := []*AuditEvent{}
+	for _, e := range l.events {
+		if e.Result != "" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestAuditSuccessfulSend(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	client := &testDexClient{}
+	useTestClient(testLimitHost, 0, client)
+	events, restore := recordAudit()
+	defer restore()
+
+	r := testRequest("POST", "/v1/token/send", "alice", sendTokenPayload(100, testLimitHost), datastore, cfg)
+	if w := serveSigning(sendTokenHandler, r); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	results := events.results()
+	if len(results) != 1 {
+		t.Fatalf("%d audit entries, want 1", len(results))
+	}
+	e := results[0]
+	if e.User != "alice" || e.Wallet != "hot" || e.Action != PermissionSendToken || e.Host != testLimitHost {
+		t.Errorf("audit entry %+v", e)
+	}
+	if e.Result != string(SigningOutcomeBroadcast) || e.TxHash != txHash(client.Posted[0]) || e.Error != "" {
+		t.Errorf("audit entry %+v, want the broadcast of %s", e, txHash(client.Posted[0]))
+	}
+}
+
+func TestAuditPermissionDenied(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	datastore.Users = append(datastore.Users, &DexVaultAuth{Name: "bob", Permissions: []Permission{PermissionRead}})
+	events, restore := recordAudit()
+	defer restore()
+
+	r := testRequest("POST", "/v1/token/send", "bob", sendTokenPayload(100, ""), datastore, cfg)
+	if w := serveSigning(sendTokenHandler, r); w.Code == http.StatusOK {
+		t.Fatalf("send without permission returned status %d", w.Code)
+	}
+	results := events.results()
+	if len(results) != 1 {
+		t.Fatalf("%d audit entries, want 1", len(results))
+	}
+	e := results[0]
+	if e.User != "bob" || e.Wallet != "hot" || e.Action != PermissionSendToken || e.Result != AuditResultDenied || e.TxHash != "" {
+		t.Errorf("audit entry %+v, want the denial", e)
+	}
+}
+
+func TestAuditFrozenFundingWallet(t *testing.T) {
+	cfg, datastore, wallet := fundingTest(t, 5000)
+	err := datastore.SetFrozen("funder", true, "incident")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, restore := recordAudit()
+	defer restore()
+	r := testRequest("POST", "/v1/wallet/create", "alice", struct{}{}, datastore, cfg)
+
+	if _, err := fundWallet(r, cfg, datastore, wallet); err == nil {
+		t.Fatal("funded from a frozen wallet")
+	}
+	results := events.results()
+	if len(results) != 1 || results[0].Wallet != "funder" || results[0].Result != AuditResultDenied {
+		t.Errorf("audit entries %v, want the denial of the funding wallet", results)
+	}
+}
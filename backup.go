@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Version of the backup format produced by backupHandler. Data is
+// sealed like the datastore file, under a key derived from the backup
+// secret with scrypt.
+const BackupVersion = 2
+
+// Backups of older versions, whose key is a SHA-256 of the backup
+// secret. They can still be restored.
+const backupVersionSHA256 = 1
+
+// An encrypted backup of the complete datastore. Data is the
+// datastore encrypted with the backup secret, Checksum is the
+// SHA-256 of Data.
+type Backup struct {
+	Version  int
+	Created  time.Time
+	Checksum string
+	Data     []byte
+}
+
+type RestoreMessage struct {
+	Backup Backup
+	// Overwrite a datastore that already contains wallets
+	Force bool
+}
+
+// The backup secret is kept separate from the unseal secret, so a
+// leaked backup does not expose the datastore and vice versa.
+func backupSecret(datastore *DexVaultDatastore) (string, error) {
+	secret := os.Getenv("DEXVAULT_BACKUP_SECRET")
+	if secret == "" {
+		return "", errors.New("DEXVAULT_BACKUP_SECRET environment variable not set.")
+	}
+	if secret == datastore.Secret {
+		return "", errors.New("Backup secret must differ from the unseal secret.")
+	}
+	return secret, nil
+}
+
+func backupChecksum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func (b *DexVaultDatastore) IsEmpty() bool {
+	walletsMutex.RLock()
+	defer walletsMutex.RUnlock()
+	return len(b.Wallets) == 0 && len(b.PendingActions) == 0 && len(b.ScheduledOrders) == 0
+}
+
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	datastore, user, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := backupSecret(datastore)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	// Marshalled under the locks and decoded again, so the copy is
+	// consistent and the datastore is not held while the keys are
+	// unsealed.
+	unlock := lockDatastore()
+	walletsMutex.RLock()
+	bin, err := json.Marshal(datastore)
+	walletsMutex.RUnlock()
+	unlock()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	snapshot := DexVaultDatastore{}
+	err = json.Unmarshal(bin, &snapshot)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	// Keys are sealed with the unseal secret, which the instance that
+	// restores the backup need not share, so the backup secret
+	// protects them instead.
+	for i := range snapshot.Wallets {
+		err = snapshot.Wallets[i].Unseal(datastore.Secret)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	bin, err = json.Marshal(snapshot)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	data, err := sealWithPassphrase(bin, secret)
+	wipe(bin)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	backup := Backup{
+		Version:  BackupVersion,
+		Created:  time.Now().UTC(),
+		Checksum: backupChecksum(data),
+		Data:     data,
+	}
+	auditLog(r, "Backup created by "+user)
+
+	WriteTypedResponse(w, r, ResponseTypeBackup, backup)
+}
+
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+	datastore, user, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	data := &RestoreMessage{}
+	err := decodePayload(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if data.Backup.Version != BackupVersion && data.Backup.Version != backupVersionSHA256 {
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("Unsupported backup version: %d", data.Backup.Version)))
+		return
+	}
+	if data.Backup.Checksum != backupChecksum(data.Backup.Data) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Backup checksum mismatch.")))
+		return
+	}
+
+	secret, err := backupSecret(datastore)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	var bin []byte
+	if data.Backup.Version == backupVersionSHA256 {
+		bin, err = tryDecrypt(data.Backup.Data, secret)
+	} else {
+		bin, err = openWithPassphrase(data.Backup.Data, secret)
+	}
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Failed to decrypt backup.")))
+		return
+	}
+
+	restored := DexVaultDatastore{Secret: datastore.Secret}
+	err = json.Unmarshal(bin, &restored)
+	wipe(bin)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = restored.sealWallets()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	unlock := lockDatastore()
+	defer unlock()
+
+	if !datastore.IsEmpty() && !data.Force {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Datastore is not empty, set Force to overwrite it.")))
+		return
+	}
+
+	auditLog(r, "Restoring backup from "+data.Backup.Created.String()+" by "+user)
+	// The Secret and Path stay those of this instance.
+	walletsMutex.Lock()
+	datastore.Wallets = restored.Wallets
+	walletsMutex.Unlock()
+	datastore.Users = restored.Users
+	datastore.PendingActions = restored.PendingActions
+	datastore.LastSigned = restored.LastSigned
+	datastore.ScheduledOrders = restored.ScheduledOrders
+	datastore.ClientOrders = restored.ClientOrders
+	datastore.Spending = restored.Spending
+	err = datastore.persist()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeRestore, fmt.Sprintf("Restored %d wallets and %d users.", len(restored.Wallets), len(restored.Users)))
+}
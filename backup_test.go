@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func createTestBackup(t *testing.T, datastore *DexVaultDatastore) Backup {
+	r := testRequest("POST", "/v1/admin/backup", "admin", struct{}{}, datastore, &DexVaultConfiguration{})
+	w := httptest.NewRecorder()
+	backupHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("backup status %d: %s", w.Code, w.Body.String())
+	}
+	response := struct {
+		Data Backup
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.Data
+}
+
+func restoreTestBackup(datastore *DexVaultDatastore, backup Backup) *httptest.ResponseRecorder {
+	r := testRequest("POST", "/v1/admin/restore", "admin", &RestoreMessage{Backup: backup}, datastore, &DexVaultConfiguration{})
+	w := httptest.NewRecorder()
+	restoreHandler(w, r)
+	return w
+}
+
+func TestBackupRestore(t *testing.T) {
+	t.Setenv("DEXVAULT_BACKUP_SECRET", "backup secret")
+	admin := &DexVaultAuth{Name: "admin", Permissions: []Permission{PermissionAdmin}}
+	datastore := testDatastore()
+	datastore.Users = append(datastore.Users, admin)
+	datastore.PendingActions = []*PendingAction{{Id: "pending", Wallet: "key"}}
+	want, err := datastore.GetWallet("mnemonic").GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup := createTestBackup(t, datastore)
+	if backup.Version != BackupVersion {
+		t.Errorf("backup version %d, want %d", backup.Version, BackupVersion)
+	}
+	if _, err := tryDecrypt(backup.Data, "backup secret"); err == nil {
+		t.Error("backup opens with a SHA-256 of the secret")
+	}
+
+	// The restoring instance has a different unseal secret.
+	restored := &DexVaultDatastore{Secret: "other secret", Users: []*DexVaultAuth{admin}}
+	if w := restoreTestBackup(restored, backup); w.Code != http.StatusOK {
+		t.Fatalf("restore status %d: %s", w.Code, w.Body.String())
+	}
+	if restored.Secret != "other secret" || len(restored.Wallets) != 2 || len(restored.PendingActions) != 1 {
+		t.Fatalf("restored %d wallets and %d pending actions", len(restored.Wallets), len(restored.PendingActions))
+	}
+	wallet := restored.GetWallet("mnemonic")
+	if wallet.Seed != "" || wallet.SealedKey == nil {
+		t.Error("restored wallet is not sealed")
+	}
+	got, err := wallet.GetAddress()
+	if err != nil || *got != *want {
+		t.Errorf("restored wallet has address %v, want %s: %v", got, *want, err)
+	}
+
+	if w := restoreTestBackup(restored, backup); w.Code != http.StatusBadRequest {
+		t.Errorf("restore into a datastore with wallets: status %d", w.Code)
+	}
+}
+
+func TestRestoreBackupVersion1(t *testing.T) {
+	t.Setenv("DEXVAULT_BACKUP_SECRET", "backup secret")
+	admin := &DexVaultAuth{Name: "admin", Permissions: []Permission{PermissionAdmin}}
+	bin, err := json.Marshal(&DexVaultDatastore{Wallets: []Wallet{{Name: "old", Seed: testMnemonic}}, Users: []*DexVaultAuth{admin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := encrypt(bin, "backup secret")
+	backup := Backup{Version: backupVersionSHA256, Checksum: backupChecksum(data), Data: data}
+
+	restored := &DexVaultDatastore{Secret: "test secret", Users: []*DexVaultAuth{admin}}
+	if w := restoreTestBackup(restored, backup); w.Code != http.StatusOK {
+		t.Fatalf("restore status %d: %s", w.Code, w.Body.String())
+	}
+	if restored.GetWallet("old") == nil {
+		t.Error("wallet of the version 1 backup not restored")
+	}
+}
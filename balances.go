@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"net/http"
+	"strings"
+)
+
+// Upper bound on the sample points of one balance query
+const MaxBalanceSamples = 50
+
+type BalanceHistoryMessage struct {
+	QueryMessage
+	Wallet string
+	// Block heights to sample, 0 is the latest state
+	Heights []int64
+}
+
+type BalanceBreakdown struct {
+	Symbol string
+	Free   int64
+	Frozen int64
+	Locked int64
+}
+
+type BalanceSample struct {
+	// Height of the state, the cached height for the latest state
+	Height   int64
+	Balances []BalanceBreakdown
+}
+
+type BalanceMessage struct {
+	BasicMessage
+	QueryMessage
+}
+
+// Latest balances of a wallet
+type BalanceResponse struct {
+	Wallet  string
+	Address string
+	BalanceSample
+}
+
+type BalanceHistoryResponse struct {
+	Wallet  string
+	Address string
+	Samples []BalanceSample
+}
+
+// The node answers 404 for addresses that never received funds.
+func isAccountNotFound(err error) bool {
+	return strings.Contains(err.Error(), "status code 404")
+}
+
+// Queries the latest balances of the wallet, returns its address on
+// the network of the node. A never funded wallet has no balances.
+func queryBalances(w http.ResponseWriter, r *http.Request, qm *QueryMessage, keyManager keys.KeyManager) (string, BalanceSample, error) {
+	sample := BalanceSample{Balances: []BalanceBreakdown{}}
+	hosts, network, err := queryHostsForRequest(r, qm)
+	if err != nil {
+		return "", sample, err
+	}
+	address, err := addressForNetwork(keyManager.GetAddr(), network)
+	if err != nil {
+		return "", sample, err
+	}
+	var account *types.BalanceAccount
+	var served string
+	err = queryWithFailover(w, hosts, func(host string) error {
+		client, err := newQueryClient(host, network)
+		if err != nil {
+			return err
+		}
+		account, err = client.GetAccount(address)
+		served = host
+		return err
+	})
+	if err != nil && !isAccountNotFound(err) {
+		return "", sample, err
+	}
+
+	sample.Height, _ = chainInfo.Height(served, network)
+	if err != nil {
+		return address, sample, nil
+	}
+	for _, b := range account.Balances {
+		sample.Balances = append(sample.Balances, BalanceBreakdown{
+			Symbol: b.Symbol,
+			Free:   b.Free.ToInt64(),
+			Frozen: b.Frozen.ToInt64(),
+			Locked: b.Locked.ToInt64(),
+		})
+	}
+	return address, sample, nil
+}
+
+// Returns the free, frozen and locked balances of a wallet.
+func getBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	data := &BalanceMessage{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionRead)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	address, sample, err := queryBalances(w, r, &data.QueryMessage, keyManager)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	WriteTypedResponse(w, r, ResponseTypeBalance, BalanceResponse{Wallet: data.Wallet, Address: address, BalanceSample: sample})
+}
+
+// Same as getBalanceHandler, with the wallet named in the path. The
+// payload only selects the node.
+func getWalletBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	data := &QueryMessage{}
+	datastore, user, err := decodeRequestBasic(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	name := chi.URLParam(r, "name")
+	wallet := datastore.GetWallet(name)
+	if wallet == nil {
+		render.Render(w, r, ErrInvalidRequest(denialError(r, codedError(ErrorCodeWalletNotFound, errors.New("No matching wallet could be found.")))))
+		return
+	}
+	logRequestAction(r, name, PermissionRead)
+	if !datastore.IsPermitted(user, name, PermissionRead) {
+		render.Render(w, r, ErrInvalidRequest(denialError(r, codedError(ErrorCodePermissionDenied, errors.New("Not permitted.")))))
+		return
+	}
+	keyManager, err := wallet.GetKeyManager()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	address, sample, err := queryBalances(w, r, data, keyManager)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	WriteTypedResponse(w, r, ResponseTypeBalance, BalanceResponse{Wallet: name, Address: address, BalanceSample: sample})
+}
+
+var errHistoricalStateUnsupported = &RequestError{
+	HTTPStatusCode: http.StatusNotImplemented,
+	StatusText:     "Not supported.",
+	AppCode:        ErrorCodeNotSupported,
+	Err:            errors.New("The node does not expose historical account state, only height 0 (latest) can be queried."),
+}
+
+// Returns the free, frozen and locked balances of a wallet at each
+// requested height. Nodes only serve the latest account state over
+// their HTTP API, so historical heights are rejected.
+func getBalanceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	data := &BalanceHistoryMessage{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionRead)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if len(data.Heights) == 0 || len(data.Heights) > MaxBalanceSamples {
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("Between 1 and %d heights can be queried.", MaxBalanceSamples)))
+		return
+	}
+	for _, height := range data.Heights {
+		if height < 0 {
+			render.Render(w, r, ErrInvalidRequest(errors.New("Heights must not be negative.")))
+			return
+		}
+		if height != 0 {
+			render.Render(w, r, ErrInvalidRequest(errHistoricalStateUnsupported))
+			return
+		}
+	}
+
+	address, sample, err := queryBalances(w, r, &data.QueryMessage, keyManager)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	response := BalanceHistoryResponse{Wallet: data.Wallet, Address: address, Samples: []BalanceSample{}}
+	for range data.Heights {
+		response.Samples = append(response.Samples, sample)
+	}
+	WriteTypedResponse(w, r, ResponseTypeBalances, response)
+}
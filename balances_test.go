@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/go-chi/chi"
+)
+
+// Answers the queries of every host with the client until the returned
+// function is called.
+func useQueryClient(client *testDexClient) func() {
+	previous := newDexClient
+	newDexClient = func(host string, network types.ChainNetwork, keyManager keys.KeyManager) (sdk.DexClient, error) {
+		return client, nil
+	}
+	return func() { newDexClient = previous }
+}
+
+func balanceRequest(datastore *DexVaultDatastore, user string, wallet string) *http.Request {
+	data := &BalanceMessage{QueryMessage: QueryMessage{QueryHost: "balances.test", QueryNetwork: int(types.TestNetwork)}}
+	data.Wallet = wallet
+	return testRequest("POST", "/v1/balance", user, data, datastore, &DexVaultConfiguration{})
+}
+
+func TestBalanceHandler(t *testing.T) {
+	datastore := testDatastore()
+	keyManager, err := datastore.GetWallet("mnemonic").GetKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := addressForNetwork(keyManager.GetAddr(), int(types.TestNetwork))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &testDexClient{Accounts: map[string]*types.BalanceAccount{address: {
+		Address: address,
+		Balances: []types.TokenBalance{
+			{Symbol: "BNB", Free: 500, Locked: 20, Frozen: 10},
+			{Symbol: "XYZ-000", Free: 7},
+		},
+	}}}
+	defer useQueryClient(client)()
+
+	for wallet, want := range map[string][]BalanceBreakdown{
+		"mnemonic": {{Symbol: "BNB", Free: 500, Frozen: 10, Locked: 20}, {Symbol: "XYZ-000", Free: 7}},
+		// Never funded
+		"key": {},
+	} {
+		w := serveSigning(getBalanceHandler, balanceRequest(datastore, "alice", wallet))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", wallet, w.Code, w.Body.String())
+		}
+		response := struct {
+			Type ResponseType
+			Data BalanceResponse
+		}{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		balances := response.Data.Balances
+		if response.Type != ResponseTypeBalance || response.Data.Wallet != wallet || balances == nil || len(balances) != len(want) {
+			t.Errorf("%s: response %s, want %d balances", wallet, w.Body.String(), len(want))
+			continue
+		}
+		for i := range want {
+			if balances[i] != want[i] {
+				t.Errorf("%s: balance %+v, want %+v", wallet, balances[i], want[i])
+			}
+		}
+	}
+
+	// The wallet named in the path.
+	router := chi.NewRouter()
+	router.Get("/v1/wallet/{name}/balance", getWalletBalanceHandler)
+	query := QueryMessage{QueryHost: "balances.test", QueryNetwork: int(types.TestNetwork)}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, testRequest("GET", "/v1/wallet/mnemonic/balance", "alice", query, datastore, &DexVaultConfiguration{}))
+	response := struct {
+		Data BalanceResponse
+	}{}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil || response.Data.Address != address || len(response.Data.Balances) != 2 {
+		t.Errorf("response %s, want the balances of %s", w.Body.String(), address)
+	}
+
+	datastore.Users = append(datastore.Users, &DexVaultAuth{Name: "bob", Permissions: []Permission{PermissionSendToken}})
+	if w := serveSigning(getBalanceHandler, balanceRequest(datastore, "bob", "mnemonic")); errorCode(t, w) != ErrorCodePermissionDenied {
+		t.Errorf("balances queried without PermissionRead: %s", w.Body.String())
+	}
+}
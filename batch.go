@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type BatchStatus string
+
+const BatchStatusAllSucceeded BatchStatus = "all_succeeded"
+const BatchStatusPartial BatchStatus = "partial"
+const BatchStatusAllFailed BatchStatus = "all_failed"
+
+// Upper bound on the items of one batch request
+const MaxBatchItems = 100
+
+// Outcome of one item of a batch, in the order of the request.
+type BatchItemResult struct {
+	Index int
+	Ok    bool
+	Tx    string    `json:",omitempty"`
+	Code  ErrorCode `json:",omitempty"`
+	Error string    `json:",omitempty"`
+}
+
+type BatchResponse struct {
+	Status    BatchStatus
+	Succeeded int
+	Failed    int
+	Results   []BatchItemResult
+}
+
+type CancelOrderItem struct {
+	BaseAssetSymbol  string
+	QuoteAssetSymbol string
+	RefId            string
+	ClientOrderId    string
+}
+
+type CancelOrders struct {
+	SignedMessage
+	Orders []CancelOrderItem
+}
+
+func failedBatchItem(index int, err error) BatchItemResult {
+	code := ErrorCodeInvalidPayload
+	if re, ok := err.(*RequestError); ok && re.AppCode != "" {
+		code = re.AppCode
+	}
+	return BatchItemResult{Index: index, Code: code, Error: err.Error()}
+}
+
+func newBatchResponse(results []BatchItemResult) BatchResponse {
+	response := BatchResponse{Results: results}
+	for _, res := range results {
+		if res.Ok {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	switch {
+	case response.Failed == 0:
+		response.Status = BatchStatusAllSucceeded
+	case response.Succeeded == 0:
+		response.Status = BatchStatusAllFailed
+	default:
+		response.Status = BatchStatusPartial
+	}
+	return response
+}
+
+// Responds with 200 if every item succeeded, otherwise with 207 so
+// clients know to inspect the individual results.
+func writeBatchResponse(w http.ResponseWriter, r *http.Request, response BatchResponse) {
+	if response.Status != BatchStatusAllSucceeded {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	WriteTypedResponse(w, r, ResponseTypeBatch, response)
+}
+
+// Signs a cancel for each order. Items that fail do not use up a
+// sequence, so the signed transactions have consecutive sequences
+// starting at Sequence and must be broadcast in order. A BroadcastHost
+// is only used to check that the orders are open, nothing is broadcast.
+func cancelOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	data := &CancelOrders{}
+	datastore, _, keyManager, err := decodeRequest(r, data, PermissionCancelOrder)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if len(data.Orders) == 0 || len(data.Orders) > MaxBatchItems {
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("A batch must contain 1 to %d orders.", MaxBatchItems)))
+		return
+	}
+	var client sdk.DexClient
+	if data.BroadcastHost != "" {
+		err = checkWalletNetwork(datastore, data.Wallet, data.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeNetworkMismatch, err)))
+			return
+		}
+		client, err = newQueryClient(data.BroadcastHost, data.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if requireApproval(w, r, PermissionCancelOrder) {
+		return
+	}
+
+	results := []BatchItemResult{}
+	sequence := data.Sequence
+	for i, item := range data.Orders {
+		cancel := &CancelOrder{
+			SignedMessage:    data.SignedMessage,
+			BaseAssetSymbol:  item.BaseAssetSymbol,
+			QuoteAssetSymbol: item.QuoteAssetSymbol,
+			RefId:            item.RefId,
+		}
+		cancel.Sequence = sequence
+		if cancel.RefId == "" && item.ClientOrderId != "" {
+			o := datastore.GetClientOrder(data.Wallet, item.ClientOrderId)
+			if o == nil {
+				results = append(results, failedBatchItem(i, errClientOrderNotFound))
+				continue
+			}
+			cancel.RefId = o.OrderId
+			cancel.BaseAssetSymbol = o.BaseAssetSymbol
+			cancel.QuoteAssetSymbol = o.QuoteAssetSymbol
+		}
+		if client != nil {
+			open, err := isOrderOpen(client, keyManager, cancel.CombinedSymbol(), cancel.RefId)
+			if err != nil {
+				results = append(results, failedBatchItem(i, err))
+				continue
+			}
+			if !open {
+				results = append(results, failedBatchItem(i, codedError(ErrorCodeOrderNotFound, errors.New("No open order found with ID: "+cancel.RefId))))
+				continue
+			}
+		}
+
+		hexTx, err := createSignedCancelOrderMsg(keyManager, cancel)
+		if err != nil {
+			results = append(results, failedBatchItem(i, err))
+			continue
+		}
+		err = recordSigning(r, data.Wallet, PermissionCancelOrder, hexTx)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		results = append(results, BatchItemResult{Index: i, Ok: true, Tx: string(hexTx)})
+		signingEvent(r, data.Wallet, PermissionCancelOrder, hexTx, "", SigningOutcomeSigned, nil)
+		sequence++
+	}
+
+	response := newBatchResponse(results)
+	auditLog(r, "Signed batch "+string(PermissionCancelOrder)+" with wallet "+data.Wallet+": "+string(response.Status))
+	writeBatchResponse(w, r, response)
+}
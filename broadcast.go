@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type BroadcastMode string
+
+// Return once the transaction passed CheckTx
+const BroadcastModeSync BroadcastMode = "sync"
+
+// Return as soon as the node received the transaction, before
+// CheckTx. Results only contain the hash.
+const BroadcastModeAsync BroadcastMode = "async"
+
+// Return once the transaction was included in a block and has the
+// requested number of confirmations
+const BroadcastModeBlock BroadcastMode = "block"
+
+// Return a job ID right away and broadcast in sync mode in the
+// background, see jobs.go
+const BroadcastModeQueued BroadcastMode = "queued"
+
+const confirmationPollInterval = time.Second
+
+// Configured broadcast behaviour of an action
+type BroadcastPolicy struct {
+	Mode          BroadcastMode `yaml:"mode"`
+	Confirmations int64         `yaml:"confirmations"`
+}
+
+type BroadcastOptions struct {
+	Mode BroadcastMode
+	// Number of blocks, including the one containing the
+	// transaction, to wait for in block mode
+	Confirmations int64
+	Timeout       time.Duration
+	// Tried in order if the broadcast to the host fails
+	FallbackHosts []string
+}
+
+// Resolves how a request is broadcast. Values set in the request take
+// precedence over the configured policy of the action, and without
+// either the transaction is broadcast in sync mode.
+func resolveBroadcastOptions(cfg *DexVaultConfiguration, action Permission, sm *SignedMessage) (BroadcastOptions, error) {
+	policy := cfg.BroadcastPolicies[action]
+	options := BroadcastOptions{
+		Mode:          policy.Mode,
+		Confirmations: policy.Confirmations,
+		Timeout:       time.Duration(cfg.ConfirmationTimeout) * time.Second,
+		FallbackHosts: sm.BroadcastHosts,
+	}
+	if sm.BroadcastMode != "" {
+		options.Mode = sm.BroadcastMode
+	}
+	if sm.Confirmations < 0 {
+		return options, errors.New("Confirmations must not be negative.")
+	}
+	if sm.Confirmations > 0 {
+		options.Confirmations = sm.Confirmations
+	}
+
+	switch options.Mode {
+	case "", BroadcastModeSync:
+		options.Mode = BroadcastModeSync
+		options.Confirmations = 0
+	case BroadcastModeAsync, BroadcastModeQueued:
+		options.Confirmations = 0
+	case BroadcastModeBlock:
+		if options.Confirmations < 1 {
+			options.Confirmations = 1
+		}
+	default:
+		return options, errors.New("Unknown broadcast mode: " + string(options.Mode))
+	}
+	return options, nil
+}
+
+// Broadcast hosts are passed to the SDK, which adds the scheme and the
+// API path, so only a host name with an optional port is accepted,
+// e.g. dex.binance.org.
+func validateBroadcastHost(host string) error {
+	if host == "" {
+		return errors.New("No broadcast host supplied.")
+	}
+	u, err := url.Parse("https://" + host)
+	if err != nil || u.Host != host || u.Hostname() == "" {
+		return errors.New("Invalid broadcast host, expected a host name such as dex.binance.org: " + host)
+	}
+	return nil
+}
+
+// Posts the transaction to a single host.
+func postTx(host string, network int, hexTx []byte, options BroadcastOptions) (sdk.DexClient, []tx.TxCommitResult, error) {
+	err := validateBroadcastHost(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := getOrCreateClient(host, network)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not create a client for broadcast host %s: %s", host, err)
+	}
+
+	param := map[string]string{}
+	if options.Mode != BroadcastModeAsync {
+		param["sync"] = "true"
+	}
+	var commits []tx.TxCommitResult
+	err = withBroadcastRetry(broadcastRetry, host, func() error {
+		var err error
+		commits, err = client.PostTx(hexTx, param)
+		return err
+	})
+	return client, commits, err
+}
+
+// Posts the transaction to host, and if that fails to the fallback
+// hosts in order. Rejections of the transaction itself would fail on
+// every host, so they are returned right away.
+func broadcastMessage(host string, network int, hexTx []byte, options BroadcastOptions) (*BroadcastResponse, error) {
+	start := time.Now()
+	response, err := broadcastToHosts(host, network, hexTx, options)
+	observeBroadcast(network, start, response, err)
+	return response, err
+}
+
+func broadcastToHosts(host string, network int, hexTx []byte, options BroadcastOptions) (*BroadcastResponse, error) {
+	hosts := append([]string{host}, options.FallbackHosts...)
+	var client sdk.DexClient
+	var commits []tx.TxCommitResult
+	var err error
+	failures := []string{}
+	for _, h := range hosts {
+		client, commits, err = postTx(h, network, hexTx, options)
+		if err == nil {
+			host = h
+			break
+		}
+		if len(hosts) == 1 {
+			return nil, err
+		}
+		if re, ok := broadcastError(err).(*RequestError); ok && re.AppCode != ErrorCodeBroadcastFailed {
+			return nil, err
+		}
+		fmt.Println("Broadcast to " + h + " failed: " + err.Error())
+		failures = append(failures, h+": "+err.Error())
+	}
+	if err != nil {
+		return nil, errors.New("Broadcast to all hosts failed: " + strings.Join(failures, "; "))
+	}
+
+	response := BroadcastResponseFromTxCommitResults(commits)
+	response.Host = host
+	if options.Mode == BroadcastModeAsync {
+		// Nodes may answer before hashing the transaction, the hash
+		// does not depend on them.
+		if len(response.Results) == 0 {
+			response.Results = append(response.Results, BroadcastResult{Ok: true})
+		}
+		for i := range response.Results {
+			if response.Results[i].Hash == "" {
+				response.Results[i].Hash = txHash(hexTx)
+			}
+		}
+	}
+	if options.Mode == BroadcastModeBlock {
+		for i, result := range response.Results {
+			if !result.Ok {
+				continue
+			}
+			height, err := waitForConfirmations(client, result.Hash, options.Confirmations, options.Timeout)
+			if err != nil {
+				return nil, err
+			}
+			response.Results[i].Height = height
+		}
+	}
+	return &response, err
+}
+
+// A committed transaction as returned by the tx query of the node.
+// Unlike tx.TxResult of the SDK it includes the block height.
+type CommittedTx struct {
+	Hash   string `json:"hash"`
+	Log    string `json:"log"`
+	Data   string `json:"data"`
+	Code   int32  `json:"code"`
+	Height int64  `json:"height,string"`
+}
+
+// Looks up a committed transaction. The node answers 404 until the
+// transaction is included in a block.
+func getCommittedTx(client sdk.DexClient, hash string) (*CommittedTx, error) {
+	resp, code, err := client.Get("/tx/"+hash, map[string]string{"format": "json"})
+	if code == http.StatusNotFound {
+		return nil, errors.New("Transaction " + hash + " not found.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result CommittedTx
+	err = json.Unmarshal(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Polls the node until the transaction is included in a block and
+// the chain has advanced far enough. Returns the height of the block
+// containing the transaction.
+func waitForConfirmations(client sdk.DexClient, hash string, confirmations int64, timeout time.Duration) (int64, error) {
+	deadline := time.Now().Add(timeout)
+	var height int64 = 0
+	for {
+		if height == 0 {
+			// The node returns an error until the transaction is committed.
+			result, err := getCommittedTx(client, hash)
+			if err == nil {
+				if result.Code != 0 {
+					return 0, fmt.Errorf("Transaction %s failed with code %d: %s", hash, result.Code, result.Log)
+				}
+				height = result.Height
+			}
+		}
+		if height > 0 {
+			status, err := client.GetNodeInfo()
+			if err == nil && status.SyncInfo.LatestBlockHeight-height+1 >= confirmations {
+				return height, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("Timed out waiting for %d confirmations of transaction %s.", confirmations, hash)
+		}
+		time.Sleep(confirmationPollInterval)
+	}
+}
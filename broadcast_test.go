@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/keys"
+)
+
+// A client created by the cache, with the host and network it was
+// created for.
+type createdClient struct {
+	host    string
+	network types.ChainNetwork
+	client  *testDexClient
+}
+
+// Starts with an empty client cache whose clients accept everything,
+// and records the clients created until the returned function is called.
+func recordClients() (*[]createdClient, func()) {
+	created := []createdClient{}
+	previous := newDexClient
+	previousClients := dexClients
+	dexClients = newClientCache(0)
+	newDexClient = func(host string, network types.ChainNetwork, keyManager keys.KeyManager) (sdk.DexClient, error) {
+		client := &testDexClient{}
+		created = append(created, createdClient{host: host, network: network, client: client})
+		return client, nil
+	}
+	return &created, func() {
+		newDexClient = previous
+		dexClients = previousClients
+	}
+}
+
+func TestBroadcastToRequestedHost(t *testing.T) {
+	created, restore := recordClients()
+	defer restore()
+
+	_, err := broadcastMessage("dex.binance.org", int(types.ProdNetwork), []byte("tx"), BroadcastOptions{Mode: BroadcastModeSync})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*created) != 1 {
+		t.Fatalf("%d clients created, want 1", len(*created))
+	}
+	c := (*created)[0]
+	if c.host != "dex.binance.org" || c.network != types.ProdNetwork {
+		t.Errorf("client for %s on network %d, want dex.binance.org on mainnet", c.host, c.network)
+	}
+	if len(c.client.Posted) != 1 {
+		t.Errorf("posted %d transactions to the host, want 1", len(c.client.Posted))
+	}
+}
+
+func TestBroadcastHostValidated(t *testing.T) {
+	created, restore := recordClients()
+	defer restore()
+
+	for _, host := range []string{"", "https://dex.binance.org", "dex.binance.org/api", "a b"} {
+		_, err := broadcastMessage(host, 0, []byte("tx"), BroadcastOptions{Mode: BroadcastModeSync})
+		if err == nil {
+			t.Errorf("broadcast to %q accepted", host)
+		}
+	}
+	if len(*created) != 0 {
+		t.Errorf("%d clients created for invalid hosts", len(*created))
+	}
+	if validateBroadcastHost("testnet-dex.binance.org:443") != nil {
+		t.Error("host with port rejected")
+	}
+}
+
+func TestBroadcastDialsHost(t *testing.T) {
+	created, restore := recordClients()
+	defer restore()
+
+	for _, host := range []string{"testnet-dex.binance.org", "node.example.com:8080"} {
+		response, err := broadcastMessage(host, int(types.TestNetwork), []byte("tx"), BroadcastOptions{Mode: BroadcastModeSync})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := (*created)[len(*created)-1]
+		if c.host != host || response.Host != host {
+			t.Errorf("dialed %s and answered by %s, want %s", c.host, response.Host, host)
+		}
+	}
+}
+
+func TestBroadcastClientError(t *testing.T) {
+	_, restore := recordClients()
+	defer restore()
+	newDexClient = func(host string, network types.ChainNetwork, keyManager keys.KeyManager) (sdk.DexClient, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	_, err := broadcastMessage("down.test", 0, []byte("tx"), BroadcastOptions{Mode: BroadcastModeSync})
+	if err == nil || !strings.Contains(err.Error(), "Could not create a client for broadcast host down.test") {
+		t.Errorf("error %v, want the client of the host", err)
+	}
+}
+
+func TestBroadcastModes(t *testing.T) {
+	sm := &SignedMessage{}
+	options, err := resolveBroadcastOptions(&DexVaultConfiguration{}, PermissionSendToken, sm)
+	if err != nil || options.Mode != BroadcastModeSync {
+		t.Fatalf("default mode %s (%v), want sync", options.Mode, err)
+	}
+
+	for _, mode := range []BroadcastMode{BroadcastModeSync, BroadcastModeAsync, BroadcastModeBlock} {
+		sm.BroadcastMode = mode
+		options, err := resolveBroadcastOptions(&DexVaultConfiguration{ConfirmationTimeout: 5}, PermissionSendToken, sm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &testDexClient{Height: 42}
+		useTestClient("modes.test", 0, client)
+		response, err := broadcastMessage("modes.test", 0, []byte("tx "+string(mode)), options)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		sync := client.Params[0]["sync"] == "true"
+		if sync == (mode == BroadcastModeAsync) {
+			t.Errorf("%s: posted with sync %t", mode, sync)
+		}
+		if response.Results[0].Hash != txHash([]byte("tx "+string(mode))) {
+			t.Errorf("%s: hash %s", mode, response.Results[0].Hash)
+		}
+		wantHeight := int64(0)
+		if mode == BroadcastModeBlock {
+			wantHeight = 42
+		}
+		if response.Results[0].Height != wantHeight {
+			t.Errorf("%s: height %d, want %d", mode, response.Results[0].Height, wantHeight)
+		}
+	}
+
+	sm.BroadcastMode = "commit"
+	if _, err := resolveBroadcastOptions(&DexVaultConfiguration{}, PermissionSendToken, sm); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+func TestBroadcastFallbackHosts(t *testing.T) {
+	primary := &testDexClient{Failures: 1}
+	secondary := &testDexClient{}
+	useTestClient("primary.test", 0, primary)
+	useTestClient("secondary.test", 0, secondary)
+	options := BroadcastOptions{Mode: BroadcastModeSync, FallbackHosts: []string{"secondary.test"}}
+
+	response, err := broadcastMessage("primary.test", 0, []byte("tx"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Host != "secondary.test" || len(secondary.Posted) != 1 {
+		t.Errorf("accepted by %s, posted %d to the fallback", response.Host, len(secondary.Posted))
+	}
+
+	primary.Failures = 1
+	secondary.Failures = 1
+	_, err = broadcastMessage("primary.test", 0, []byte("tx"), options)
+	if err == nil || !strings.Contains(err.Error(), "primary.test: ") || !strings.Contains(err.Error(), "secondary.test: ") {
+		t.Errorf("error %v, want the errors of both hosts", err)
+	}
+
+	// Would be rejected by every host.
+	primary.Failures = 1
+	primary.Err = errors.New("insufficient fund: 5BNB < 10BNB")
+	posted := len(secondary.Posted)
+	_, err = broadcastMessage("primary.test", 0, []byte("tx"), options)
+	if err == nil || len(secondary.Posted) != posted {
+		t.Errorf("rejected transaction posted to the fallback (%v)", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// A simple cache whose entries expire after a fixed time.
+type ttlCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]ttlCacheEntry
+}
+
+type ttlCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{
+		ttl:     ttl,
+		entries: map[string]ttlCacheEntry{},
+	}
+}
+
+func (c *ttlCache) Get(key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache) Set(key string, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[key] = ttlCacheEntry{
+		value:   value,
+		expires: time.Now().Add(c.ttl),
+	}
+}
+
+// Removes all entries whose key matches.
+func (c *ttlCache) DeleteFunc(match func(key string) bool) {
+	c.Lock()
+	defer c.Unlock()
+	for key := range c.entries {
+		if match(key) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/go-chi/render"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A broadcast host the service talks to, see broadcast_hosts in the
+// configuration.
+type BroadcastHostConfig struct {
+	Host    string `yaml:"host"`
+	Network int    `yaml:"network"`
+}
+
+// Cached information about a broadcast host
+type NodeInfo struct {
+	Host    string
+	Network int
+	ChainId string
+	Height  int64
+	Updated time.Time
+	Ready   bool
+	Error   string `json:",omitempty"`
+}
+
+type NodeInfoResponse struct {
+	Nodes []NodeInfo
+}
+
+type chainInfoCache struct {
+	sync.RWMutex
+	nodes map[string]*NodeInfo
+	hosts []BroadcastHostConfig
+}
+
+// Chain information of all configured broadcast hosts, refreshed in
+// the background.
+var chainInfo = &chainInfoCache{nodes: map[string]*NodeInfo{}}
+
+func fetchNodeInfo(host BroadcastHostConfig) NodeInfo {
+	info := NodeInfo{
+		Host:    host.Host,
+		Network: host.Network,
+		Updated: time.Now().UTC(),
+	}
+
+	client, err := sdk.NewDexClient(host.Host, types.ChainNetwork(host.Network), nil)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	status, err := client.GetNodeInfo()
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	if status.NodeInfo.Network == "" {
+		info.Error = "Node did not report a chain ID."
+		return info
+	}
+
+	info.ChainId = status.NodeInfo.Network
+	info.Height = status.SyncInfo.LatestBlockHeight
+	info.Ready = true
+	return info
+}
+
+func (c *chainInfoCache) refresh() {
+	c.RLock()
+	hosts := c.hosts
+	c.RUnlock()
+
+	for _, host := range hosts {
+		info := fetchNodeInfo(host)
+		if !info.Ready {
+			fmt.Println("Failed to get chain ID of " + host.Host + ": " + info.Error)
+		}
+
+		c.Lock()
+		old, ok := c.nodes[host.Host]
+		if ok && !info.Ready && old.ChainId != "" {
+			// Keep the last known chain ID, it does not change.
+			info.ChainId = old.ChainId
+			info.Height = old.Height
+		}
+		c.nodes[host.Host] = &info
+		c.Unlock()
+	}
+}
+
+// Fetches the chain information of all hosts and keeps refreshing it
+// in the given interval.
+func (c *chainInfoCache) Start(hosts []BroadcastHostConfig, interval time.Duration) {
+	c.Lock()
+	c.hosts = hosts
+	c.Unlock()
+
+	c.refresh()
+	for _, host := range hosts {
+		if id, ok := c.ChainId(host.Host); ok {
+			fmt.Println("Chain ID of " + host.Host + ": " + id)
+		}
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			c.refresh()
+		}
+	}()
+}
+
+// Returns the cached chain ID of a host.
+func (c *chainInfoCache) ChainId(host string) (string, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	info, ok := c.nodes[host]
+	if !ok || info.ChainId == "" {
+		return "", false
+	}
+	return info.ChainId, true
+}
+
+// Returns the cached height of the host on the network, or of the
+// first configured host of the network if it is not cached itself.
+func (c *chainInfoCache) Height(host string, network int) (int64, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	if info, ok := c.nodes[host]; ok && info.Network == network && info.Height > 0 {
+		return info.Height, true
+	}
+	for _, h := range c.hosts {
+		if info, ok := c.nodes[h.Host]; ok && h.Network == network && info.Height > 0 {
+			return info.Height, true
+		}
+	}
+	return 0, false
+}
+
+// Returns an error if the chain ID of any configured host is unknown.
+func (c *chainInfoCache) Ready() error {
+	c.RLock()
+	defer c.RUnlock()
+	for _, host := range c.hosts {
+		info, ok := c.nodes[host.Host]
+		if !ok || info.ChainId == "" {
+			return errors.New("Chain ID of " + host.Host + " is unknown.")
+		}
+	}
+	return nil
+}
+
+func (c *chainInfoCache) Nodes() []NodeInfo {
+	c.RLock()
+	defer c.RUnlock()
+	nodes := []NodeInfo{}
+	for _, host := range c.hosts {
+		if info, ok := c.nodes[host.Host]; ok {
+			nodes = append(nodes, *info)
+		}
+	}
+	return nodes
+}
+
+func getNodeInfoHandler(w http.ResponseWriter, r *http.Request) {
+	datastore := GetRequestDatastore(r)
+	user := GetRequestUser(r)
+	u := datastore.GetUser(user)
+	if !u.HasPermission(PermissionRead) {
+		render.Render(w, r, ErrPermissionDenied())
+		return
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeNodeInfo, NodeInfoResponse{Nodes: chainInfo.Nodes()})
+}
@@ -5,8 +5,9 @@ import (
 	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/jwtauth"
+	"github.com/go-chi/render"
 	"net/http"
-	"strings"
+	"time"
 	// "fmt"
 )
 
@@ -15,20 +16,22 @@ const ConfigurationCtxKey = "configurationctxkey"
 const DatastoreCtxKey = "datastorectxkey"
 
 // Validate the request
-func Verifier(ja []*DexVaultAuth) func(http.Handler) http.Handler {
+// The users are looked up on every request, so that changes to the
+// datastore (e.g. a restore) take effect immediately.
+func Verifier(datastore *DexVaultDatastore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return Verify(ja, jwtauth.TokenFromQuery, jwtauth.TokenFromHeader, jwtauth.TokenFromCookie)(next)
+		return Verify(datastore, jwtauth.TokenFromQuery, jwtauth.TokenFromHeader, jwtauth.TokenFromCookie)(next)
 	}
 }
 
-func Verify(ja []*DexVaultAuth, findTokenFns ...func(r *http.Request) string) func(http.Handler) http.Handler {
+func Verify(datastore *DexVaultDatastore, findTokenFns ...func(r *http.Request) string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		hfn := func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
 			var token *jwt.Token
 			var err error
 			var name *string = nil
-			for _, v := range ja {
+			for _, v := range datastore.Users {
 				j := v.GetJwtAuth()
 				token, err = jwtauth.VerifyRequest(j, r, findTokenFns...)
 				if err == nil {
@@ -53,17 +56,26 @@ func Authenticator(next http.Handler) http.Handler {
 		if err != nil {
 			fmt.Println("Authenticator failed:")
 			fmt.Println(err)
-			http.Error(w, http.StatusText(401), 401)
+			authFailureMetric.Inc(AuthFailureToken)
+			render.Render(w, r, ErrUnauthorized())
 			return
 		}
 
 		if token == nil || !token.Valid {
 			fmt.Println("Authenticator failed: Invalid/empty token.")
-			http.Error(w, http.StatusText(401), 401)
+			authFailureMetric.Inc(AuthFailureToken)
+			render.Render(w, r, ErrUnauthorized())
 			return
 		}
 
-		fmt.Println("Authenticator user: " + *r.Context().Value(NameCtxKey).(*string))
+		claims, _ := token.Claims.(jwt.MapClaims)
+		err = checkTokenTimes(GetRequestConfig(r), claims, time.Now())
+		if err != nil {
+			fmt.Println("Authenticator failed: " + err.Error())
+			authFailureMetric.Inc(AuthFailureTokenExpired)
+			render.Render(w, r, ErrTokenExpired(err))
+			return
+		}
 
 		// Token is authenticated, pass it through
 		next.ServeHTTP(w, r)
@@ -74,12 +86,9 @@ func Authenticator(next http.Handler) http.Handler {
 func IPWhitelist(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		ip := strings.Split(r.RemoteAddr, ":")[0]
-		fmt.Println("Requesting IP: " + ip)
-
+		ip := ClientIP(r)
 		cfg := GetRequestConfig(r)
 		if cfg.IpWhitelist {
-			fmt.Println("Whitelist enabled.")
 			var allow = false
 			for _, wip := range cfg.Whitelist {
 				if wip == ip {
@@ -89,13 +98,29 @@ func IPWhitelist(next http.Handler) http.Handler {
 			}
 
 			if !allow {
-				fmt.Println("IP not found in whitelist.")
-				http.Error(w, http.StatusText(401), 401)
+				fmt.Println("IP not found in whitelist: " + ip)
+				authFailureMetric.Inc(AuthFailureIP)
+				render.Render(w, r, ErrUnauthorized())
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rejects requests of users with an IP allowlist from other IPs.
+// Must run after the Authenticator.
+func UserIPAllowlist(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetRequestUser(r)
+		u := GetRequestDatastore(r).GetUser(user)
+		if u != nil && len(u.AllowedIPs) > 0 {
+			ip := ClientIP(r)
+			if !ipInList(ip, u.AllowedIPs) {
+				fmt.Println("Denied request of user " + user + " from IP " + ip + ": not in the allowlist of the user.")
+				render.Render(w, r, ErrPermissionDenied())
 				return
 			}
-			fmt.Println("IP allowed.")
-		} else {
-			fmt.Println("Whitelist disabled.")
 		}
 		next.ServeHTTP(w, r)
 	})
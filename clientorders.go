@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Orders on Binance Chain expire after 72 hours, mappings of older
+// orders are dropped.
+const ClientOrderTTL = 72 * time.Hour
+
+// Maps a client-assigned reference to the order ID derived by the
+// chain, so orders can be cancelled by the reference.
+type ClientOrder struct {
+	ClientOrderId    string
+	Wallet           string
+	OrderId          string
+	BaseAssetSymbol  string
+	QuoteAssetSymbol string
+	Created          time.Time
+}
+
+// Guards ClientOrders in the datastore.
+var clientOrdersMutex sync.Mutex
+
+var errClientOrderNotFound = &RequestError{
+	HTTPStatusCode: http.StatusNotFound,
+	StatusText:     "Not found.",
+	AppCode:        ErrorCodeOrderNotFound,
+	Err:            errors.New("No order with this ClientOrderId is known."),
+}
+
+// Removes expired mappings. Must hold clientOrdersMutex.
+func (b *DexVaultDatastore) pruneClientOrders() {
+	orders := []*ClientOrder{}
+	for _, o := range b.ClientOrders {
+		if time.Since(o.Created) < ClientOrderTTL {
+			orders = append(orders, o)
+		}
+	}
+	b.ClientOrders = orders
+}
+
+func (b *DexVaultDatastore) GetClientOrder(wallet string, clientOrderId string) *ClientOrder {
+	clientOrdersMutex.Lock()
+	defer clientOrdersMutex.Unlock()
+	b.pruneClientOrders()
+	for _, o := range b.ClientOrders {
+		if o.Wallet == wallet && o.ClientOrderId == clientOrderId {
+			c := *o
+			return &c
+		}
+	}
+	return nil
+}
+
+// Stores a mapping. References must be unique per wallet while the
+// order may still be open.
+func (b *DexVaultDatastore) AddClientOrder(o *ClientOrder) error {
+	if b.GetClientOrder(o.Wallet, o.ClientOrderId) != nil {
+		return errors.New("ClientOrderId is already in use: " + o.ClientOrderId)
+	}
+	clientOrdersMutex.Lock()
+	defer clientOrdersMutex.Unlock()
+	b.ClientOrders = append(b.ClientOrders, o)
+	return b.persist()
+}
+
+func (b *DexVaultDatastore) RemoveClientOrder(wallet string, clientOrderId string) {
+	clientOrdersMutex.Lock()
+	defer clientOrdersMutex.Unlock()
+	orders := []*ClientOrder{}
+	for _, o := range b.ClientOrders {
+		if o.Wallet != wallet || o.ClientOrderId != clientOrderId {
+			orders = append(orders, o)
+		}
+	}
+	b.ClientOrders = orders
+	b.persist()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/types"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Clients used for broadcasting, reused across requests as creating
+// one fetches the node info.
+type clientCache struct {
+	sync.RWMutex
+	// Entries are evicted after this long, never if zero
+	ttl     time.Duration
+	clients map[string]clientCacheEntry
+}
+
+type clientCacheEntry struct {
+	client  sdk.DexClient
+	created time.Time
+}
+
+var dexClients = newClientCache(0)
+
+// Creates the clients of the cache and of queries, fetching the node
+// info.
+var newDexClient = sdk.NewDexClient
+
+func newClientCache(ttl time.Duration) *clientCache {
+	return &clientCache{
+		ttl:     ttl,
+		clients: map[string]clientCacheEntry{},
+	}
+}
+
+func (c *clientCache) SetTTL(ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.ttl = ttl
+}
+
+func (c *clientCache) expired(e clientCacheEntry) bool {
+	return c.ttl > 0 && time.Since(e.created) > c.ttl
+}
+
+// Returns the cached client of the host and network or creates one.
+// Broadcasting only posts transactions signed beforehand, so clients
+// are created without a key manager and shared between wallets.
+func (c *clientCache) Get(host string, network int) (sdk.DexClient, error) {
+	key := host + "/" + strconv.Itoa(network)
+
+	c.RLock()
+	e, ok := c.clients[key]
+	c.RUnlock()
+	if ok && !c.expired(e) {
+		return e.client, nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	// Another request may have created it in the meantime.
+	e, ok = c.clients[key]
+	if ok && !c.expired(e) {
+		return e.client, nil
+	}
+	client, err := newDexClient(host, types.ChainNetwork(network), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[key] = clientCacheEntry{client: client, created: time.Now()}
+	return client, nil
+}
+
+func getOrCreateClient(host string, network int) (sdk.DexClient, error) {
+	return dexClients.Get(host, network)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/keys"
+)
+
+// Creates clients like the SDK does, fetching the node info from the
+// test node, and records the key managers they were given.
+func useNodeInfoClients() (*[]keys.KeyManager, func()) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"node_info":{"network":"Binance-Chain-Test"}}`))
+	}))
+	keyManagers := []keys.KeyManager{}
+	previous := newDexClient
+	newDexClient = func(host string, network types.ChainNetwork, keyManager keys.KeyManager) (sdk.DexClient, error) {
+		resp, err := http.Get(node.URL + "/api/v1/node-info")
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		keyManagers = append(keyManagers, keyManager)
+		return &testDexClient{}, nil
+	}
+	return &keyManagers, func() {
+		newDexClient = previous
+		node.Close()
+	}
+}
+
+func TestClientCacheSharesClients(t *testing.T) {
+	keyManagers, restore := useNodeInfoClients()
+	defer restore()
+	c := newClientCache(0)
+	first, err := c.Get("a.test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.Get("a.test", 0); again != first {
+		t.Error("client of the host created again")
+	}
+	if other, _ := c.Get("a.test", 1); other == first {
+		t.Error("client shared between networks")
+	}
+	if len(*keyManagers) != 2 {
+		t.Fatalf("%d clients created, want 2", len(*keyManagers))
+	}
+	for _, km := range *keyManagers {
+		if km != nil {
+			t.Error("client created with a key manager")
+		}
+	}
+}
+
+func BenchmarkBroadcastClient(b *testing.B) {
+	_, restore := useNodeInfoClients()
+	defer restore()
+	hosts := []string{"a.test", "b.test", "c.test"}
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := newDexClient(hosts[i%len(hosts)], types.TestNetwork, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		c := newClientCache(0)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_, err := c.Get(hosts[i%len(hosts)], int(types.TestNetwork))
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+)
+
+const redacted = "[redacted]"
+
+type ConfigResponse struct {
+	// Effective values, including defaults, with secrets redacted
+	Config DexVaultConfiguration
+	// Signing actions supported by this server
+	Actions []Permission
+}
+
+// Returns a copy of the configuration that is safe to show to admins.
+func (c *DexVaultConfiguration) Redacted() DexVaultConfiguration {
+	redactedCfg := *c
+	if redactedCfg.VaultToken != "" {
+		redactedCfg.VaultToken = redacted
+	}
+	return redactedCfg
+}
+
+// Reads the configuration attached to the request, so the response
+// reflects the values the server is currently using.
+func getConfigHandler(w http.ResponseWriter, r *http.Request) {
+	_, user, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	auditLog(r, "Configuration read by "+user)
+	WriteTypedResponse(w, r, ResponseTypeConfig, ConfigResponse{
+		Config:  GetRequestConfig(r).Redacted(),
+		Actions: SigningPermissions,
+	})
+}
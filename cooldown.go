@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Guards LastSigned in the datastore.
+var cooldownMutex sync.Mutex
+
+// Rejects the signing request if the previous one for the wallet was
+// within its configured cooldown, otherwise records it.
+func checkCooldown(cfg *DexVaultConfiguration, datastore *DexVaultDatastore, wallet string) error {
+	seconds, ok := cfg.SigningCooldowns[wallet]
+	if !ok || seconds <= 0 {
+		return nil
+	}
+	cooldown := time.Duration(seconds) * time.Second
+
+	cooldownMutex.Lock()
+	defer cooldownMutex.Unlock()
+
+	now := time.Now()
+	last, ok := datastore.LastSigned[wallet]
+	if ok && now.Sub(last) < cooldown {
+		remaining := int(math.Ceil((cooldown - now.Sub(last)).Seconds()))
+		return &RequestError{
+			HTTPStatusCode: http.StatusTooManyRequests,
+			StatusText:     "Wallet is cooling down.",
+			RetryAfter:     remaining,
+			AppCode:        ErrorCodeRateLimited,
+			Err:            fmt.Errorf("Wallet %s can sign again in %d seconds.", wallet, remaining),
+		}
+	}
+
+	if datastore.LastSigned == nil {
+		datastore.LastSigned = map[string]time.Time{}
+	}
+	datastore.LastSigned[wallet] = now
+	datastore.persist()
+	return nil
+}
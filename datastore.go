@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
 	"github.com/binance-chain/go-sdk/keys"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 // JWT Authentication struct (User)
@@ -12,25 +19,123 @@ type DexVaultAuth struct {
 	Name        string
 	Secret      string
 	Permissions []Permission
+	// IPs and CIDR ranges the user may connect from, unrestricted if empty
+	AllowedIPs []string `json:",omitempty"`
 }
 
 type Wallet struct {
 	Name string
-	Seed string
+	// Mnemonic, only set until the wallet is sealed, see Seal
+	Seed string `json:",omitempty"`
+	// Network the wallet may broadcast to, empty if untagged
+	Network string `json:",omitempty"`
+	// Notified of every signing with the wallet
+	Webhook *WalletWebhook `json:",omitempty"`
+	// Memo of transfers that do not set one
+	DefaultMemo string `json:",omitempty"`
+	// Derivation path of imported wallets, empty for the default
+	// path of Binance Chain
+	KeyPath string `json:",omitempty"`
+	// Hex-encoded key of wallets imported without a mnemonic, used
+	// instead of the Seed, only set until the wallet is sealed
+	PrivateKey string `json:",omitempty"`
+	// Salt and AES-GCM ciphertext of the Seed or PrivateKey
+	SealedKey []byte `json:",omitempty"`
+	// Set by admins to block all signing, see freeze.go
+	Frozen       bool   `json:",omitempty"`
+	FrozenReason string `json:",omitempty"`
+
+	// Passphrase the key was sealed with, set by Seal
+	passphrase string
 }
 
 type DexVaultDatastore struct {
-	Secret  string `json:"-"`
+	Secret string `json:"-"`
+	// File the datastore is saved to, see persist
+	Path    string `json:"-"`
 	Wallets []Wallet
 	Users   []*DexVaultAuth
+	// Actions awaiting approval, see approvals.go
+	PendingActions []*PendingAction
+	// Time of the last signing request per wallet, see cooldown.go
+	LastSigned map[string]time.Time
+	// Orders signed ahead of time, see scheduled.go
+	ScheduledOrders []*ScheduledOrder
+	// Client references of orders, see clientorders.go
+	ClientOrders []*ClientOrder
+	// Amounts sent within the spending window, see limits.go
+	Spending []*SpendingRecord
+
+	// Wallets that were loaded with a plaintext key, see sealWallets
+	plaintextWallets int
+}
+
+// Guards Wallets in the datastore. Changes take the write lock,
+// GetWallet, ListWallets and saving the datastore the read lock.
+var walletsMutex sync.RWMutex
+
+// Serializes saving the datastore, see Save.
+var saveMutex sync.Mutex
+
+// Takes the mutexes of all fields other than Wallets, in the order
+// DeleteWallet takes them, e.g. to copy or replace the datastore as a
+// whole. Returns a function that releases them. walletsMutex may be
+// taken while holding them, not the other way round.
+func lockDatastore() func() {
+	cooldownMutex.Lock()
+	approvalsMutex.Lock()
+	schedulerMutex.Lock()
+	clientOrdersMutex.Lock()
+	spendingMutex.Lock()
+	return func() {
+		spendingMutex.Unlock()
+		clientOrdersMutex.Unlock()
+		schedulerMutex.Unlock()
+		approvalsMutex.Unlock()
+		cooldownMutex.Unlock()
+	}
 }
 
-func (b *DexVaultDatastore) CreateWallet(wallet string) (*Wallet, error) {
+// File of the sealed datastore, in the working directory
+const DatastoreFile = "datastore.bin"
+
+// Length of secp256k1 private keys
+const PrivateKeyLength = 32
+
+var errWalletExists = &RequestError{
+	HTTPStatusCode: http.StatusConflict,
+	StatusText:     "Conflict.",
+	AppCode:        ErrorCodeWalletExists,
+	Err:            errors.New("Wallet with name already exists."),
+}
+
+var errWalletNotFound = &RequestError{
+	HTTPStatusCode: http.StatusNotFound,
+	StatusText:     "Not found.",
+	AppCode:        ErrorCodeWalletNotFound,
+	Err:            errors.New("No matching wallet could be found."),
+}
+
+func (b *DexVaultDatastore) CreateWallet(wallet string, network string) (*Wallet, error) {
+	walletsMutex.Lock()
 	fmt.Println("Creating new wallet: " + wallet)
-	old_w := b.GetWallet(wallet)
+	w, err := b.createWallet(wallet, network)
+	walletsMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.persist(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Must hold walletsMutex.
+func (b *DexVaultDatastore) createWallet(wallet string, network string) (*Wallet, error) {
+	old_w := b.getWallet(wallet)
 	if old_w != nil {
 		fmt.Println("Wallet with name already exists.")
-		return nil, errors.New("Wallet with name already exists.")
+		return nil, errWalletExists
 	}
 
 	newKey, err := keys.NewKeyManager()
@@ -47,18 +152,114 @@ func (b *DexVaultDatastore) CreateWallet(wallet string) (*Wallet, error) {
 	}
 
 	w := Wallet{
-		Name: wallet,
-		Seed: mnemonic,
+		Name:    wallet,
+		Seed:    mnemonic,
+		Network: network,
+	}
+	err = w.Seal(b.Secret)
+	if err != nil {
+		return nil, err
 	}
 
 	b.Wallets = append(b.Wallets, w)
-	b.Save()
 	return &w, nil
 }
 
+// Adds a wallet with an existing mnemonic. The mnemonic, including its
+// checksum, is validated before the wallet is stored. Keys that are
+// already stored under another name are rejected.
+func (b *DexVaultDatastore) ImportWallet(wallet string, mnemonic string, keyPath string, network string) (*Wallet, error) {
+	w := Wallet{
+		Name:    wallet,
+		Seed:    strings.Join(strings.Fields(mnemonic), " "),
+		Network: network,
+		KeyPath: keyPath,
+	}
+	keyManager, err := w.GetKeyManager()
+	if err != nil {
+		return nil, errors.New("Invalid mnemonic or key path: " + err.Error())
+	}
+	return b.addImportedWallet(w, keyManager.GetAddr())
+}
+
+// Adds a wallet with an existing hex-encoded secp256k1 private key,
+// which is validated before the wallet is stored.
+func (b *DexVaultDatastore) ImportPrivateKey(wallet string, privateKey string, network string) (*Wallet, error) {
+	privateKey = strings.TrimPrefix(strings.TrimSpace(privateKey), "0x")
+	key, err := hex.DecodeString(privateKey)
+	if err != nil || len(key) != PrivateKeyLength {
+		return nil, fmt.Errorf("The private key must be %d hex-encoded bytes.", PrivateKeyLength)
+	}
+	w := Wallet{
+		Name:       wallet,
+		PrivateKey: hex.EncodeToString(key),
+		Network:    network,
+	}
+	keyManager, err := w.GetKeyManager()
+	if err != nil {
+		return nil, errors.New("Invalid private key: " + err.Error())
+	}
+	return b.addImportedWallet(w, keyManager.GetAddr())
+}
+
+// Stores an imported wallet, unless its name or its key is taken.
+func (b *DexVaultDatastore) addImportedWallet(w Wallet, address types.AccAddress) (*Wallet, error) {
+	err := w.Seal(b.Secret)
+	if err != nil {
+		return nil, err
+	}
+	// Unsealing the stored keys is slow, so they are compared without
+	// holding the lock. Only wallets stored in the meantime are
+	// compared under it.
+	compared := map[string]bool{}
+	for _, other := range b.ListWallets() {
+		if err := checkKeyNotStored(other, address); err != nil {
+			return nil, err
+		}
+		compared[other.Name] = true
+	}
+	walletsMutex.Lock()
+	err = b.storeImportedWallet(w, address, compared)
+	walletsMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.persist(); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Must hold walletsMutex. Skips comparing the keys of the wallets
+// already compared.
+func (b *DexVaultDatastore) storeImportedWallet(w Wallet, address types.AccAddress, compared map[string]bool) error {
+	if b.getWallet(w.Name) != nil {
+		return errWalletExists
+	}
+	for _, other := range b.Wallets {
+		if compared[other.Name] {
+			continue
+		}
+		if err := checkKeyNotStored(other, address); err != nil {
+			return err
+		}
+	}
+	b.Wallets = append(b.Wallets, w)
+	return nil
+}
+
+// Rejects the address if it is the address of the wallet's key.
+func checkKeyNotStored(other Wallet, address types.AccAddress) error {
+	km, err := other.GetKeyManager()
+	if err == nil && bytes.Equal(km.GetAddr().Bytes(), address.Bytes()) {
+		return errors.New("The key is already stored as wallet " + other.Name + ".")
+	}
+	return nil
+}
+
 func (u *DexVaultAuth) HasPermission(p Permission) bool {
 	for _, per := range u.Permissions {
-		if per == PermissionAll {
+		if per == PermissionAll && !isStrictPermission(p) {
 			return true
 		}
 		if per == p {
@@ -95,20 +296,66 @@ func (u *DexVaultAuth) RevokePermission(p Permission) {
 	}
 }
 
+// Creates the key manager of the wallet, unsealing its key just for
+// that if it is sealed.
 func (w *Wallet) GetKeyManager() (keys.KeyManager, error) {
-	return keys.NewMnemonicKeyManager(w.Seed)
+	k := &walletKey{Seed: w.Seed, PrivateKey: w.PrivateKey}
+	if w.SealedKey != nil {
+		var err error
+		k, err = w.openKey(w.passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k.PrivateKey != "" {
+		return keys.NewPrivateKeyManager(k.PrivateKey)
+	}
+	if w.KeyPath != "" {
+		return keys.NewMnemonicPathKeyManager(k.Seed, w.KeyPath)
+	}
+	return keys.NewMnemonicKeyManager(k.Seed)
+}
+
+// Seals the wallets with the Secret of the datastore. Wallets of older
+// datastores hold their key in plaintext and are counted in
+// plaintextWallets, so the caller can save them sealed.
+func (b *DexVaultDatastore) sealWallets() error {
+	for i := range b.Wallets {
+		if b.Wallets[i].SealedKey == nil {
+			b.plaintextWallets++
+		}
+		err := b.Wallets[i].Seal(b.Secret)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (w *Wallet) GetAddress() (*string, error) {
-	km, err := w.GetKeyManager()
+	addresses, err := w.GetAddresses()
 	if err != nil {
 		return nil, err
 	}
-	straddr := km.GetAddr().String()
-	return &straddr, nil
+	return &addresses.Address, nil
 }
 
+// Returns a copy of the wallet, nil if there is none with the name.
 func (b *DexVaultDatastore) GetWallet(wallet string) *Wallet {
+	walletsMutex.RLock()
+	defer walletsMutex.RUnlock()
+	return b.getWallet(wallet)
+}
+
+// Returns a copy of all wallets.
+func (b *DexVaultDatastore) ListWallets() []Wallet {
+	walletsMutex.RLock()
+	defer walletsMutex.RUnlock()
+	return append([]Wallet{}, b.Wallets...)
+}
+
+// Must hold walletsMutex.
+func (b *DexVaultDatastore) getWallet(wallet string) *Wallet {
 	for _, w := range b.Wallets {
 		if w.Name == wallet {
 			return &w
@@ -117,15 +364,141 @@ func (b *DexVaultDatastore) GetWallet(wallet string) *Wallet {
 	return nil
 }
 
+// Deletes the wallet with its key, and everything that refers to it:
+// its cooldown, pending actions, scheduled orders and client order
+// references. Permissions are granted per user, not per wallet, so
+// they are left as they are.
 func (b *DexVaultDatastore) DeleteWallet(w string) error {
+	walletsMutex.Lock()
+	found := false
 	for i, wallet := range b.Wallets {
 		if wallet.Name == w {
-			b.Wallets = append(b.Wallets[:i], b.Wallets[i+1:]...)
-			b.Save()
-			return nil
+			last := len(b.Wallets) - 1
+			copy(b.Wallets[i:], b.Wallets[i+1:])
+			// Don't leave a copy of a key behind in the backing array.
+			b.Wallets[last] = Wallet{}
+			b.Wallets = b.Wallets[:last]
+			found = true
+			break
+		}
+	}
+	walletsMutex.Unlock()
+	if !found {
+		return errWalletNotFound
+	}
+
+	cooldownMutex.Lock()
+	delete(b.LastSigned, w)
+	cooldownMutex.Unlock()
+
+	approvalsMutex.Lock()
+	pending := []*PendingAction{}
+	for _, p := range b.PendingActions {
+		if p.Wallet != w {
+			pending = append(pending, p)
+		}
+	}
+	b.PendingActions = pending
+	approvalsMutex.Unlock()
+
+	schedulerMutex.Lock()
+	scheduled := []*ScheduledOrder{}
+	for _, o := range b.ScheduledOrders {
+		if o.Wallet != w {
+			scheduled = append(scheduled, o)
+		}
+	}
+	b.ScheduledOrders = scheduled
+	schedulerMutex.Unlock()
+
+	clientOrdersMutex.Lock()
+	clientOrders := []*ClientOrder{}
+	for _, o := range b.ClientOrders {
+		if o.Wallet != w {
+			clientOrders = append(clientOrders, o)
 		}
 	}
-	return errors.New("Wallet not found.")
+	b.ClientOrders = clientOrders
+	clientOrdersMutex.Unlock()
+
+	spendingMutex.Lock()
+	spending := []*SpendingRecord{}
+	for _, s := range b.Spending {
+		if s.Wallet != w {
+			spending = append(spending, s)
+		}
+	}
+	b.Spending = spending
+	spendingMutex.Unlock()
+
+	return b.persist()
+}
+
+// Renames a wallet, keeping its key, and everything that refers to
+// it. Names in the configuration, e.g. signing_cooldowns, are not
+// changed.
+func (b *DexVaultDatastore) RenameWallet(oldName string, newName string) error {
+	if newName == "" {
+		return errors.New("No new name supplied.")
+	}
+	walletsMutex.Lock()
+	found := -1
+	for i, wallet := range b.Wallets {
+		if wallet.Name == newName {
+			walletsMutex.Unlock()
+			return errWalletExists
+		}
+		if wallet.Name == oldName {
+			found = i
+		}
+	}
+	if found < 0 {
+		walletsMutex.Unlock()
+		return errors.New("Wallet not found.")
+	}
+	b.Wallets[found].Name = newName
+	walletsMutex.Unlock()
+
+	cooldownMutex.Lock()
+	if last, ok := b.LastSigned[oldName]; ok {
+		b.LastSigned[newName] = last
+		delete(b.LastSigned, oldName)
+	}
+	cooldownMutex.Unlock()
+
+	approvalsMutex.Lock()
+	for _, p := range b.PendingActions {
+		if p.Wallet == oldName {
+			p.Wallet = newName
+		}
+	}
+	approvalsMutex.Unlock()
+
+	schedulerMutex.Lock()
+	for _, o := range b.ScheduledOrders {
+		if o.Wallet == oldName {
+			o.Wallet = newName
+		}
+	}
+	schedulerMutex.Unlock()
+
+	clientOrdersMutex.Lock()
+	for _, o := range b.ClientOrders {
+		if o.Wallet == oldName {
+			o.Wallet = newName
+		}
+	}
+	clientOrdersMutex.Unlock()
+
+	spendingMutex.Lock()
+	for _, s := range b.Spending {
+		if s.Wallet == oldName {
+			s.Wallet = newName
+		}
+	}
+	spendingMutex.Unlock()
+
+	return b.persist()
 }
 
 func (b *DexVaultDatastore) GetUser(user string) *DexVaultAuth {
@@ -139,42 +512,35 @@ func (b *DexVaultDatastore) GetUser(user string) *DexVaultAuth {
 
 func (b *DexVaultDatastore) CreateUser(u *DexVaultAuth) {
 	b.Users = append(b.Users, u)
-	b.Save()
+	b.persist()
 }
 
 func (b *DexVaultDatastore) DeleteUser(u string) error {
 	for i, user := range b.Users {
 		if user.Name == u {
 			b.Users = append(b.Users[:i], b.Users[i+1:]...)
-			b.Save()
-			return nil
+			return b.persist()
 		}
 	}
 	return errors.New("User not found.")
 }
 
 func (b *DexVaultDatastore) IsPermitted(user string, wallet string, action Permission) bool {
-	fmt.Println("IsPermitted: " + user + "for action: " + string(action))
 	u := b.GetUser(user)
 	w := b.GetWallet(wallet)
 
 	if u == nil || w == nil {
-		fmt.Println("No user or wallet found.")
 		return false
 	}
 
 	for _, p := range u.Permissions {
-		if p == PermissionAll {
-			fmt.Println("User has ALL permission.")
+		if p == PermissionAll && !isStrictPermission(action) {
 			return true
 		}
 		if p == action {
-			fmt.Println("User has permission.")
 			return true
 		}
 	}
 
-	fmt.Println("User does NOT have permission.")
-
 	return false
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// BIP39 test vector, the key of a wallet nobody should fund
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+const testPrivateKey = "0101010101010101010101010101010101010101010101010101010101010101"
+
+func testDatastore() *DexVaultDatastore {
+	return &DexVaultDatastore{
+		Secret: "test secret",
+		Wallets: []Wallet{
+			{Name: "mnemonic", Seed: testMnemonic},
+			{Name: "key", PrivateKey: testPrivateKey},
+		},
+		Users: []*DexVaultAuth{
+			{Name: "alice", Secret: "alice secret", Permissions: []Permission{PermissionAll}},
+		},
+	}
+}
+
+func walletAddress(t *testing.T, datastore *DexVaultDatastore, name string) string {
+	w := datastore.GetWallet(name)
+	if w == nil {
+		t.Fatalf("wallet %s not found", name)
+	}
+	km, err := w.GetKeyManager()
+	if err != nil {
+		t.Fatalf("key manager of %s: %v", name, err)
+	}
+	return km.GetAddr().String()
+}
+
+func TestDatastoreSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DatastoreFile)
+	datastore := testDatastore()
+	err := datastore.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &DexVaultDatastore{Secret: datastore.Secret}
+	err = loaded.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Path != path {
+		t.Errorf("Path is %q, want %q", loaded.Path, path)
+	}
+	if len(loaded.Wallets) != 2 || loaded.GetUser("alice") == nil {
+		t.Fatalf("loaded %d wallets and user %v", len(loaded.Wallets), loaded.GetUser("alice"))
+	}
+	for _, name := range []string{"mnemonic", "key"} {
+		if got, want := walletAddress(t, loaded, name), walletAddress(t, datastore, name); got != want {
+			t.Errorf("address of %s is %s after reloading, want %s", name, got, want)
+		}
+	}
+}
+
+func TestDatastoreLoadWrongSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DatastoreFile)
+	err := testDatastore().Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &DexVaultDatastore{Secret: "wrong"}
+	if loaded.Load(path) == nil {
+		t.Fatal("loaded the datastore with the wrong secret")
+	}
+}
+
+func TestDatastoreConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DatastoreFile)
+	datastore := testDatastore()
+	datastore.Path = path
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := datastore.persist(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	loaded := &DexVaultDatastore{Secret: datastore.Secret}
+	err := loaded.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Wallets) != 2 {
+		t.Errorf("loaded %d wallets, want 2", len(loaded.Wallets))
+	}
+	tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if len(tmp) != 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+}
+
+func TestDatastoreConcurrentWalletAccess(t *testing.T) {
+	datastore := testDatastore()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := datastore.RenameWallet("mnemonic", "renamed"); err != nil {
+			t.Error(err)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		name := "new" + strconv.Itoa(i)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if _, err := datastore.CreateWallet(name, "test"); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := datastore.SetFrozen("key", false, ""); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				datastore.IsPermitted("alice", "key", PermissionSendToken)
+				datastore.GetWallet("mnemonic")
+				datastore.ListWallets()
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(datastore.ListWallets()); n != 6 {
+		t.Errorf("%d wallets, want 6", n)
+	}
+	if datastore.GetWallet("renamed") == nil {
+		t.Error("renamed wallet not found")
+	}
+	if !datastore.IsPermitted("alice", "key", PermissionSendToken) {
+		t.Error("alice is not permitted to send from key")
+	}
+}
+
+func TestRenameWalletKeepsKey(t *testing.T) {
+	datastore := testDatastore()
+	address := walletAddress(t, datastore, "mnemonic")
+	datastore.Spending = []*SpendingRecord{{Wallet: "mnemonic", Symbol: "BNB", Amount: 5}}
+
+	err := datastore.RenameWallet("mnemonic", "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datastore.GetWallet("mnemonic") != nil {
+		t.Error("wallet still found by its old name")
+	}
+	if got := walletAddress(t, datastore, "renamed"); got != address {
+		t.Errorf("address %s after renaming, want %s", got, address)
+	}
+	if datastore.Spending[0].Wallet != "renamed" {
+		t.Errorf("spending of %s, want the new name", datastore.Spending[0].Wallet)
+	}
+
+	if err := datastore.RenameWallet("renamed", "key"); err != errWalletExists {
+		t.Errorf("renaming to an existing name returned %v", err)
+	}
+	if err := datastore.RenameWallet("mnemonic", "other"); err == nil {
+		t.Error("renamed an unknown wallet")
+	}
+	if err := datastore.RenameWallet("renamed", ""); err == nil {
+		t.Error("renamed to an empty name")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Stable, machine-readable error codes returned as "code" in error
+// responses. Codes are never renamed or reused, new ones may be added.
+type ErrorCode string
+
+const ErrorCodeInvalidPayload ErrorCode = "INVALID_PAYLOAD"
+const ErrorCodePermissionDenied ErrorCode = "PERMISSION_DENIED"
+const ErrorCodeWalletNotFound ErrorCode = "WALLET_NOT_FOUND"
+const ErrorCodePolicyViolation ErrorCode = "POLICY_VIOLATION"
+const ErrorCodeNetworkMismatch ErrorCode = "NETWORK_MISMATCH"
+const ErrorCodeRateLimited ErrorCode = "RATE_LIMITED"
+const ErrorCodeApprovalPending ErrorCode = "APPROVAL_PENDING"
+const ErrorCodeSequenceMismatch ErrorCode = "SEQUENCE_MISMATCH"
+const ErrorCodeInsufficientFunds ErrorCode = "INSUFFICIENT_FUNDS"
+const ErrorCodeBroadcastFailed ErrorCode = "BROADCAST_FAILED"
+const ErrorCodeQueueFull ErrorCode = "QUEUE_FULL"
+const ErrorCodeOrderNotFound ErrorCode = "ORDER_NOT_FOUND"
+const ErrorCodeClockDrift ErrorCode = "CLOCK_DRIFT"
+const ErrorCodeNotSupported ErrorCode = "NOT_SUPPORTED"
+const ErrorCodeNonceReused ErrorCode = "NONCE_REUSED"
+const ErrorCodeTxNotFound ErrorCode = "TX_NOT_FOUND"
+const ErrorCodeUnauthorized ErrorCode = "UNAUTHORIZED"
+const ErrorCodeTokenExpired ErrorCode = "TOKEN_EXPIRED"
+const ErrorCodeWalletExists ErrorCode = "WALLET_EXISTS"
+const ErrorCodeWalletFrozen ErrorCode = "WALLET_FROZEN"
+const ErrorCodeLimitExceeded ErrorCode = "LIMIT_EXCEEDED"
+
+type ErrorCodeInfo struct {
+	Code        ErrorCode
+	Description string
+}
+
+// All error codes, published by the capabilities endpoint.
+var ErrorCodes = []ErrorCodeInfo{
+	{ErrorCodeInvalidPayload, "The request could not be decoded or failed validation."},
+	{ErrorCodePermissionDenied, "The user lacks the permission for the request. Also returned for all denials if denial_detail is generic."},
+	{ErrorCodeWalletNotFound, "No wallet with the given name exists."},
+	{ErrorCodePolicyViolation, "The request violates a policy of this deployment."},
+	{ErrorCodeNetworkMismatch, "The wallet is tagged for a different network than the broadcast."},
+	{ErrorCodeRateLimited, "The wallet is cooling down, see the Retry-After header."},
+	{ErrorCodeApprovalPending, "The pending action does not exist, does not match or lacks approvals."},
+	{ErrorCodeSequenceMismatch, "The node rejected the transaction because of its sequence."},
+	{ErrorCodeInsufficientFunds, "The node rejected the transaction because the wallet lacks funds."},
+	{ErrorCodeBroadcastFailed, "Broadcasting the transaction failed for another reason."},
+	{ErrorCodeQueueFull, "Too many broadcast jobs are queued, see the Retry-After header."},
+	{ErrorCodeOrderNotFound, "No open order matches the ClientOrderId or RefId."},
+	{ErrorCodeClockDrift, "The IssuedAt of the payload is too far in the future or the past."},
+	{ErrorCodeNotSupported, "The node does not support the query."},
+	{ErrorCodeNonceReused, "The Nonce of the payload was already used."},
+	{ErrorCodeTxNotFound, "No committed transaction has the hash."},
+	{ErrorCodeUnauthorized, "The token is missing or invalid, or the IP is not whitelisted."},
+	{ErrorCodeWalletExists, "A wallet with the name already exists."},
+	{ErrorCodeWalletFrozen, "An admin froze the wallet, it can not sign until it is unfrozen."},
+	{ErrorCodeLimitExceeded, "The transfer would exceed a daily spending limit of the wallet, see remaining."},
+	{ErrorCodeTokenExpired, "The token has expired, or is not valid yet, or lacks the exp claim required by max_token_lifetime."},
+}
+
+type CapabilitiesResponse struct {
+	ErrorCodes []ErrorCodeInfo
+}
+
+// Wraps err so it is rendered as an invalid request with the code.
+func codedError(code ErrorCode, err error) error {
+	return &RequestError{
+		HTTPStatusCode: http.StatusBadRequest,
+		StatusText:     "Invalid request.",
+		AppCode:        code,
+		Err:            err,
+	}
+}
+
+// Classifies an error returned by the node when broadcasting.
+func broadcastError(err error) error {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "sequence"):
+		return codedError(ErrorCodeSequenceMismatch, err)
+	case strings.Contains(msg, "insufficient"):
+		return codedError(ErrorCodeInsufficientFunds, err)
+	}
+	return codedError(ErrorCodeBroadcastFailed, err)
+}
+
+// Stateless, so only a valid token is required.
+func getCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	WriteTypedResponse(w, r, ResponseTypeCapabilities, CapabilitiesResponse{ErrorCodes: ErrorCodes})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Decodes the code of an error response.
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) ErrorCode {
+	response := ErrResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("error response %q: %v", w.Body.String(), err)
+	}
+	return response.AppCode
+}
+
+func TestErrorCodesOfRequests(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	datastore.Users = append(datastore.Users, &DexVaultAuth{Name: "bob", Permissions: []Permission{PermissionRead}})
+	unknown := sendTokenPayload(100, "")
+	unknown.Wallet = "cold"
+	invalid := sendTokenPayload(100, "")
+	invalid.BroadcastNetwork = 7
+
+	for _, test := range []struct {
+		name string
+		user string
+		send *SendToken
+		code ErrorCode
+	}{
+		{"unknown wallet", "alice", unknown, ErrorCodeWalletNotFound},
+		{"without permission", "bob", sendTokenPayload(100, ""), ErrorCodePermissionDenied},
+		{"invalid payload", "alice", invalid, ErrorCodeInvalidPayload},
+		{"above limit", "alice", sendTokenPayload(2000, ""), ErrorCodeLimitExceeded},
+	} {
+		r := testRequest("POST", "/v1/token/send", test.user, test.send, datastore, cfg)
+		w := serveSigning(sendTokenHandler, r)
+		if code := errorCode(t, w); code != test.code {
+			t.Errorf("%s: code %s, want %s", test.name, code, test.code)
+		}
+	}
+}
+
+func TestErrorCodesOfBroadcasts(t *testing.T) {
+	for message, code := range map[string]ErrorCode{
+		"Invalid sequence. Got 3, expected 4":   ErrorCodeSequenceMismatch,
+		"insufficient fund: 5BNB < 10BNB":       ErrorCodeInsufficientFunds,
+		"bad response, status code 503":         ErrorCodeBroadcastFailed,
+		"Broadcast to all hosts failed: a.test": ErrorCodeBroadcastFailed,
+	} {
+		re, ok := broadcastError(errors.New(message)).(*RequestError)
+		if !ok || re.AppCode != code || re.HTTPStatusCode != http.StatusBadRequest {
+			t.Errorf("%q classified as %v, want %s", message, re, code)
+		}
+	}
+}
+
+func TestCapabilitiesListErrorCodes(t *testing.T) {
+	r := testRequest("GET", "/v1/capabilities", "alice", struct{}{}, &DexVaultDatastore{}, &DexVaultConfiguration{})
+	w := httptest.NewRecorder()
+	getCapabilitiesHandler(w, r)
+	response := struct {
+		Data CapabilitiesResponse
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[ErrorCode]bool{}
+	for _, info := range response.Data.ErrorCodes {
+		if seen[info.Code] || info.Description == "" {
+			t.Errorf("code %s listed twice or without description", info.Code)
+		}
+		seen[info.Code] = true
+	}
+	for _, code := range []ErrorCode{ErrorCodeInvalidPayload, ErrorCodePermissionDenied, ErrorCodeWalletNotFound, ErrorCodeSequenceMismatch, ErrorCodeInsufficientFunds} {
+		if !seen[code] {
+			t.Errorf("code %s not published", code)
+		}
+	}
+}
@@ -34,7 +34,8 @@ type CreateOrder struct {
 }
 
 type Response struct {
-	Response string
+	Type string `json:"type"`
+	Data string `json:"data"`
 }
 
 
@@ -108,7 +109,7 @@ func main() {
 	}
 
 	// Broadcast transaction
-	commits, err := broadcastTx([]byte(response.Response))
+	commits, err := broadcastTx([]byte(response.Data))
 	if err != nil {
 		panic(err)
 	}
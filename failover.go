@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names the node that served a read request
+const QueryHostHeader = "X-Query-Host"
+
+// Deployment policy for skipping read hosts that keep failing. After
+// Failures consecutive transient failures a host is skipped for
+// Cooldown seconds.
+type HostCircuitBreakerPolicy struct {
+	Failures int `yaml:"failures"`
+	Cooldown int `yaml:"cooldown"`
+}
+
+func (p *HostCircuitBreakerPolicy) Validate() error {
+	if p.Failures < 0 || p.Cooldown < 0 {
+		return errors.New("failures and cooldown must not be negative.")
+	}
+	return nil
+}
+
+type hostBreakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+// Circuit breaker state of read hosts.
+type hostBreakers struct {
+	sync.Mutex
+	policy HostCircuitBreakerPolicy
+	hosts  map[string]*hostBreakerState
+}
+
+// Set from host_circuit_breaker when the server starts.
+var readHosts = &hostBreakers{
+	policy: HostCircuitBreakerPolicy{Failures: 3, Cooldown: 30},
+	hosts:  map[string]*hostBreakerState{},
+}
+
+func (b *hostBreakers) SetPolicy(policy HostCircuitBreakerPolicy) {
+	b.Lock()
+	defer b.Unlock()
+	b.policy = policy
+}
+
+// Returns the hosts whose circuit is closed, in order. If all
+// circuits are open all hosts are returned, so a request is never
+// rejected without trying.
+func (b *hostBreakers) Available(hosts []string) []string {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	available := []string{}
+	for _, host := range hosts {
+		s, ok := b.hosts[host]
+		if !ok || !now.Before(s.openUntil) {
+			available = append(available, host)
+		}
+	}
+	if len(available) == 0 {
+		return hosts
+	}
+	return available
+}
+
+func (b *hostBreakers) Success(host string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.hosts, host)
+}
+
+func (b *hostBreakers) Failure(host string) {
+	b.Lock()
+	defer b.Unlock()
+	s, ok := b.hosts[host]
+	if !ok {
+		s = &hostBreakerState{}
+		b.hosts[host] = s
+	}
+	s.failures++
+	if b.policy.Failures > 0 && s.failures >= b.policy.Failures {
+		if s.failures == b.policy.Failures {
+			fmt.Printf("Query host %s failed %d times, skipping it for %d seconds.\n", host, s.failures, b.policy.Cooldown)
+		}
+		s.openUntil = time.Now().Add(time.Duration(b.policy.Cooldown) * time.Second)
+	}
+}
+
+// Returns the nodes for a read request in the order they are tried,
+// all on the same network. Without a QueryHost the configured
+// broadcast hosts of the network of the first one are used.
+func queryHostsForRequest(r *http.Request, qm *QueryMessage) ([]string, int, error) {
+	if qm.QueryHost != "" {
+		if err := validateNetwork(qm.QueryNetwork); err != nil {
+			return nil, 0, errors.New("Invalid QueryNetwork: " + err.Error())
+		}
+		return append([]string{qm.QueryHost}, qm.QueryHosts...), qm.QueryNetwork, nil
+	}
+	if len(qm.QueryHosts) > 0 {
+		return nil, 0, errors.New("QueryHosts are only tried after QueryHost, which must be set.")
+	}
+	cfg := GetRequestConfig(r)
+	if len(cfg.BroadcastHosts) == 0 {
+		return nil, 0, errors.New("No QueryHost supplied and no broadcast_hosts configured.")
+	}
+	network := cfg.BroadcastHosts[0].Network
+	hosts := []string{}
+	for _, h := range cfg.BroadcastHosts {
+		if h.Network == network {
+			hosts = append(hosts, h.Host)
+		}
+	}
+	return hosts, network, nil
+}
+
+// Runs query against the hosts in order until one succeeds and names
+// it in the QueryHostHeader. Only transient errors, e.g. of the
+// connection to the node, fail over to the next host, others would
+// fail on every host and are returned right away.
+func queryWithFailover(w http.ResponseWriter, hosts []string, query func(host string) error) error {
+	var err error
+	failures := []string{}
+	for _, host := range readHosts.Available(hosts) {
+		err = query(host)
+		if err == nil || !isTransientBroadcastError(err) {
+			readHosts.Success(host)
+			if err == nil {
+				w.Header().Set(QueryHostHeader, host)
+			}
+			return err
+		}
+		readHosts.Failure(host)
+		fmt.Println("Query of " + host + " failed: " + err.Error())
+		failures = append(failures, host+": "+err.Error())
+	}
+	if len(failures) <= 1 {
+		return err
+	}
+	return errors.New("Querying all hosts failed: " + strings.Join(failures, "; "))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Returns the JSON names of the fields of a struct type, including
+// those of embedded structs and those omitted when empty.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			for n := range jsonFieldNames(f.Type) {
+				names[n] = true
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// Limits the result to the top-level fields listed in the fields
+// query parameter, e.g. ?fields=Name,Address. Without the parameter
+// the result is returned unchanged.
+func projectFields(r *http.Request, result interface{}) (interface{}, error) {
+	param := r.URL.Query().Get("fields")
+	if param == "" {
+		return result, nil
+	}
+	known := jsonFieldNames(reflect.TypeOf(result))
+	if len(known) == 0 {
+		return nil, errors.New("The response has no fields to select.")
+	}
+	requested := strings.Split(param, ",")
+	for _, name := range requested {
+		if !known[name] {
+			return nil, errors.New("Unknown field: " + name)
+		}
+	}
+
+	j, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]json.RawMessage{}
+	err = json.Unmarshal(j, &all)
+	if err != nil {
+		return nil, err
+	}
+	projected := map[string]json.RawMessage{}
+	for _, name := range requested {
+		if value, ok := all[name]; ok {
+			projected[name] = value
+		}
+	}
+	return projected, nil
+}
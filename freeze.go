@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type FreezeWalletMessage struct {
+	Wallet string
+	// False unfreezes the wallet
+	Frozen bool
+	// Why the wallet is frozen, e.g. a ticket of the investigation
+	Reason string
+}
+
+type FreezeWalletResponse struct {
+	Name   string
+	Frozen bool
+	Reason string `json:",omitempty"`
+}
+
+// Returned for every signing with a frozen wallet.
+func errWalletFrozen(wallet *Wallet) error {
+	message := "Wallet is frozen."
+	if wallet.FrozenReason != "" {
+		message = "Wallet is frozen: " + wallet.FrozenReason
+	}
+	return &RequestError{
+		HTTPStatusCode: http.StatusForbidden,
+		StatusText:     "Wallet is frozen.",
+		AppCode:        ErrorCodeWalletFrozen,
+		Err:            errors.New(message),
+	}
+}
+
+// Freezes or unfreezes a wallet. The flag is internal to DexVault and
+// unrelated to freezing tokens on the chain.
+func (b *DexVaultDatastore) SetFrozen(wallet string, frozen bool, reason string) error {
+	walletsMutex.Lock()
+	found := false
+	for i := range b.Wallets {
+		if b.Wallets[i].Name == wallet {
+			b.Wallets[i].Frozen = frozen
+			b.Wallets[i].FrozenReason = ""
+			if frozen {
+				b.Wallets[i].FrozenReason = reason
+			}
+			found = true
+		}
+	}
+	walletsMutex.Unlock()
+	if !found {
+		return errors.New("Wallet not found.")
+	}
+	return b.persist()
+}
+
+// Blocks or allows all signing with a wallet, e.g. during an
+// investigation. Reading the wallet stays possible.
+func freezeWalletHandler(w http.ResponseWriter, r *http.Request) {
+	datastore, _, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	data := &FreezeWalletMessage{}
+	err := decodePayload(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = datastore.SetFrozen(data.Wallet, data.Frozen, data.Reason)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeWalletNotFound, err)))
+		return
+	}
+	if data.Frozen {
+		auditLog(r, "Froze wallet "+data.Wallet+": "+data.Reason)
+	} else {
+		auditLog(r, "Unfroze wallet "+data.Wallet)
+		data.Reason = ""
+	}
+	WriteTypedResponse(w, r, ResponseTypeWalletFrozen, FreezeWalletResponse{Name: data.Wallet, Frozen: data.Frozen, Reason: data.Reason})
+}
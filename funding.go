@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	types_old "github.com/binance-chain/go-sdk/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"net/http"
+	"time"
+)
+
+// Deployment policy for funding new wallets with BNB to cover their
+// first fees. Funding is disabled unless a wallet is configured.
+type WalletFundingPolicy struct {
+	Wallet string `yaml:"wallet"`
+	// Amount sent, in the smallest unit (1e-8)
+	Amount int64 `yaml:"amount"`
+}
+
+func (p *WalletFundingPolicy) Enabled() bool {
+	return p.Wallet != ""
+}
+
+func (p *WalletFundingPolicy) Validate() error {
+	if p.Enabled() && p.Amount <= 0 {
+		return errors.New("amount must be positive.")
+	}
+	return nil
+}
+
+// Picks the broadcast host for funding a wallet. Tagged wallets are
+// funded on their network, others on the first configured host.
+func fundingHost(cfg *DexVaultConfiguration, network string) (BroadcastHostConfig, error) {
+	for _, host := range cfg.BroadcastHosts {
+		name, _ := networkName(host.Network)
+		if network == "" || name == network {
+			return host, nil
+		}
+	}
+	if network == "" {
+		return BroadcastHostConfig{}, errors.New("No broadcast host is configured.")
+	}
+	return BroadcastHostConfig{}, errors.New("No broadcast host is configured for network " + network + ".")
+}
+
+// The transfer that funds the wallet at address.
+func fundingTransfers(policy WalletFundingPolicy, address types.AccAddress) []msg.Transfer {
+	return []msg.Transfer{{
+		ToAddr: address,
+		Coins:  types.Coins{types.Coin{Denom: types_old.NativeSymbol, Amount: policy.Amount}},
+	}}
+}
+
+// Sends the configured amount from the funding wallet to the wallet
+// and broadcasts the transfer in sync mode. The transfer is signed
+// like one of /v1/token/send: it counts towards the spending limits
+// of the funding wallet, takes its sequence from the reservations and
+// is recorded in the audit chain and reported to the webhook.
+func fundWallet(r *http.Request, cfg *DexVaultConfiguration, datastore *DexVaultDatastore, wallet *Wallet) (*BroadcastResponse, error) {
+	policy := cfg.WalletFunding
+	funder := datastore.GetWallet(policy.Wallet)
+	if funder == nil {
+		return nil, errors.New("Funding wallet not found: " + policy.Wallet)
+	}
+	if funder.Frozen {
+		err := errWalletFrozen(funder)
+		auditDenied(r, funder.Name, PermissionSendToken, err)
+		return nil, err
+	}
+	network := wallet.Network
+	if network == "" {
+		network = funder.Network
+	}
+	host, err := fundingHost(cfg, network)
+	if err != nil {
+		return nil, err
+	}
+	err = checkWalletNetwork(datastore, funder.Name, host.Network)
+	if err != nil {
+		return nil, err
+	}
+	chainId, ok := chainInfo.ChainId(host.Host)
+	if !ok {
+		return nil, errors.New("Chain ID of " + host.Host + " is not known yet.")
+	}
+
+	funderKeyManager, err := funder.GetKeyManager()
+	if err != nil {
+		return nil, err
+	}
+	keyManager, err := wallet.GetKeyManager()
+	if err != nil {
+		return nil, err
+	}
+	transfers := fundingTransfers(policy, keyManager.GetAddr())
+	if e := checkSpendingLimit(r, cfg, datastore, funder.Name, transfers); e != nil {
+		return nil, e
+	}
+	account, err := reserveRequestSequence(r, funder, host.Host, host.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	send := &SendToken{
+		SignedMessage: SignedMessage{
+			BasicMessage:  BasicMessage{Wallet: funder.Name},
+			ChainId:       chainId,
+			AccountNumber: account.AccountNumber,
+			Sequence:      account.Sequence,
+		},
+		Transfers: transfers,
+	}
+	hexTx, err := createSignedSendTokenMsg(funderKeyManager, send)
+	if err != nil {
+		return nil, err
+	}
+	err = recordSigning(r, funder.Name, PermissionSendToken, hexTx)
+	if err != nil {
+		return nil, err
+	}
+	options := BroadcastOptions{
+		Mode:    BroadcastModeSync,
+		Timeout: time.Duration(cfg.ConfirmationTimeout) * time.Second,
+	}
+	result, err := broadcastMessage(host.Host, host.Network, hexTx, options)
+	if err == nil && (len(result.Results) == 0 || !result.Results[0].Ok) {
+		err = fmt.Errorf("Funding transfer from %s was rejected.", funder.Name)
+	}
+	signingEvent(r, funder.Name, PermissionSendToken, hexTx, host.Host, broadcastOutcome(err), err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
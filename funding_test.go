@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+const testFundingHost = "funding.test"
+
+func fundingTest(t *testing.T, limit int64) (*DexVaultConfiguration, *DexVaultDatastore, *Wallet) {
+	cfg := &DexVaultConfiguration{
+		BroadcastHosts: []BroadcastHostConfig{{Host: testFundingHost, Network: 0}},
+		WalletFunding:  WalletFundingPolicy{Wallet: "funder", Amount: 1000},
+		SpendingLimits: SpendingLimits{"funder": {"BNB": limit}},
+	}
+	datastore := &DexVaultDatastore{Secret: "test secret"}
+	_, err := datastore.ImportWallet("funder", testMnemonic, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, err := datastore.ImportPrivateKey("new", testPrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainInfo.Lock()
+	chainInfo.nodes[testFundingHost] = &NodeInfo{Host: testFundingHost, ChainId: "Binance-Chain-Test", Ready: true}
+	chainInfo.Unlock()
+	return cfg, datastore, wallet
+}
+
+func TestFundingCountsTowardsSpendingLimit(t *testing.T) {
+	cfg, datastore, wallet := fundingTest(t, 999)
+	events, restore := recordAudit()
+	defer restore()
+	r := testRequest("POST", "/v1/wallet/create", "alice", struct{}{}, datastore, cfg)
+
+	_, err := fundWallet(r, cfg, datastore, wallet)
+	if _, ok := err.(*LimitExceededError); !ok {
+		t.Fatalf("funding above the limit returned %v, want a LimitExceededError", err)
+	}
+	if len(datastore.Spending) != 0 {
+		t.Errorf("rejected funding recorded %d spendings", len(datastore.Spending))
+	}
+	if len(events.events) != 0 {
+		t.Errorf("rejected funding was audited as a signing: %v", events.events[0].Event)
+	}
+}
+
+func TestFundingIsSignedLikeATransfer(t *testing.T) {
+	cfg, datastore, wallet := fundingTest(t, 5000)
+	client := &testDexClient{}
+	useTestClient(testFundingHost, 0, client)
+	funder := datastore.GetWallet("funder")
+	sequenceCache.Set(sequenceCacheKey(testFundingHost, funder.Name), AccountSequence{AccountNumber: 1, Sequence: 3})
+	events, restore := recordAudit()
+	defer restore()
+	r := testRequest("POST", "/v1/wallet/create", "alice", struct{}{}, datastore, cfg)
+
+	result, err := fundWallet(r, cfg, datastore, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Posted) != 1 || result.Results[0].Hash != txHash(client.Posted[0]) {
+		t.Fatalf("posted %d transactions, result %v", len(client.Posted), result.Results)
+	}
+	if len(datastore.Spending) != 1 || datastore.Spending[0].Wallet != "funder" || datastore.Spending[0].Amount != 1000 {
+		t.Errorf("spending not recorded for the funding wallet: %v", datastore.Spending)
+	}
+	if len(events.events) != 1 || events.events[0].Wallet != "funder" || events.events[0].Result != string(SigningOutcomeBroadcast) {
+		t.Fatalf("audit events %v, want the broadcast of the funding wallet", events.events)
+	}
+	if events.events[0].TxHash != result.Results[0].Hash {
+		t.Errorf("audited hash %s, want %s", events.events[0].TxHash, result.Results[0].Hash)
+	}
+}
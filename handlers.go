@@ -6,13 +6,15 @@ import (
 	"github.com/go-chi/jwtauth"
 	"github.com/go-chi/render"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"encoding/json"
 	"errors"
-	sdk "github.com/binance-chain/go-sdk/client"
 	"github.com/binance-chain/go-sdk/keys"
-	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
 	"github.com/binance-chain/go-sdk/types/tx"
+	"time"
 )
 
 // Error responses
@@ -21,23 +23,126 @@ type Response struct {
 	Response string
 }
 
+// Discriminators for the structured success envelope.
+type ResponseType string
+
+const ResponseTypeHex ResponseType = "hex"
+const ResponseTypeBroadcast ResponseType = "broadcast"
+const ResponseTypeAddress ResponseType = "address"
+const ResponseTypeAddresses ResponseType = "addresses"
+const ResponseTypeWallet ResponseType = "wallet"
+const ResponseTypeWallets ResponseType = "wallets"
+const ResponseTypeWalletDeleted ResponseType = "wallet_deleted"
+const ResponseTypeWalletRenamed ResponseType = "wallet_renamed"
+const ResponseTypeWalletFrozen ResponseType = "wallet_frozen"
+const ResponseTypeAuditLog ResponseType = "audit_log"
+const ResponseTypeOpenOrders ResponseType = "open_orders"
+const ResponseTypeKeystore ResponseType = "keystore"
+const ResponseTypePending ResponseType = "pending"
+const ResponseTypePendingList ResponseType = "pending_list"
+const ResponseTypeBackup ResponseType = "backup"
+const ResponseTypeRestore ResponseType = "restore"
+const ResponseTypeAddressValidation ResponseType = "address_validation"
+const ResponseTypeNodeInfo ResponseType = "node_info"
+const ResponseTypeSignableWallets ResponseType = "signable_wallets"
+const ResponseTypeReplaceOrder ResponseType = "replace_order"
+const ResponseTypeSigned ResponseType = "signed"
+const ResponseTypeTickers ResponseType = "tickers"
+const ResponseTypeKlines ResponseType = "klines"
+const ResponseTypeCapabilities ResponseType = "capabilities"
+const ResponseTypeScheduledOrder ResponseType = "scheduled_order"
+const ResponseTypeScheduledOrders ResponseType = "scheduled_orders"
+const ResponseTypeBroadcastJob ResponseType = "broadcast_job"
+const ResponseTypeTokenInfo ResponseType = "token_info"
+const ResponseTypeTokenURI ResponseType = "token_uri"
+const ResponseTypeFees ResponseType = "fees"
+const ResponseTypeBatch ResponseType = "batch"
+const ResponseTypeConfig ResponseType = "config"
+const ResponseTypePresigned ResponseType = "presigned"
+const ResponseTypeHTLT ResponseType = "htlt"
+const ResponseTypeBalance ResponseType = "balance"
+const ResponseTypeBalances ResponseType = "balances"
+const ResponseTypeTxDecode ResponseType = "tx_decode"
+const ResponseTypeSequence ResponseType = "sequence"
+const ResponseTypeMempool ResponseType = "mempool"
+const ResponseTypeWhoami ResponseType = "whoami"
+const ResponseTypePermittedBatch ResponseType = "permitted_batch"
+const ResponseTypeTxStatus ResponseType = "tx_status"
+const ResponseTypeIssuedTokens ResponseType = "issued_tokens"
+
+// Structured success envelope. The type field tells clients how
+// to interpret data.
+type TypedResponse struct {
+	Type ResponseType `json:"type"`
+	Data interface{}  `json:"data"`
+}
+
 type WalletResponse struct {
-	Name    string
-	Address string
+	Name           string
+	Address        string
+	ValoperAddress string
+}
+
+type CreateWalletResponse struct {
+	Name           string
+	Address        string
+	ValoperAddress string
+	Network        string `json:",omitempty"`
+	Warning        string `json:",omitempty"`
+	// Set if an idempotent request found the wallet
+	Existing bool `json:",omitempty"`
+	// Hash of the funding transfer, or why it failed
+	FundingTx    string `json:",omitempty"`
+	FundingError string `json:",omitempty"`
 }
 
 type WalletsResponse struct {
 	Wallets []WalletResponse
 }
 
+type SignableWalletResponse struct {
+	Name    string
+	Address string
+	Actions []Permission
+}
+
+type SignableWalletsResponse struct {
+	Wallets []SignableWalletResponse
+}
+
 type BroadcastResult struct {
 	Ok   bool
 	Hash string
 	Data string
+	// Block the transaction was included in, only set when waiting
+	// for confirmations.
+	Height int64 `json:",omitempty"`
 }
 
 type BroadcastResponse struct {
 	Results []BroadcastResult
+	// Host that accepted the transaction
+	Host string `json:",omitempty"`
+}
+
+// Signing response carrying optional details, returned instead of a
+// plain hex or broadcast response when details were requested.
+type SignedTxResponse struct {
+	Tx        string
+	Broadcast *BroadcastResponse `json:",omitempty"`
+	Audit     *SignAudit         `json:",omitempty"`
+	Timing    *SigningTimings    `json:",omitempty"`
+	// Hash of the messages without sequence and signature
+	Fingerprint string `json:",omitempty"`
+	// Set if the request was a dry run, which is never broadcast
+	DryRun bool `json:",omitempty"`
+	// Summary of the signed messages
+	Summary *TxSummary `json:",omitempty"`
+	// Of HTLTs, the cached height of the chain and the height from
+	// which the HTLT can be refunded, estimated from it. Omitted if no
+	// height is known yet.
+	Height       int64 `json:",omitempty"`
+	ExpireHeight int64 `json:",omitempty"`
 }
 
 func BroadcastResultFromTxCommitResult(result tx.TxCommitResult) BroadcastResult {
@@ -60,13 +165,21 @@ func BroadcastResponseFromTxCommitResults(results []tx.TxCommitResult) Broadcast
 type ErrResponse struct {
 	Err            error `json:"-"` // low-level runtime error
 	HTTPStatusCode int   `json:"-"` // http response status code
+	RetryAfter     int   `json:"-"` // seconds, sent as Retry-After header
+
+	StatusText string    `json:"status"`          // user-level status message
+	AppCode    ErrorCode `json:"code,omitempty"`  // application-specific error code
+	ErrorText  string    `json:"error,omitempty"` // application-level error message, for debugging
 
-	StatusText string `json:"status"`          // user-level status message
-	AppCode    int64  `json:"code,omitempty"`  // application-specific error code
-	ErrorText  string `json:"error,omitempty"` // application-level error message, for debugging
+	Remaining map[string]int64 `json:"remaining,omitempty"` // allowance left, see limits.go
 }
 
+// Only sets the headers and status. render.Render calls this before it
+// responds with the struct, so the JSON body is written by render.
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(e.RetryAfter))
+	}
 	render.Status(r, e.HTTPStatusCode)
 	return nil
 }
@@ -76,15 +189,79 @@ func ErrPermissionDenied() render.Renderer {
 		Err:            nil,
 		HTTPStatusCode: 403,
 		StatusText:     "Permission denied.",
+		AppCode:        ErrorCodePermissionDenied,
+		ErrorText:      "",
+	}
+}
+
+// The token is missing or invalid, or the IP is not whitelisted.
+func ErrUnauthorized() render.Renderer {
+	return &ErrResponse{
+		Err:            nil,
+		HTTPStatusCode: 401,
+		StatusText:     "Unauthorized.",
+		AppCode:        ErrorCodeUnauthorized,
 		ErrorText:      "",
 	}
 }
 
+// The token is signed correctly, but expired or not valid yet. Clients
+// should sign a new token.
+func ErrTokenExpired(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 401,
+		StatusText:     "Token expired.",
+		AppCode:        ErrorCodeTokenExpired,
+		ErrorText:      err.Error(),
+	}
+}
+
+// The request is valid, but violates a policy of this deployment.
+func ErrPolicyViolation(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 403,
+		StatusText:     "Policy violation.",
+		AppCode:        ErrorCodePolicyViolation,
+		ErrorText:      err.Error(),
+	}
+}
+
+// An error that should be rendered with a specific status instead
+// of a plain invalid request.
+type RequestError struct {
+	HTTPStatusCode int
+	StatusText     string
+	RetryAfter     int
+	AppCode        ErrorCode
+	Err            error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
 func ErrInvalidRequest(err error) render.Renderer {
+	if re, ok := err.(*RequestError); ok {
+		code := re.AppCode
+		if code == "" {
+			code = ErrorCodeInvalidPayload
+		}
+		return &ErrResponse{
+			Err:            re.Err,
+			HTTPStatusCode: re.HTTPStatusCode,
+			RetryAfter:     re.RetryAfter,
+			StatusText:     re.StatusText,
+			AppCode:        code,
+			ErrorText:      re.Err.Error(),
+		}
+	}
 	return &ErrResponse{
 		Err:            err,
 		HTTPStatusCode: 400,
 		StatusText:     "Invalid request.",
+		AppCode:        ErrorCodeInvalidPayload,
 		ErrorText:      err.Error(),
 	}
 }
@@ -95,6 +272,27 @@ func WriteResponse(w http.ResponseWriter, r *http.Request, result string) {
 	WriteJSONResponse(w, r, Response{Response: result})
 }
 
+// Writes a successful result. Unless legacy responses are enabled
+// in the configuration, the result is wrapped in a TypedResponse.
+// The fields query parameter selects fields of the result.
+func WriteTypedResponse(w http.ResponseWriter, r *http.Request, t ResponseType, result interface{}) {
+	result, err := projectFields(r, result)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	cfg := GetRequestConfig(r)
+	if cfg.LegacyResponses {
+		if s, ok := result.(string); ok {
+			WriteResponse(w, r, s)
+		} else {
+			WriteJSONResponse(w, r, result)
+		}
+		return
+	}
+	WriteJSONResponse(w, r, TypedResponse{Type: t, Data: result})
+}
+
 func WriteJSONResponse(w http.ResponseWriter, r *http.Request, result interface{}) {
 	j, err := json.Marshal(result)
 	if err != nil {
@@ -111,7 +309,11 @@ func decodeSignedMessage(r *http.Request, payload interface{}) error {
 		return errors.New("Failed to get JWT claims.")
 	}
 
-	err = json.Unmarshal([]byte(claims["payload"].(string)), payload)
+	j, err := normalizeNetworkNames(claims["payload"].(string))
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal([]byte(j), payload)
 	if err != nil {
 		return err
 	}
@@ -126,7 +328,11 @@ func decodePayload(r *http.Request, payload interface{}) error {
 		return errors.New("Failed to get JWT claims.")
 	}
 
-	err = json.Unmarshal([]byte(claims["payload"].(string)), payload)
+	j, err := normalizeNetworkNames(claims["payload"].(string))
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal([]byte(j), payload)
 	if err != nil {
 		return err
 	}
@@ -134,7 +340,52 @@ func decodePayload(r *http.Request, payload interface{}) error {
 	return nil
 }
 
+// Replaces the names "testnet" and "mainnet" of BroadcastNetwork and
+// QueryNetwork with their numbers, so payloads may use either.
+func normalizeNetworkNames(payload string) (string, error) {
+	if !strings.Contains(payload, "Network") {
+		return payload, nil
+	}
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal([]byte(payload), &fields) != nil {
+		// Malformed payloads fail when they are decoded.
+		return payload, nil
+	}
+	changed := false
+	for _, key := range []string{"BroadcastNetwork", "QueryNetwork"} {
+		var name string
+		raw, ok := fields[key]
+		if !ok || json.Unmarshal(raw, &name) != nil {
+			continue
+		}
+		network, ok := networkForName(name)
+		if !ok {
+			return "", errors.New("Unknown " + key + " " + strconv.Quote(name) + ", use testnet or mainnet.")
+		}
+		fields[key] = json.RawMessage(strconv.Itoa(network))
+		changed = true
+	}
+	if !changed {
+		return payload, nil
+	}
+	j, err := json.Marshal(fields)
+	return string(j), err
+}
+
+var errGenericDenial = errors.New("Request denied.")
+
+// Replaces the specific reason for a denied request with a uniform
+// error, unless detailed denials are configured.
+func denialError(r *http.Request, err error) error {
+	if GetRequestConfig(r).DenialDetail == DenialDetailGeneric {
+		return codedError(ErrorCodePermissionDenied, errGenericDenial)
+	}
+	return err
+}
+
 func decodeRequest(r *http.Request, payload interface{}, action Permission) (*DexVaultDatastore, string, keys.KeyManager, error) {
+	timings := GetRequestTimings(r)
+	start := time.Now()
 	err := decodePayload(r, payload)
 	if err != nil {
 		return nil, "", nil, err
@@ -150,28 +401,92 @@ func decodeRequest(r *http.Request, payload interface{}, action Permission) (*De
 		return nil, "", nil, errors.New("No user could be found.")
 	}
 
-	basicMessage := &BasicMessage{}
+	basicMessage := &SignedMessage{}
 	err = decodeSignedMessage(r, basicMessage)
 	if err != nil {
 		return nil, "", nil, errors.New("Failed to decode signed message")
 	}
+	if timings != nil {
+		timings.Decode = milliseconds(time.Since(start))
+	}
 
-	// Also check permissions
-	if !datastore.IsPermitted(user, basicMessage.Wallet, action) {
-		return nil, "", nil, errors.New("Not permitted.")
+	if basicMessage.FeePayer != "" {
+		return nil, "", nil, errors.New("Fee delegation is not supported by Binance Chain, the signing wallet always pays the fee.")
+	}
+	err = validateNetwork(basicMessage.BroadcastNetwork)
+	if err != nil {
+		return nil, "", nil, errors.New("Invalid BroadcastNetwork: " + err.Error())
+	}
+	if len(basicMessage.BroadcastHosts) > 0 && basicMessage.BroadcastHost == "" {
+		return nil, "", nil, errors.New("BroadcastHosts are only tried after BroadcastHost, which must be set.")
+	}
+	if basicMessage.DryRun {
+		if basicMessage.AutoSequence {
+			return nil, "", nil, errors.New("DryRun can not be combined with AutoSequence, which reserves the sequence.")
+		}
+		// Handlers broadcast whenever a BroadcastHost is set, so a
+		// dry run clears the hosts of the payload.
+		err = json.Unmarshal([]byte(`{"BroadcastHost": "", "BroadcastHosts": null}`), payload)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		basicMessage.BroadcastHost = ""
+		basicMessage.BroadcastHosts = nil
 	}
 
 	wallet := datastore.GetWallet(basicMessage.Wallet)
 	if wallet == nil {
-		return nil, "", nil, errors.New("No matching wallet could be found.")
+		err = errors.New("No matching wallet could be found.")
+		auditDenied(r, basicMessage.Wallet, action, err)
+		return nil, "", nil, denialError(r, codedError(ErrorCodeWalletNotFound, err))
+	}
+
+	logRequestAction(r, basicMessage.Wallet, action)
+
+	// Also check permissions
+	if !datastore.IsPermitted(user, basicMessage.Wallet, action) {
+		err = errors.New("Not permitted.")
+		auditDenied(r, basicMessage.Wallet, action, err)
+		return nil, "", nil, denialError(r, codedError(ErrorCodePermissionDenied, err))
+	}
+
+	if action != PermissionRead {
+		if wallet.Frozen {
+			err = errWalletFrozen(wallet)
+			auditDenied(r, basicMessage.Wallet, action, err)
+			return nil, "", nil, err
+		}
+		err = checkNonceRequired(r)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		err = checkCooldown(GetRequestConfig(r), datastore, basicMessage.Wallet)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if basicMessage.AutoSequence {
+			err = applyAutoSequence(r, wallet, basicMessage, payload)
+			if err != nil {
+				return nil, "", nil, err
+			}
+		} else if basicMessage.AutoAccountNumber {
+			err = applyAutoAccountNumber(r, wallet, basicMessage, payload)
+			if err != nil {
+				return nil, "", nil, err
+			}
+		}
 	}
 
+	start = time.Now()
 	keyManager, err := wallet.GetKeyManager()
 	if err != nil {
 		return nil, "", nil, err
 	}
+	if timings != nil {
+		timings.KeyManager = milliseconds(time.Since(start))
+	}
 
-	return datastore, user, keyManager, nil
+	return datastore, user, timedKeys(r, keyManager), nil
 }
 
 // Handlers
@@ -195,26 +510,152 @@ func decodeRequestBasic(r *http.Request, payload interface{}) (*DexVaultDatastor
 	return datastore, user, nil
 }
 
-func broadcastMessage(keyManager keys.KeyManager, host string, network int, tx []byte) (*BroadcastResponse, error) {
-	client, err := sdk.NewDexClient("testnet-dex.binance.org", types.ChainNetwork(network), keyManager)
-	if err != nil {
-		return nil, err
+// Renders a permission denied error unless the user is an admin.
+func requireAdmin(w http.ResponseWriter, r *http.Request) (*DexVaultDatastore, string, bool) {
+	datastore := GetRequestDatastore(r)
+	user := GetRequestUser(r)
+	u := datastore.GetUser(user)
+	if u == nil || !u.HasPermission(PermissionAdmin) {
+		render.Render(w, r, ErrPermissionDenied())
+		return nil, "", false
 	}
+	return datastore, user, true
+}
 
-	param := map[string]string{}
-	param["sync"] = "true"
-	commits, err := client.PostTx([]byte(tx), param)
+// Broadcasts the signed transaction if a BroadcastHost was supplied
+// and writes the result, otherwise returns the hex transaction.
+//
+// With ?audit=true the response also contains the sign-bytes,
+// signature and public key of the transaction, with ?timing=true the
+// time spent in each phase, with ?fingerprint=true a fingerprint of
+// the messages and with ?decode=true a summary of them.
+func writeSignedResponse(w http.ResponseWriter, r *http.Request, keyManager keys.KeyManager, action Permission, sm *SignedMessage, hexTx []byte) {
+	writeSignedDetails(w, r, keyManager, action, sm, hexTx, ResponseTypeSigned, nil)
+}
 
+// Like writeSignedResponse, but always writes the details prepared by
+// the handler, with the given response type.
+func writeSignedDetails(w http.ResponseWriter, r *http.Request, keyManager keys.KeyManager, action Permission, sm *SignedMessage, hexTx []byte, responseType ResponseType, details *SignedTxResponse) {
+	auditLog(r, "Signed "+string(action)+" with wallet "+sm.Wallet)
+	logRequestTx(r, txHash(hexTx))
+	err := recordSigning(r, sm.Wallet, action, hexTx)
 	if err != nil {
-		return nil, err
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if r.URL.Query().Get("audit") == "true" {
+		audit, err := signAuditFromTx(sm.ChainId, hexTx)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if details == nil {
+			details = &SignedTxResponse{Tx: string(hexTx)}
+		}
+		details.Audit = audit
+	}
+	if GetRequestTimings(r) != nil && details == nil {
+		details = &SignedTxResponse{Tx: string(hexTx)}
+	}
+	if sm.DryRun {
+		if details == nil {
+			details = &SignedTxResponse{Tx: string(hexTx)}
+		}
+		details.DryRun = true
+	}
+	if r.URL.Query().Get("decode") == "true" {
+		summary, err := decodeSignedTx(hexTx)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if details == nil {
+			details = &SignedTxResponse{Tx: string(hexTx)}
+		}
+		details.Summary = &summary
+	}
+	if r.URL.Query().Get("fingerprint") == "true" {
+		fingerprint, err := txFingerprint(hexTx)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if details == nil {
+			details = &SignedTxResponse{Tx: string(hexTx)}
+		}
+		details.Fingerprint = fingerprint
 	}
 
-	response := BroadcastResponseFromTxCommitResults(commits)
-	return &response, err
+	if sm.BroadcastHost != "" {
+		err := checkWalletNetwork(GetRequestDatastore(r), sm.Wallet, sm.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeNetworkMismatch, err)))
+			return
+		}
+		options, err := resolveBroadcastOptions(GetRequestConfig(r), action, sm)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if options.Mode == BroadcastModeQueued {
+			job := &BroadcastJob{
+				Wallet:    sm.Wallet,
+				Initiator: GetRequestUser(r),
+				host:      sm.BroadcastHost,
+				network:   sm.BroadcastNetwork,
+				tx:        hexTx,
+				options:   BroadcastOptions{Mode: BroadcastModeSync, FallbackHosts: options.FallbackHosts},
+			}
+			err = broadcastJobs.Enqueue(job)
+			if err != nil {
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+			auditLog(r, "Queued broadcast job "+job.Id+" to "+sm.BroadcastHost)
+			signingEvent(r, sm.Wallet, action, hexTx, sm.BroadcastHost, SigningOutcomeQueued, nil)
+			queued, _ := broadcastJobs.Get(job.Id)
+			w.WriteHeader(http.StatusAccepted)
+			WriteTypedResponse(w, r, ResponseTypeBroadcastJob, queued)
+			return
+		}
+		start := time.Now()
+		br, err := broadcastMessage(sm.BroadcastHost, sm.BroadcastNetwork, hexTx, options)
+		if timings := GetRequestTimings(r); timings != nil {
+			timings.Broadcast = milliseconds(time.Since(start))
+		}
+		if err != nil {
+			auditLog(r, "Broadcast to "+sm.BroadcastHost+" failed: "+err.Error())
+			signingEvent(r, sm.Wallet, action, hexTx, sm.BroadcastHost, SigningOutcomeBroadcastFailed, err)
+			render.Render(w, r, ErrInvalidRequest(broadcastError(err)))
+			return
+		}
+		auditBroadcast(r, sm.BroadcastHost, br)
+		signingEvent(r, sm.Wallet, action, hexTx, br.Host, SigningOutcomeBroadcast, nil)
+		if details != nil {
+			details.Broadcast = br
+		} else {
+			WriteTypedResponse(w, r, ResponseTypeBroadcast, br)
+			return
+		}
+	} else {
+		if sm.DryRun {
+			// The transaction is not meant to be broadcast, so it does
+			// not count towards the spending limits.
+			releaseReservations(r)
+		}
+		signingEvent(r, sm.Wallet, action, hexTx, "", SigningOutcomeSigned, nil)
+	}
+
+	if details != nil {
+		details.Timing = finishTimings(r)
+		WriteTypedResponse(w, r, responseType, details)
+	} else {
+		WriteTypedResponse(w, r, ResponseTypeHex, string(hexTx))
+	}
 }
 
 func createWalletHandler(w http.ResponseWriter, r *http.Request) {
-	data := &BasicMessage{}
+	data := &CreateWalletMessage{}
 	datastore, user, err := decodeRequestBasic(r, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
@@ -227,38 +668,301 @@ func createWalletHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wallet, err := datastore.CreateWallet(data.Wallet)
+	if data.Network != "" && !isNetworkName(data.Network) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Unknown network: "+data.Network)))
+		return
+	}
+	cfg := GetRequestConfig(r)
+
+	// Retries of an idempotent request return the wallet created by
+	// the first attempt, if the user can see it.
+	existing := datastore.GetWallet(data.Wallet)
+	if data.Idempotent && existing != nil {
+		if !datastore.IsPermitted(user, existing.Name, PermissionRead) {
+			render.Render(w, r, ErrInvalidRequest(errWalletExists))
+			return
+		}
+		if existing.Network != data.Network {
+			render.Render(w, r, ErrInvalidRequest(errors.New("Wallet with name already exists for a different network.")))
+			return
+		}
+		data.Fund = false
+	} else {
+		existing = nil
+	}
+
+	if data.Fund {
+		if !cfg.WalletFunding.Enabled() {
+			render.Render(w, r, ErrInvalidRequest(errors.New("Wallet funding is not configured.")))
+			return
+		}
+		if !datastore.IsPermitted(user, cfg.WalletFunding.Wallet, PermissionSendToken) {
+			render.Render(w, r, ErrPermissionDenied())
+			return
+		}
+		// The funding transfer is signed right away, it can not wait
+		// for approvals.
+		if transferApprovals(cfg, PermissionSendToken, fundingTransfers(cfg.WalletFunding, nil)) > 0 {
+			render.Render(w, r, ErrInvalidRequest(errors.New("Funding transfers require approvals, send the funds with /v1/token/send instead.")))
+			return
+		}
+		err = checkCooldown(cfg, datastore, cfg.WalletFunding.Wallet)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+
+	wallet := existing
+	if wallet == nil {
+		wallet, err = datastore.CreateWallet(data.Wallet, data.Network)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+
+	// The wallet is kept if funding fails, the error is reported in
+	// the response instead.
+	var funding *BroadcastResponse
+	var fundingErr error
+	if data.Fund {
+		funding, fundingErr = fundWallet(r, cfg, datastore, wallet)
+		if fundingErr != nil {
+			auditLog(r, "Funding wallet "+wallet.Name+" failed: "+fundingErr.Error())
+		} else {
+			auditLog(r, "Funded wallet "+wallet.Name+" from "+cfg.WalletFunding.Wallet+": "+funding.Results[0].Hash)
+		}
+	}
+
+	addresses, err := wallet.GetAddresses()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if cfg.LegacyResponses {
+		WriteResponse(w, r, addresses.Address)
+		return
+	}
+	cr := CreateWalletResponse{
+		Name:           wallet.Name,
+		Address:        addresses.Address,
+		ValoperAddress: addresses.ValoperAddress,
+		Network:        wallet.Network,
+		Existing:       existing != nil,
+	}
+	if funding != nil {
+		cr.FundingTx = funding.Results[0].Hash
+	}
+	if fundingErr != nil {
+		cr.FundingError = fundingErr.Error()
+	}
+	if wallet.Network == "" {
+		cr.Warning = "Wallet is not tagged with a network. Setting a Network is strongly recommended to prevent broadcasting to the wrong chain."
+	}
+	WriteTypedResponse(w, r, ResponseTypeWallet, cr)
+}
+
+// Imports a wallet from a mnemonic or a private key, e.g. when
+// migrating existing wallets. The key is never logged or returned.
+func importWalletHandler(w http.ResponseWriter, r *http.Request) {
+	data := &ImportWalletMessage{}
+	datastore, user, err := decodeRequestBasic(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	u := datastore.GetUser(user)
+	if !u.HasPermission(PermissionImportWallet) {
+		render.Render(w, r, ErrPermissionDenied())
+		return
+	}
+	if data.Wallet == "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("No wallet name supplied.")))
+		return
+	}
+	if (data.Mnemonic == "") == (data.PrivateKey == "") {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Either a Mnemonic or a PrivateKey must be supplied.")))
+		return
+	}
+	if data.PrivateKey != "" && data.KeyPath != "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("KeyPath only applies to a Mnemonic.")))
+		return
+	}
+	if data.Network != "" && !isNetworkName(data.Network) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Unknown network: "+data.Network)))
+		return
+	}
+
+	var wallet *Wallet
+	if data.PrivateKey != "" {
+		wallet, err = datastore.ImportPrivateKey(data.Wallet, data.PrivateKey, data.Network)
+	} else {
+		wallet, err = datastore.ImportWallet(data.Wallet, data.Mnemonic, data.KeyPath, data.Network)
+	}
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	addresses, err := wallet.GetAddresses()
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	auditLog(r, "Imported wallet "+wallet.Name+" ("+addresses.Address+")")
 
-	address, err := wallet.GetAddress()
+	cr := CreateWalletResponse{
+		Name:           wallet.Name,
+		Address:        addresses.Address,
+		ValoperAddress: addresses.ValoperAddress,
+		Network:        wallet.Network,
+	}
+	if wallet.Network == "" {
+		cr.Warning = "Wallet is not tagged with a network. Setting a Network is strongly recommended to prevent broadcasting to the wrong chain."
+	}
+	WriteTypedResponse(w, r, ResponseTypeWallet, cr)
+}
+
+// Minimum length of keystore passwords
+const MinKeystorePasswordLength = 8
+
+// Exports a wallet as keystore encrypted with the password of the
+// request, e.g. for disaster recovery. PermissionExportWallet must be
+// granted explicitly, PermissionAll does not include it. Requires
+// approval like signing, if configured.
+func exportWalletHandler(w http.ResponseWriter, r *http.Request) {
+	data := &ExportWalletMessage{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionExportWallet)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if len(data.Password) < MinKeystorePasswordLength {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Password must be at least "+strconv.Itoa(MinKeystorePasswordLength)+" characters.")))
+		return
+	}
+	if requireApproval(w, r, PermissionExportWallet) {
+		return
+	}
 
-	WriteResponse(w, r, *address)
+	keystore, err := keyManager.ExportAsKeyStore(data.Password)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	auditLog(r, "Exported wallet "+data.Wallet+" ("+keyManager.GetAddr().String()+") as keystore")
+	WriteTypedResponse(w, r, ResponseTypeKeystore, keystore)
+}
+
+type DeleteWalletResponse struct {
+	Name    string
+	Address string
+}
+
+// Deletes a wallet and its key. Requires approval like signing, if
+// configured for PermissionDeleteWallet.
+func deleteWalletHandler(w http.ResponseWriter, r *http.Request) {
+	data := &DeleteWalletMessage{}
+	datastore, _, keyManager, err := decodeRequest(r, data, PermissionDeleteWallet)
+	if re, ok := err.(*RequestError); ok && re.AppCode == ErrorCodeWalletNotFound {
+		render.Render(w, r, ErrInvalidRequest(errWalletNotFound))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if data.Confirm != data.Wallet {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Confirm must repeat the name of the wallet, its key can not be recovered.")))
+		return
+	}
+	address := keyManager.GetAddr().String()
+	if requireApproval(w, r, PermissionDeleteWallet) {
+		return
+	}
+
+	// Another request may have deleted it in the meantime.
+	err = datastore.DeleteWallet(data.Wallet)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	invalidateSequence(data.Wallet)
+	deleteReservedSequences(data.Wallet)
+	accountNumbers.Delete(keyManager.GetAddr())
+	auditLog(r, "Deleted wallet "+data.Wallet+" ("+address+")")
+	WriteTypedResponse(w, r, ResponseTypeWalletDeleted, DeleteWalletResponse{Name: data.Wallet, Address: address})
+}
+
+type RenameWalletResponse struct {
+	OldName string
+	Name    string
+	// Unchanged, the key is kept
+	Address string
+}
+
+func renameWalletHandler(w http.ResponseWriter, r *http.Request) {
+	data := &RenameWalletMessage{}
+	datastore, _, keyManager, err := decodeRequest(r, data, PermissionRenameWallet)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if requireApproval(w, r, PermissionRenameWallet) {
+		return
+	}
+
+	err = datastore.RenameWallet(data.Wallet, data.NewName)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	invalidateSequence(data.Wallet)
+	deleteReservedSequences(data.Wallet)
+	address := keyManager.GetAddr().String()
+	auditLog(r, "Renamed wallet "+data.Wallet+" ("+address+") to "+data.NewName)
+	WriteTypedResponse(w, r, ResponseTypeWalletRenamed, RenameWalletResponse{OldName: data.Wallet, Name: data.NewName, Address: address})
 }
 
 func getAddressHandler(w http.ResponseWriter, r *http.Request) {
-	data := &Wallet{}
+	data := &AddressMessage{}
 	datastore, user, keyManager, err := decodeRequest(r, data, PermissionRead)
-	_ = datastore
 	_ = user
+	_ = keyManager
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	wallet := datastore.GetWallet(data.Wallet)
+	if data.Network != "" {
+		if !isNetworkName(data.Network) {
+			render.Render(w, r, ErrInvalidRequest(errors.New("Unknown network: "+data.Network)))
+			return
+		}
+		if wallet.Network != "" && wallet.Network != data.Network {
+			render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeNetworkMismatch, errors.New("Wallet is tagged for "+wallet.Network+"."))))
+			return
+		}
+		wallet.Network = data.Network
+	}
+	addresses, err := wallet.GetAddresses()
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
 
-	WriteResponse(w, r, keyManager.GetAddr().String())
+	if data.IncludeValoper {
+		WriteTypedResponse(w, r, ResponseTypeAddresses, *addresses)
+	} else {
+		WriteTypedResponse(w, r, ResponseTypeAddress, addresses.Address)
+	}
 }
 
 func getWalletHandler(w http.ResponseWriter, r *http.Request) {
-	data := &Wallet{}
+	data := &BasicMessage{}
 	datastore, user, keyManager, err := decodeRequest(r, data, PermissionRead)
-	_ = datastore
 	_ = user
 	_ = keyManager
 	if err != nil {
@@ -266,18 +970,19 @@ func getWalletHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wa, err := data.GetAddress()
+	wa, err := datastore.GetWallet(data.Wallet).GetAddresses()
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
 
 	wr := WalletResponse{
-		Name:    data.Name,
-		Address: *wa,
+		Name:           data.Wallet,
+		Address:        wa.Address,
+		ValoperAddress: wa.ValoperAddress,
 	}
 
-	WriteJSONResponse(w, r, wr)
+	WriteTypedResponse(w, r, ResponseTypeWallet, wr)
 }
 
 func getWalletsHandler(w http.ResponseWriter, r *http.Request) {
@@ -290,22 +995,57 @@ func getWalletsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	wrs := WalletsResponse{}
-	for _, wallet := range datastore.Wallets {
-		wa, err := wallet.GetAddress()
+	for _, wallet := range datastore.ListWallets() {
+		wa, err := wallet.GetAddresses()
 		if err != nil {
 			render.Render(w, r, ErrInvalidRequest(err))
 			return
 		}
 
 		wr := WalletResponse{
-			Name:    wallet.Name,
-			Address: *wa,
+			Name:           wallet.Name,
+			Address:        wa.Address,
+			ValoperAddress: wa.ValoperAddress,
 		}
 
 		wrs.Wallets = append(wrs.Wallets, wr)
 	}
 
-	WriteJSONResponse(w, r, wrs)
+	WriteTypedResponse(w, r, ResponseTypeWallets, wrs)
+}
+
+// Lists the wallets the user can sign for, together with the
+// signing actions permitted on each of them.
+func getSignableWalletsHandler(w http.ResponseWriter, r *http.Request) {
+	datastore := GetRequestDatastore(r)
+	user := GetRequestUser(r)
+
+	wrs := SignableWalletsResponse{Wallets: []SignableWalletResponse{}}
+	for _, wallet := range datastore.ListWallets() {
+		actions := []Permission{}
+		for _, action := range SigningPermissions {
+			if datastore.IsPermitted(user, wallet.Name, action) {
+				actions = append(actions, action)
+			}
+		}
+		if len(actions) == 0 {
+			continue
+		}
+
+		wa, err := wallet.GetAddress()
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+
+		wrs.Wallets = append(wrs.Wallets, SignableWalletResponse{
+			Name:    wallet.Name,
+			Address: *wa,
+			Actions: actions,
+		})
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeSignableWallets, wrs)
 }
 
 // These handlers are separate functions. This is done
@@ -321,23 +1061,49 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if !data.SkipNotionalCheck {
+		err = checkMinNotional(GetRequestConfig(r), data.QuoteAssetSymbol, data.Price, data.Quantity)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if !data.SkipPriceCheck {
+		err = checkPriceDeviation(w, r, &data.SignedMessage, data.CombinedSymbol(), data.Price)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if data.ClientOrderId != "" && datastore.GetClientOrder(data.Wallet, data.ClientOrderId) != nil {
+		render.Render(w, r, ErrInvalidRequest(errors.New("ClientOrderId is already in use: "+data.ClientOrderId)))
+		return
+	}
+	if requireApproval(w, r, PermissionCreateOrder) {
+		return
+	}
 
 	hexTx, err := createSignedCreateOrderMessage(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
+	if data.ClientOrderId != "" {
+		err = datastore.AddClientOrder(&ClientOrder{
+			ClientOrderId:    data.ClientOrderId,
+			Wallet:           data.Wallet,
+			OrderId:          msg.GenerateOrderID(data.Sequence+1, keyManager.GetAddr()),
+			BaseAssetSymbol:  data.BaseAssetSymbol,
+			QuoteAssetSymbol: data.QuoteAssetSymbol,
+			Created:          time.Now(),
+		})
 		if err != nil {
 			render.Render(w, r, ErrInvalidRequest(err))
 			return
 		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
 	}
+
+	writeSignedResponse(w, r, keyManager, PermissionCreateOrder, &data.SignedMessage, hexTx)
 }
 
 func cancelOrderHandler(w http.ResponseWriter, r *http.Request) {
@@ -349,22 +1115,44 @@ func cancelOrderHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if data.RefId == "" && data.ClientOrderId != "" {
+		o := datastore.GetClientOrder(data.Wallet, data.ClientOrderId)
+		if o == nil {
+			render.Render(w, r, ErrInvalidRequest(errClientOrderNotFound))
+			return
+		}
+		data.RefId = o.OrderId
+		data.BaseAssetSymbol = o.BaseAssetSymbol
+		data.QuoteAssetSymbol = o.QuoteAssetSymbol
+
+		if data.BroadcastHost != "" {
+			client, err := newQueryClient(data.BroadcastHost, data.BroadcastNetwork)
+			if err != nil {
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+			open, err := isOrderOpen(client, keyManager, data.CombinedSymbol(), data.RefId)
+			if err != nil {
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+			if !open {
+				datastore.RemoveClientOrder(data.Wallet, data.ClientOrderId)
+				render.Render(w, r, ErrInvalidRequest(errClientOrderNotFound))
+				return
+			}
+		}
+	}
+	if requireApproval(w, r, PermissionCancelOrder) {
+		return
+	}
 
 	hexTx, err := createSignedCancelOrderMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionCancelOrder, &data.SignedMessage, hexTx)
 }
 
 func tokenBurnHandler(w http.ResponseWriter, r *http.Request) {
@@ -376,22 +1164,16 @@ func tokenBurnHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if requireApproval(w, r, PermissionTokenBurn) {
+		return
+	}
 
 	hexTx, err := createSignedTokenBurnMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionTokenBurn, &data.SignedMessage, hexTx)
 }
 
 func depositHandler(w http.ResponseWriter, r *http.Request) {
@@ -403,22 +1185,16 @@ func depositHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if requireApproval(w, r, PermissionDeposit) {
+		return
+	}
 
 	hexTx, err := createSignedDepositMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionDeposit, &data.SignedMessage, hexTx)
 }
 
 func freezeTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -431,22 +1207,16 @@ func freezeTokenHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if requireApproval(w, r, PermissionFreezeToken) {
+		return
+	}
 
 	hexTx, err := createSignedFreezeTokenMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionFreezeToken, &data.SignedMessage, hexTx)
 }
 
 func issueTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -459,22 +1229,70 @@ func issueTokenHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if isMiniTokenSymbol(data.Symbol) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Symbol must not contain a suffix, it is assigned by the chain.")))
+		return
+	}
+	if data.MiniToken {
+		if !datastore.IsPermitted(user, data.Wallet, PermissionIssueMiniToken) {
+			render.Render(w, r, ErrInvalidRequest(denialError(r, codedError(ErrorCodePermissionDenied, errors.New("Not permitted.")))))
+			return
+		}
+		err = validateMiniTokenIssue(data.Name, data.Symbol, data.Supply, data.TokenURI)
+	} else if data.TokenURI != "" {
+		err = errors.New("TokenURI is only supported for mini-tokens.")
+	}
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = GetRequestConfig(r).TokenIssuancePolicy.Check(data.Supply)
+	if err != nil {
+		render.Render(w, r, ErrPolicyViolation(err))
+		return
+	}
+	if requireApproval(w, r, PermissionIssueToken) {
+		return
+	}
 
 	hexTx, err := createSignedIssueTokenMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
+	writeSignedResponse(w, r, keyManager, PermissionIssueToken, &data.SignedMessage, hexTx)
+}
+
+func issueMiniTokenHandler(w http.ResponseWriter, r *http.Request) {
+	data := &IssueMiniToken{}
+
+	datastore, user, keyManager, err := decodeRequest(r, data, PermissionIssueMiniToken)
+	_ = datastore
+	_ = user
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = validateMiniTokenIssue(data.Name, data.Symbol, data.Supply, data.TokenURI)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = GetRequestConfig(r).TokenIssuancePolicy.Check(data.Supply)
+	if err != nil {
+		render.Render(w, r, ErrPolicyViolation(err))
+		return
+	}
+	if requireApproval(w, r, PermissionIssueMiniToken) {
+		return
 	}
+
+	hexTx, err := createSignedIssueMiniTokenMsg(keyManager, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	writeSignedResponse(w, r, keyManager, PermissionIssueMiniToken, &data.SignedMessage, hexTx)
 }
 
 func listPairHandler(w http.ResponseWriter, r *http.Request) {
@@ -487,22 +1305,16 @@ func listPairHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if requireApproval(w, r, PermissionListPair) {
+		return
+	}
 
 	hexTx, err := createSignedListPairMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionListPair, &data.SignedMessage, hexTx)
 }
 
 func mintTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -515,22 +1327,16 @@ func mintTokenHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if requireApproval(w, r, PermissionMintToken) {
+		return
+	}
 
 	hexTx, err := createSignedMintTokenMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionMintToken, &data.SignedMessage, hexTx)
 }
 
 func sendTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -543,22 +1349,37 @@ func sendTokenHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-
-	hexTx, err := createSignedSendTokenMsg(keyManager, data)
+	err = applyDefaultMemo(datastore, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
+	if data.BroadcastHost != "" && !data.SkipMemoCheck && memoText(data.Memo) == "" {
+		client, err := newQueryClient(data.BroadcastHost, data.BroadcastNetwork)
 		if err != nil {
 			render.Render(w, r, ErrInvalidRequest(err))
 			return
 		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
+		err = checkMemoRequired(client, memoText(data.Memo), data.Transfers)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if requireApprovals(w, r, PermissionSendToken, transferApprovals(GetRequestConfig(r), PermissionSendToken, data.Transfers)) {
+		return
+	}
+	if e := checkSpendingLimit(r, GetRequestConfig(r), datastore, data.Wallet, data.Transfers); e != nil {
+		render.Render(w, r, ErrLimitExceeded(e))
+		return
+	}
+
+	hexTx, err := createSignedSendTokenMsg(keyManager, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
 	}
+	writeSignedResponse(w, r, keyManager, PermissionSendToken, &data.SignedMessage, hexTx)
 }
 
 func submitProposalHandler(w http.ResponseWriter, r *http.Request) {
@@ -571,22 +1392,16 @@ func submitProposalHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if requireApproval(w, r, PermissionSubmitProposal) {
+		return
+	}
 
 	hexTx, err := createSignedSubmitProposalMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionSubmitProposal, &data.SignedMessage, hexTx)
 }
 
 func unfreezeTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -599,22 +1414,16 @@ func unfreezeTokenHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if requireApproval(w, r, PermissionUnfreezeToken) {
+		return
+	}
 
 	hexTx, err := createUnfreezeTokenMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionUnfreezeToken, &data.SignedMessage, hexTx)
 }
 
 func voteProposalHandler(w http.ResponseWriter, r *http.Request) {
@@ -627,20 +1436,14 @@ func voteProposalHandler(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if requireApproval(w, r, PermissionVoteProposal) {
+		return
+	}
 
 	hexTx, err := createSignedVoteProposalMsg(keyManager, data)
 	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
-	if data.BroadcastHost != "" {
-		br, err := broadcastMessage(keyManager, data.BroadcastHost, data.BroadcastNetwork, hexTx)
-		if err != nil {
-			render.Render(w, r, ErrInvalidRequest(err))
-			return
-		}
-		WriteJSONResponse(w, r, br)
-	} else {
-		WriteResponse(w, r, string(hexTx))
-	}
+	writeSignedResponse(w, r, keyManager, PermissionVoteProposal, &data.SignedMessage, hexTx)
 }
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/go-chi/render"
+)
+
+func deleteWalletRequest(datastore *DexVaultDatastore, wallet string) *http.Request {
+	data := &DeleteWalletMessage{Confirm: wallet}
+	data.Wallet = wallet
+	return testRequest("POST", "/v1/wallet/delete", "alice", data, datastore, &DexVaultConfiguration{})
+}
+
+func TestDeleteWallet(t *testing.T) {
+	_, datastore := limitsTest(t, 0)
+	if w := serveSigning(deleteWalletHandler, deleteWalletRequest(datastore, "hot")); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if len(datastore.Wallets) != 0 {
+		t.Errorf("%d wallets left after deleting", len(datastore.Wallets))
+	}
+
+	get := &BasicMessage{Wallet: "hot"}
+	r := testRequest("POST", "/v1/wallet", "alice", get, datastore, &DexVaultConfiguration{})
+	if w := serveSigning(getWalletHandler, r); w.Code == http.StatusOK {
+		t.Errorf("deleted wallet returned with status %d", w.Code)
+	}
+}
+
+func TestDeleteUnknownWallet(t *testing.T) {
+	_, datastore := limitsTest(t, 0)
+	if w := serveSigning(deleteWalletHandler, deleteWalletRequest(datastore, "cold")); w.Code != http.StatusNotFound {
+		t.Errorf("status %d for an unknown wallet, want 404", w.Code)
+	}
+	if len(datastore.Wallets) != 1 {
+		t.Errorf("%d wallets, want 1", len(datastore.Wallets))
+	}
+}
+
+func renderError(t *testing.T, renderer render.Renderer) (*httptest.ResponseRecorder, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	render.Render(w, httptest.NewRequest("POST", "/", nil), renderer)
+	body := map[string]interface{}{}
+	err := json.Unmarshal(w.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatalf("error body %q: %v", w.Body.String(), err)
+	}
+	return w, body
+}
+
+func TestErrInvalidRequestBody(t *testing.T) {
+	w, body := renderError(t, ErrInvalidRequest(errors.New("No Amount supplied.")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", w.Code)
+	}
+	if body["status"] != "Invalid request." || body["code"] != string(ErrorCodeInvalidPayload) || body["error"] != "No Amount supplied." {
+		t.Errorf("body %v", body)
+	}
+}
+
+func TestErrPermissionDeniedBody(t *testing.T) {
+	w, body := renderError(t, ErrPermissionDenied())
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status %d, want 403", w.Code)
+	}
+	if body["status"] != "Permission denied." || body["code"] != string(ErrorCodePermissionDenied) {
+		t.Errorf("body %v", body)
+	}
+	// Omitted rather than empty.
+	if _, ok := body["error"]; ok {
+		t.Errorf("body %v has an empty error", body)
+	}
+}
+
+func TestErrResponseIsJSON(t *testing.T) {
+	for _, renderer := range []render.Renderer{ErrInvalidRequest(errors.New("bad")), ErrPermissionDenied(), ErrUnauthorized()} {
+		w, body := renderError(t, renderer)
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("Content-Type %q", ct)
+		}
+		if body["status"] == "" || body["status"] == nil {
+			t.Errorf("body %v without status", body)
+		}
+	}
+	_, body := renderError(t, ErrInvalidRequest(codedError(ErrorCodeWalletNotFound, errors.New("No matching wallet could be found."))))
+	if body["error"] != "No matching wallet could be found." || body["code"] != string(ErrorCodeWalletNotFound) {
+		t.Errorf("body %v", body)
+	}
+}
+
+func TestDryRunIsNeverBroadcast(t *testing.T) {
+	cfg, datastore := limitsTest(t, 0)
+	created, restore := recordClients()
+	defer restore()
+	order := &CreateOrder{BaseAssetSymbol: "XYZ-000", QuoteAssetSymbol: "BNB", Op: 1, Price: 100000000, Quantity: 100000000}
+	order.Wallet = "hot"
+	order.ChainId = "Binance-Chain-Test"
+	order.Sequence = 1
+	order.BroadcastHost = "dryrun.test"
+	order.DryRun = true
+
+	r := testRequest("POST", "/v1/order/create", "alice", order, datastore, cfg)
+	w := serveSigning(createOrderHandler, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	response := struct {
+		Type ResponseType
+		Data SignedTxResponse
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Type != ResponseTypeSigned || !response.Data.DryRun || response.Data.Broadcast != nil {
+		t.Errorf("response %s, want a dry run without broadcast", w.Body.String())
+	}
+	if _, err := decodeStdTx([]byte(response.Data.Tx)); err != nil {
+		t.Errorf("signed transaction: %v", err)
+	}
+	if len(*created) != 0 {
+		t.Errorf("%d clients created for a dry run", len(*created))
+	}
+}
+
+func renameWalletRequest(datastore *DexVaultDatastore, user string, wallet string, newName string) *http.Request {
+	data := &RenameWalletMessage{NewName: newName}
+	data.Wallet = wallet
+	return testRequest("POST", "/v1/wallet/rename", user, data, datastore, &DexVaultConfiguration{})
+}
+
+func TestRenameWalletHandler(t *testing.T) {
+	_, datastore := limitsTest(t, 0)
+	datastore.Users = append(datastore.Users, &DexVaultAuth{Name: "bob", Permissions: []Permission{PermissionRead}})
+	_, err := datastore.ImportPrivateKey("cold", testPrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := walletAddress(t, datastore, "hot")
+
+	if w := serveSigning(renameWalletHandler, renameWalletRequest(datastore, "bob", "hot", "warm")); errorCode(t, w) != ErrorCodePermissionDenied {
+		t.Errorf("renamed without permission: %s", w.Body.String())
+	}
+	if w := serveSigning(renameWalletHandler, renameWalletRequest(datastore, "alice", "hot", "cold")); w.Code != http.StatusConflict || errorCode(t, w) != ErrorCodeWalletExists {
+		t.Errorf("status %d renaming to a taken name, want 409: %s", w.Code, w.Body.String())
+	}
+
+	w := serveSigning(renameWalletHandler, renameWalletRequest(datastore, "alice", "hot", "warm"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	response := struct {
+		Type ResponseType
+		Data RenameWalletResponse
+	}{}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Type != ResponseTypeWalletRenamed || response.Data.OldName != "hot" || response.Data.Name != "warm" || response.Data.Address != address {
+		t.Errorf("response %s, want hot renamed to warm at %s", w.Body.String(), address)
+	}
+
+	// Permissions are granted per user, so they follow the wallet.
+	for user, wallet := range map[string]string{"alice": "warm", "bob": "warm"} {
+		r := testRequest("POST", "/v1/wallet", user, &BasicMessage{Wallet: wallet}, datastore, &DexVaultConfiguration{})
+		if w := serveSigning(getWalletHandler, r); w.Code != http.StatusOK {
+			t.Errorf("%s: status %d reading the renamed wallet", user, w.Code)
+		}
+	}
+	if w := serveSigning(renameWalletHandler, renameWalletRequest(datastore, "bob", "warm", "hot")); errorCode(t, w) != ErrorCodePermissionDenied {
+		t.Errorf("renamed the renamed wallet without permission: %s", w.Body.String())
+	}
+	r := testRequest("POST", "/v1/wallet", "alice", &BasicMessage{Wallet: "hot"}, datastore, &DexVaultConfiguration{})
+	if w := serveSigning(getWalletHandler, r); w.Code == http.StatusOK {
+		t.Error("wallet still found by its old name")
+	}
+}
+
+func importWalletRequest(datastore *DexVaultDatastore, data *ImportWalletMessage) *http.Request {
+	return testRequest("POST", "/v1/wallet/import", "alice", data, datastore, &DexVaultConfiguration{})
+}
+
+func importedAddress(t *testing.T, w *httptest.ResponseRecorder) string {
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	response := struct {
+		Data CreateWalletResponse
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.Data.Address
+}
+
+func TestImportMnemonic(t *testing.T) {
+	datastore := &DexVaultDatastore{Secret: "test secret", Users: []*DexVaultAuth{{Name: "alice", Permissions: []Permission{PermissionAll}}}}
+	keyManager, err := keys.NewMnemonicKeyManager(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := keyManager.GetAddr().String()
+
+	data := &ImportWalletMessage{Mnemonic: testMnemonic}
+	data.Wallet = "imported"
+	if got := importedAddress(t, serveSigning(importWalletHandler, importWalletRequest(datastore, data))); got != want {
+		t.Errorf("imported %s, want %s", got, want)
+	}
+	if got := walletAddress(t, datastore, "imported"); got != want {
+		t.Errorf("stored %s, want %s", got, want)
+	}
+
+	// The same phrase always derives the same key, so it is refused
+	// under another name.
+	data.Wallet = "again"
+	data.Mnemonic = "  " + strings.Replace(testMnemonic, " ", "\n ", 3)
+	if w := serveSigning(importWalletHandler, importWalletRequest(datastore, data)); w.Code == http.StatusOK {
+		t.Errorf("status %d importing the key again", w.Code)
+	}
+	data.KeyPath = "44'/714'/0'/0/1"
+	if got := importedAddress(t, serveSigning(importWalletHandler, importWalletRequest(datastore, data))); got == want {
+		t.Error("key path ignored")
+	}
+
+	for _, phrase := range []string{"not a mnemonic", strings.TrimSuffix(testMnemonic, " about")} {
+		data := &ImportWalletMessage{Mnemonic: phrase}
+		data.Wallet = "invalid"
+		w := serveSigning(importWalletHandler, importWalletRequest(datastore, data))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid mnemonic") {
+			t.Errorf("status %d for %q: %s", w.Code, phrase, w.Body.String())
+		}
+	}
+	if len(datastore.Wallets) != 2 {
+		t.Errorf("%d wallets stored, want 2", len(datastore.Wallets))
+	}
+}
+
+func TestImportPrivateKey(t *testing.T) {
+	datastore := &DexVaultDatastore{Secret: "test secret", Users: []*DexVaultAuth{{Name: "alice", Permissions: []Permission{PermissionAll}}}}
+	keyManager, err := keys.NewPrivateKeyManager(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := keyManager.GetAddr().String()
+
+	for _, key := range []string{
+		"0x",
+		"0102",
+		testPrivateKey + "01",
+		strings.Replace(testPrivateKey, "01", "zz", 1),
+		strings.Repeat(" ", 64),
+	} {
+		data := &ImportWalletMessage{PrivateKey: key}
+		data.Wallet = "key"
+		w := serveSigning(importWalletHandler, importWalletRequest(datastore, data))
+		if w.Code != http.StatusBadRequest || errorCode(t, w) != ErrorCodeInvalidPayload {
+			t.Errorf("status %d for %q: %s", w.Code, key, w.Body.String())
+		}
+	}
+	if len(datastore.Wallets) != 0 {
+		t.Fatalf("%d wallets stored from malformed keys", len(datastore.Wallets))
+	}
+
+	data := &ImportWalletMessage{PrivateKey: " 0x" + testPrivateKey + "\n"}
+	data.Wallet = "key"
+	if got := importedAddress(t, serveSigning(importWalletHandler, importWalletRequest(datastore, data))); got != want {
+		t.Errorf("imported %s, want %s", got, want)
+	}
+	if w := datastore.GetWallet("key"); w == nil || w.PrivateKey != "" || w.SealedKey == nil {
+		t.Error("private key stored unsealed")
+	}
+	if got := walletAddress(t, datastore, "key"); got != want {
+		t.Errorf("stored %s, want %s", got, want)
+	}
+
+	data.KeyPath = "44'/714'/0'/0/1"
+	data.Wallet = "path"
+	if w := serveSigning(importWalletHandler, importWalletRequest(datastore, data)); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d for a private key with a key path", w.Code)
+	}
+}
+
+func exportWalletRequest(datastore *DexVaultDatastore, user string, password string) *http.Request {
+	data := &ExportWalletMessage{Password: password}
+	data.Wallet = "hot"
+	return testRequest("POST", "/v1/wallet/export", user, data, datastore, &DexVaultConfiguration{})
+}
+
+func TestExportKeystore(t *testing.T) {
+	_, datastore := limitsTest(t, 0)
+	datastore.Users = append(datastore.Users, &DexVaultAuth{Name: "ops", Permissions: []Permission{PermissionExportWallet}})
+	address := walletAddress(t, datastore, "hot")
+
+	// PermissionAll does not include exporting.
+	if w := serveSigning(exportWalletHandler, exportWalletRequest(datastore, "alice", "correct horse")); errorCode(t, w) != ErrorCodePermissionDenied {
+		t.Errorf("exported without permission: %s", w.Body.String())
+	}
+	if w := serveSigning(exportWalletHandler, exportWalletRequest(datastore, "ops", "short")); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d for a short password", w.Code)
+	}
+
+	w := serveSigning(exportWalletHandler, exportWalletRequest(datastore, "ops", "correct horse"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	keyManager, err := datastore.GetWallet("hot").GetKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := keyManager.ExportAsPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.ToLower(w.Body.String())
+	if strings.Contains(body, privateKey) || strings.Contains(body, testMnemonic) {
+		t.Error("response contains the key of the wallet")
+	}
+
+	response := struct {
+		Type ResponseType
+		Data json.RawMessage
+	}{}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil || response.Type != ResponseTypeKeystore {
+		t.Fatalf("response %s: %v", w.Body.String(), err)
+	}
+	file := filepath.Join(t.TempDir(), "keystore.json")
+	err = ioutil.WriteFile(file, response.Data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := keys.NewKeyStoreKeyManager(file, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := imported.GetAddr().String(); got != address {
+		t.Errorf("re-imported %s, want %s", got, address)
+	}
+	if _, err := keys.NewKeyStoreKeyManager(file, "wrong horse"); err == nil {
+		t.Error("keystore decrypted with the wrong password")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// Set once the datastore is unsealed
+var datastoreLoaded int32 = 0
+
+func setDatastoreLoaded() {
+	atomic.StoreInt32(&datastoreLoaded, 1)
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// Returns 200 while the process is serving requests. No token is
+// required.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	WriteJSONResponse(w, r, HealthResponse{Status: "ok"})
+}
+
+type ReadyResponse struct {
+	Status           string
+	BroadcastJobs    int
+	MaxBroadcastJobs int
+	Error            string `json:",omitempty"`
+}
+
+// Returns 503 until the datastore is unsealed and the chain ID of every
+// configured broadcast host is known, and while the broadcast queue is
+// full. No token is required.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	response := ReadyResponse{
+		Status:           "ok",
+		BroadcastJobs:    broadcastJobs.Depth(),
+		MaxBroadcastJobs: broadcastJobs.Max(),
+	}
+	var err error = nil
+	if atomic.LoadInt32(&datastoreLoaded) == 0 {
+		err = errors.New("The datastore is not loaded yet.")
+	}
+	if err == nil {
+		err = chainInfo.Ready()
+	}
+	if err == nil && response.BroadcastJobs >= response.MaxBroadcastJobs {
+		err = errBroadcastQueueFull
+	}
+	if err != nil {
+		response.Status = "unavailable"
+		response.Error = err.Error()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	WriteJSONResponse(w, r, response)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/go-chi/render"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The node limits history queries to a window of three months.
+const MaxHistoryRange = 90 * 24 * time.Hour
+
+// Transactions fetched per page of the history
+const historyPageSize = 1000
+
+// Fees on Binance Chain are always paid in BNB
+const FeeSymbol = "BNB"
+
+var historyHttpClient = &http.Client{Timeout: 30 * time.Second}
+
+// A transaction of the history as returned by the node API
+type HistoryTx struct {
+	TxHash      string `json:"txHash"`
+	BlockHeight int64  `json:"blockHeight"`
+	TxType      string `json:"txType"`
+	TimeStamp   string `json:"timeStamp"`
+	FromAddr    string `json:"fromAddr"`
+	ToAddr      string `json:"toAddr"`
+	Value       string `json:"value"`
+	TxAsset     string `json:"txAsset"`
+	TxFee       string `json:"txFee"`
+	Code        int    `json:"code"`
+}
+
+type historyPage struct {
+	Total int         `json:"total"`
+	Tx    []HistoryTx `json:"tx"`
+}
+
+type FeesMessage struct {
+	QueryMessage
+	Wallet string
+	// Milliseconds since epoch
+	StartTime int64
+	EndTime   int64
+}
+
+type FeeTotal struct {
+	Symbol string
+	// In the smallest unit (1e-8)
+	Amount int64
+}
+
+type FeesResponse struct {
+	Wallet       string
+	Address      string
+	StartTime    int64
+	EndTime      int64
+	Transactions int
+	Fees         []FeeTotal
+}
+
+// Fetches all transactions of an address within the time range, in
+// milliseconds since epoch.
+func getTransactionHistory(host string, address string, start int64, end int64) ([]HistoryTx, error) {
+	txs := []HistoryTx{}
+	for offset := 0; ; offset += historyPageSize {
+		params := url.Values{}
+		params.Set("address", address)
+		params.Set("startTime", strconv.FormatInt(start, 10))
+		params.Set("endTime", strconv.FormatInt(end, 10))
+		params.Set("limit", strconv.Itoa(historyPageSize))
+		params.Set("offset", strconv.Itoa(offset))
+
+		resp, err := historyHttpClient.Get("https://" + host + "/api/v1/transactions?" + params.Encode())
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Transaction history query failed with status %d: %s", resp.StatusCode, string(body))
+		}
+
+		page := historyPage{}
+		err = json.Unmarshal(body, &page)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, page.Tx...)
+		if len(page.Tx) < historyPageSize || len(txs) >= page.Total {
+			return txs, nil
+		}
+	}
+}
+
+// Checks a history time range in milliseconds since epoch.
+func validateHistoryRange(start int64, end int64) error {
+	if start <= 0 || end <= 0 || start >= end {
+		return errors.New("Invalid time range.")
+	}
+	if time.Duration(end-start)*time.Millisecond > MaxHistoryRange {
+		return errors.New("Time range must not exceed 90 days.")
+	}
+	return nil
+}
+
+// Sums the fees paid by a wallet over a time range.
+func getFeesHandler(w http.ResponseWriter, r *http.Request) {
+	data := &FeesMessage{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionRead)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = validateHistoryRange(data.StartTime, data.EndTime)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	hosts, network, err := queryHostsForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	address, err := addressForNetwork(keyManager.GetAddr(), network)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	var txs []HistoryTx
+	err = queryWithFailover(w, hosts, func(host string) error {
+		var err error
+		txs, err = getTransactionHistory(host, address, data.StartTime, data.EndTime)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	totals := map[string]int64{}
+	for _, tx := range txs {
+		// Only the sender pays the fee of a transaction.
+		if tx.FromAddr != address || tx.TxFee == "" {
+			continue
+		}
+		fee, err := types.Fixed8DecodeString(tx.TxFee)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(fmt.Errorf("Invalid fee of transaction %s: %s", tx.TxHash, tx.TxFee)))
+			return
+		}
+		totals[FeeSymbol] += fee.ToInt64()
+	}
+
+	fr := FeesResponse{
+		Wallet:       data.Wallet,
+		Address:      address,
+		StartTime:    data.StartTime,
+		EndTime:      data.EndTime,
+		Transactions: len(txs),
+		Fees:         []FeeTotal{},
+	}
+	for symbol, amount := range totals {
+		fr.Fees = append(fr.Fees, FeeTotal{Symbol: symbol, Amount: amount})
+	}
+	sort.Slice(fr.Fees, func(i, j int) bool { return fr.Fees[i].Symbol < fr.Fees[j].Symbol })
+
+	WriteTypedResponse(w, r, ResponseTypeFees, fr)
+}
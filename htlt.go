@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type CreateHTLT struct {
+	SignedMessage
+	To                  string
+	RecipientOtherChain string
+	SenderOtherChain    string
+	// Hex-encoded SHA-256 of the random number and timestamp
+	RandomNumberHash string
+	Timestamp        int64
+	Amount           types.Coins
+	ExpectedIncome   string
+	// Number of blocks until the HTLT can be refunded
+	HeightSpan int64
+	CrossChain bool
+}
+
+// Deposits into an HTLT created by another account, which is claimed
+// or refunded together with the deposit.
+type DepositHTLT struct {
+	SignedMessage
+	// Hex-encoded ID of the swap
+	SwapId string
+	Amount types.Coins
+}
+
+type ClaimHTLT struct {
+	SignedMessage
+	SwapId string
+	// Hex-encoded random number whose hash locks the swap
+	RandomNumber string
+}
+
+type RefundHTLT struct {
+	SignedMessage
+	SwapId string
+}
+
+// Swap IDs, random numbers and their hashes are 32 bytes
+const SwapIdLength = 32
+const RandomNumberLength = 32
+const RandomNumberHashLength = 32
+
+// Longest addresses on the other chain and expected income the
+// chain accepts
+const MaxOtherChainAddrLength = 64
+const MaxExpectedIncomeLength = 64
+
+// Checks the HTLT the way the chain does, which would reject it only
+// after charging the fee.
+func (ht *CreateHTLT) Validate() error {
+	if ht.To == "" {
+		return errors.New("No To supplied.")
+	}
+	_, err := decodeSwapBytes("RandomNumberHash", ht.RandomNumberHash, RandomNumberHashLength)
+	if err != nil {
+		return err
+	}
+	if ht.Timestamp <= 0 {
+		return errors.New("Timestamp must be positive.")
+	}
+	if len(ht.Amount) == 0 || !ht.Amount.IsValid() || !ht.Amount.IsPositive() {
+		return errors.New("Amount must contain positive amounts of distinct symbols.")
+	}
+	if len(ht.ExpectedIncome) > MaxExpectedIncomeLength {
+		return fmt.Errorf("ExpectedIncome must be at most %d characters.", MaxExpectedIncomeLength)
+	}
+	if len(ht.RecipientOtherChain) > MaxOtherChainAddrLength || len(ht.SenderOtherChain) > MaxOtherChainAddrLength {
+		return fmt.Errorf("Addresses on the other chain must be at most %d characters.", MaxOtherChainAddrLength)
+	}
+	if ht.CrossChain && ht.RecipientOtherChain == "" {
+		return errors.New("Cross-chain swaps require RecipientOtherChain.")
+	}
+	if !ht.CrossChain && (ht.RecipientOtherChain != "" || ht.SenderOtherChain != "") {
+		return errors.New("RecipientOtherChain and SenderOtherChain must be empty unless CrossChain is set.")
+	}
+	if ht.HeightSpan < msg.MinimumHeightSpan || ht.HeightSpan > msg.MaximumHeightSpan {
+		return fmt.Errorf("HeightSpan must be between %d and %d.", msg.MinimumHeightSpan, msg.MaximumHeightSpan)
+	}
+	return nil
+}
+
+func decodeSwapBytes(name string, value string, length int) ([]byte, error) {
+	bz, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be hex-encoded: %s", name, err)
+	}
+	if len(bz) != length {
+		return nil, fmt.Errorf("%s must be %d bytes, got %d.", name, length, len(bz))
+	}
+	return bz, nil
+}
+
+func createSignedHTLTMsg(keyManager keys.KeyManager, ht *CreateHTLT) ([]byte, error) {
+	to, err := types.AccAddressFromBech32(ht.To)
+	if err != nil {
+		return nil, err
+	}
+	randomNumberHash, err := decodeSwapBytes("RandomNumberHash", ht.RandomNumberHash, RandomNumberHashLength)
+	if err != nil {
+		return nil, err
+	}
+	htltMsg := msg.NewHTLTMsg(
+		keyManager.GetAddr(),
+		to,
+		ht.RecipientOtherChain,
+		ht.SenderOtherChain,
+		randomNumberHash,
+		ht.Timestamp,
+		ht.Amount,
+		ht.ExpectedIncome,
+		ht.HeightSpan,
+		ht.CrossChain)
+	hexTx, err := signMessage(ht.SignedMessage, ht.Memo, htltMsg, keyManager)
+	return hexTx, err
+}
+
+func createHTLTHandler(w http.ResponseWriter, r *http.Request) {
+	data := &CreateHTLT{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionHTLT)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = data.Validate()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if requireApproval(w, r, PermissionHTLT) {
+		return
+	}
+
+	hexTx, err := createSignedHTLTMsg(keyManager, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	details := &SignedTxResponse{Tx: string(hexTx)}
+	if height, ok := chainInfo.Height(data.BroadcastHost, data.BroadcastNetwork); ok {
+		details.Height = height
+		details.ExpireHeight = height + data.HeightSpan
+	}
+	writeSignedDetails(w, r, keyManager, PermissionHTLT, &data.SignedMessage, hexTx, ResponseTypeHTLT, details)
+}
+
+func createSignedDepositHTLTMsg(keyManager keys.KeyManager, dh *DepositHTLT) ([]byte, error) {
+	swapId, err := decodeSwapBytes("SwapId", dh.SwapId, SwapIdLength)
+	if err != nil {
+		return nil, err
+	}
+	depositMsg := msg.NewDepositHTLTMsg(keyManager.GetAddr(), swapId, dh.Amount)
+	hexTx, err := signMessage(dh.SignedMessage, dh.Memo, depositMsg, keyManager)
+	return hexTx, err
+}
+
+func createSignedClaimHTLTMsg(keyManager keys.KeyManager, ch *ClaimHTLT) ([]byte, error) {
+	swapId, err := decodeSwapBytes("SwapId", ch.SwapId, SwapIdLength)
+	if err != nil {
+		return nil, err
+	}
+	randomNumber, err := decodeSwapBytes("RandomNumber", ch.RandomNumber, RandomNumberLength)
+	if err != nil {
+		return nil, err
+	}
+	claimMsg := msg.NewClaimHTLTMsg(keyManager.GetAddr(), swapId, randomNumber)
+	hexTx, err := signMessage(ch.SignedMessage, ch.Memo, claimMsg, keyManager)
+	return hexTx, err
+}
+
+func createSignedRefundHTLTMsg(keyManager keys.KeyManager, rh *RefundHTLT) ([]byte, error) {
+	swapId, err := decodeSwapBytes("SwapId", rh.SwapId, SwapIdLength)
+	if err != nil {
+		return nil, err
+	}
+	refundMsg := msg.NewRefundHTLTMsg(keyManager.GetAddr(), swapId)
+	hexTx, err := signMessage(rh.SignedMessage, rh.Memo, refundMsg, keyManager)
+	return hexTx, err
+}
+
+func depositHTLTHandler(w http.ResponseWriter, r *http.Request) {
+	data := &DepositHTLT{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionDepositHTLT)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if len(data.Amount) == 0 {
+		render.Render(w, r, ErrInvalidRequest(errors.New("No Amount supplied.")))
+		return
+	}
+	if requireApproval(w, r, PermissionDepositHTLT) {
+		return
+	}
+
+	hexTx, err := createSignedDepositHTLTMsg(keyManager, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	writeSignedResponse(w, r, keyManager, PermissionDepositHTLT, &data.SignedMessage, hexTx)
+}
+
+// The random number is checked before signing, as the chain would
+// reject a claim with a malformed one after charging the fee.
+func claimHTLTHandler(w http.ResponseWriter, r *http.Request) {
+	data := &ClaimHTLT{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionClaimHTLT)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	_, err = decodeSwapBytes("RandomNumber", data.RandomNumber, RandomNumberLength)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if requireApproval(w, r, PermissionClaimHTLT) {
+		return
+	}
+
+	hexTx, err := createSignedClaimHTLTMsg(keyManager, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	writeSignedResponse(w, r, keyManager, PermissionClaimHTLT, &data.SignedMessage, hexTx)
+}
+
+func refundHTLTHandler(w http.ResponseWriter, r *http.Request) {
+	data := &RefundHTLT{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionRefundHTLT)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if requireApproval(w, r, PermissionRefundHTLT) {
+		return
+	}
+
+	hexTx, err := createSignedRefundHTLTMsg(keyManager, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	writeSignedResponse(w, r, keyManager, PermissionRefundHTLT, &data.SignedMessage, hexTx)
+}
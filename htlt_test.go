@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+)
+
+const testHTLTHost = "htlt.test"
+
+func htltTest(t *testing.T) (*DexVaultConfiguration, *DexVaultDatastore, *CreateHTLT) {
+	cfg, datastore := limitsTest(t, 0)
+	chainInfo.Lock()
+	chainInfo.hosts = []BroadcastHostConfig{{Host: "prod.test", Network: 1}, {Host: testHTLTHost, Network: 0}}
+	chainInfo.nodes["prod.test"] = &NodeInfo{Host: "prod.test", Network: 1, Height: 900}
+	chainInfo.nodes[testHTLTHost] = &NodeInfo{Host: testHTLTHost, Network: 0, ChainId: "Binance-Chain-Test", Height: 100, Ready: true}
+	chainInfo.Unlock()
+
+	ht := &CreateHTLT{
+		To:               walletAddress(t, datastore, "hot"),
+		RandomNumberHash: strings.Repeat("ab", RandomNumberHashLength),
+		Timestamp:        1561939200,
+		Amount:           types.Coins{{Denom: "BNB", Amount: 1000}},
+		ExpectedIncome:   "1000:BNB",
+		HeightSpan:       1000,
+	}
+	ht.Wallet = "hot"
+	ht.ChainId = "Binance-Chain-Test"
+	ht.Sequence = 1
+	return cfg, datastore, ht
+}
+
+func htltResponse(t *testing.T, body []byte) SignedTxResponse {
+	response := struct {
+		Type ResponseType
+		Data SignedTxResponse
+	}{}
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Type != ResponseTypeHTLT {
+		t.Errorf("response type %s, want %s", response.Type, ResponseTypeHTLT)
+	}
+	return response.Data
+}
+
+func TestHTLTExpireHeightOfNetwork(t *testing.T) {
+	cfg, datastore, ht := htltTest(t)
+	r := testRequest("POST", "/v1/swap/htlt", "alice", ht, datastore, cfg)
+	w := serveSigning(createHTLTHandler, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	// Not the height of the first configured host, which is on mainnet.
+	response := htltResponse(t, w.Body.Bytes())
+	if response.Height != 100 || response.ExpireHeight != 1100 {
+		t.Errorf("height %d and expire height %d, want 100 and 1100", response.Height, response.ExpireHeight)
+	}
+}
+
+func TestHTLTBroadcast(t *testing.T) {
+	cfg, datastore, ht := htltTest(t)
+	client := &testDexClient{}
+	useTestClient(testHTLTHost, 0, client)
+	events, restore := recordAudit()
+	defer restore()
+	ht.BroadcastHost = testHTLTHost
+
+	r := testRequest("POST", "/v1/swap/htlt", "alice", ht, datastore, cfg)
+	w := serveSigning(createHTLTHandler, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	response := htltResponse(t, w.Body.Bytes())
+	if len(client.Posted) != 1 || response.Broadcast == nil || response.Broadcast.Host != testHTLTHost {
+		t.Fatalf("posted %d transactions, broadcast %v", len(client.Posted), response.Broadcast)
+	}
+	if response.ExpireHeight != 1100 {
+		t.Errorf("expire height %d, want 1100", response.ExpireHeight)
+	}
+	last := events.events[len(events.events)-1]
+	if last.Result != string(SigningOutcomeBroadcast) || last.TxHash != response.Broadcast.Results[0].Hash {
+		t.Errorf("last audit event %q, want the broadcast", last.Event)
+	}
+}
+
+func TestHTLTSignedFields(t *testing.T) {
+	_, datastore, ht := htltTest(t)
+	ht.CrossChain = true
+	ht.RecipientOtherChain = "0x1234"
+	ht.SenderOtherChain = "0x5678"
+	km, err := datastore.GetWallet("hot").GetKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hexTx, err := createSignedHTLTMsg(km, ht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdTx, err := decodeStdTx(hexTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := stdTx.Msgs[0].(msg.HTLTMsg)
+	if len(stdTx.Msgs) != 1 || !ok {
+		t.Fatalf("signed %v, want one HTLT", stdTx.Msgs)
+	}
+	if !bytes.Equal(m.From.Bytes(), km.GetAddr().Bytes()) || m.To.String() != ht.To || m.RecipientOtherChain != "0x1234" || m.SenderOtherChain != "0x5678" {
+		t.Errorf("addresses of %+v", m)
+	}
+	if hex.EncodeToString(m.RandomNumberHash) != ht.RandomNumberHash || m.Timestamp != ht.Timestamp || !m.Amount.IsEqual(ht.Amount) {
+		t.Errorf("lock of %+v", m)
+	}
+	if m.ExpectedIncome != ht.ExpectedIncome || m.HeightSpan != ht.HeightSpan || !m.CrossChain {
+		t.Errorf("terms of %+v", m)
+	}
+}
+
+func TestSwapMessagesSignedFields(t *testing.T) {
+	_, datastore, _ := htltTest(t)
+	km, err := datastore.GetWallet("hot").GetKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapId := strings.Repeat("cd", SwapIdLength)
+	randomNumber := strings.Repeat("ef", RandomNumberLength)
+	amount := types.Coins{{Denom: "BNB", Amount: 5}}
+
+	deposit, err := createSignedDepositHTLTMsg(km, &DepositHTLT{SwapId: swapId, Amount: amount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim, err := createSignedClaimHTLTMsg(km, &ClaimHTLT{SwapId: swapId, RandomNumber: randomNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refund, err := createSignedRefundHTLTMsg(km, &RefundHTLT{SwapId: swapId})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := []msg.Msg{}
+	for _, hexTx := range [][]byte{deposit, claim, refund} {
+		stdTx, err := decodeStdTx(hexTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, stdTx.Msgs[0])
+	}
+	if m, ok := decoded[0].(msg.DepositHTLTMsg); !ok || hex.EncodeToString(m.SwapID) != swapId || !m.Amount.IsEqual(amount) {
+		t.Errorf("deposit %+v", decoded[0])
+	}
+	if m, ok := decoded[1].(msg.ClaimHTLTMsg); !ok || hex.EncodeToString(m.SwapID) != swapId || hex.EncodeToString(m.RandomNumber) != randomNumber {
+		t.Errorf("claim %+v", decoded[1])
+	}
+	if m, ok := decoded[2].(msg.RefundHTLTMsg); !ok || hex.EncodeToString(m.SwapID) != swapId || !bytes.Equal(m.From.Bytes(), km.GetAddr().Bytes()) {
+		t.Errorf("refund %+v", decoded[2])
+	}
+
+	if _, err := createSignedClaimHTLTMsg(km, &ClaimHTLT{SwapId: swapId, RandomNumber: "ef"}); err == nil {
+		t.Error("claim with a short random number signed")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Parses a list of IPs and CIDR ranges. Plain IPs match only
+// themselves.
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, errors.New("Invalid IP: " + e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, errors.New("Invalid CIDR: " + e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Whether the IP is contained in any of the entries. Invalid entries
+// never match.
+func ipInList(ip string, entries []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, e := range entries {
+		nets, err := parseIPNets([]string{e})
+		if err != nil {
+			continue
+		}
+		if nets[0].Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the IP of the client. If the request comes from one of the
+// trusted_proxies, X-Forwarded-For is walked from the right and the
+// first address that is not a trusted proxy is used.
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	trusted := GetRequestConfig(r).TrustedProxies
+	if len(trusted) == 0 || !ipInList(ip, trusted) {
+		return ip
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !ipInList(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
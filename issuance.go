@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Amounts on Binance Chain are integers with 8 implied decimals.
+const TokenDecimals = 8
+
+// Deployment policy for issued tokens. Unset bounds are not checked.
+// Supplies are given in the smallest unit (1e-8).
+type TokenIssuancePolicy struct {
+	MinSupply *int64 `yaml:"min_supply"`
+	MaxSupply *int64 `yaml:"max_supply"`
+	// Maximum number of decimal places used by the supply
+	MaxDecimals *int `yaml:"max_decimals"`
+}
+
+func (p *TokenIssuancePolicy) Validate() error {
+	if p.MaxDecimals != nil && (*p.MaxDecimals < 0 || *p.MaxDecimals > TokenDecimals) {
+		return fmt.Errorf("max_decimals must be between 0 and %d.", TokenDecimals)
+	}
+	if p.MinSupply != nil && p.MaxSupply != nil && *p.MinSupply > *p.MaxSupply {
+		return errors.New("min_supply must not be larger than max_supply.")
+	}
+	return nil
+}
+
+func (p *TokenIssuancePolicy) String() string {
+	rules := []string{}
+	if p.MinSupply != nil {
+		rules = append(rules, fmt.Sprintf("min supply %d", *p.MinSupply))
+	}
+	if p.MaxSupply != nil {
+		rules = append(rules, fmt.Sprintf("max supply %d", *p.MaxSupply))
+	}
+	if p.MaxDecimals != nil {
+		rules = append(rules, fmt.Sprintf("max decimals %d", *p.MaxDecimals))
+	}
+	if len(rules) == 0 {
+		return "none"
+	}
+	return strings.Join(rules, ", ")
+}
+
+// Checks a supply against the policy.
+func (p *TokenIssuancePolicy) Check(supply int64) error {
+	if p.MinSupply != nil && supply < *p.MinSupply {
+		return fmt.Errorf("Supply %d is below the minimum of %d.", supply, *p.MinSupply)
+	}
+	if p.MaxSupply != nil && supply > *p.MaxSupply {
+		return fmt.Errorf("Supply %d exceeds the maximum of %d.", supply, *p.MaxSupply)
+	}
+	if p.MaxDecimals != nil {
+		unit := int64(1)
+		for i := *p.MaxDecimals; i < TokenDecimals; i++ {
+			unit *= 10
+		}
+		if supply%unit != 0 {
+			return fmt.Errorf("Supply may use at most %d decimals.", *p.MaxDecimals)
+		}
+	}
+	return nil
+}
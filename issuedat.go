@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/go-chi/render"
+	"net/http"
+	"time"
+)
+
+// Optional timestamp of a payload, set by the client when the
+// request is created.
+type IssuedAtMessage struct {
+	IssuedAt *time.Time
+}
+
+// Checks IssuedAt against the allowed clock drift. Payloads without
+// it are accepted.
+func checkIssuedAt(cfg *DexVaultConfiguration, issuedAt time.Time, now time.Time) error {
+	drift := issuedAt.Sub(now)
+	future := time.Duration(cfg.MaxIssuedAtFuture) * time.Second
+	if cfg.MaxIssuedAtFuture > 0 && drift > future {
+		return codedError(ErrorCodeClockDrift, fmt.Errorf("IssuedAt is %s in the future, at most %s are allowed. Check the clock of the client.", drift.Round(time.Second), future))
+	}
+	age := time.Duration(cfg.MaxIssuedAtAge) * time.Second
+	if cfg.MaxIssuedAtAge > 0 && -drift > age {
+		return codedError(ErrorCodeClockDrift, fmt.Errorf("IssuedAt is %s old, at most %s are allowed.", (-drift).Round(time.Second), age))
+	}
+	return nil
+}
+
+// Returns a numeric time claim of a token as Unix time.
+func claimTime(claims jwt.MapClaims, name string) (int64, bool, error) {
+	switch v := claims[name].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return int64(v), true, nil
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil, err
+	}
+	return 0, false, fmt.Errorf("The %s claim of the token must be a number.", name)
+}
+
+// Checks the exp, nbf and iat claims of a token, allowing for the
+// configured clock skew. With a max_token_lifetime tokens must expire
+// within that many seconds.
+func checkTokenTimes(cfg *DexVaultConfiguration, claims jwt.MapClaims, now time.Time) error {
+	skew := int64(cfg.TokenClockSkew)
+	if skew < 0 {
+		skew = 0
+	}
+	unix := now.Unix()
+	exp, hasExp, err := claimTime(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if hasExp && unix > exp+skew {
+		return fmt.Errorf("The token expired %s ago.", (time.Duration(unix-exp) * time.Second).String())
+	}
+	if cfg.MaxTokenLifetime > 0 {
+		if !hasExp {
+			return errors.New("The token must have an exp claim.")
+		}
+		if exp-unix > int64(cfg.MaxTokenLifetime)+skew {
+			return fmt.Errorf("The token expires in %s, at most %ds are allowed.", (time.Duration(exp-unix) * time.Second).String(), cfg.MaxTokenLifetime)
+		}
+	}
+	nbf, hasNbf, err := claimTime(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if hasNbf && nbf > unix+skew {
+		return errors.New("The token is not valid yet.")
+	}
+	iat, hasIat, err := claimTime(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if hasIat && iat > unix+skew {
+		return fmt.Errorf("The token was issued %s in the future. Check the clock of the client.", (time.Duration(iat-unix) * time.Second).String())
+	}
+	return nil
+}
+
+// Rejects payloads whose IssuedAt is outside the allowed window.
+// Must run after the Authenticator.
+func IssuedAtWindow(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, _ := jwtauth.FromContext(r.Context())
+		claims, ok := token.Claims.(jwt.MapClaims)
+		payload, hasPayload := claims["payload"].(string)
+		if ok && hasPayload {
+			data := &IssuedAtMessage{}
+			// Malformed payloads are rejected by the handlers.
+			if json.Unmarshal([]byte(payload), data) == nil && data.IssuedAt != nil {
+				err := checkIssuedAt(GetRequestConfig(r), *data.IssuedAt, time.Now())
+				if err != nil {
+					fmt.Println("Rejected request of " + GetRequestUser(r) + ": " + err.Error())
+					render.Render(w, r, ErrInvalidRequest(err))
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type BroadcastJobStatus string
+
+const BroadcastJobQueued BroadcastJobStatus = "queued"
+const BroadcastJobRunning BroadcastJobStatus = "running"
+const BroadcastJobDone BroadcastJobStatus = "done"
+const BroadcastJobFailed BroadcastJobStatus = "failed"
+
+// Finished jobs are kept this long so clients can fetch the result.
+const broadcastJobRetention = time.Hour
+
+// Seconds clients are asked to wait when the queue is full
+const broadcastQueueRetryAfter = 5
+
+// A transaction broadcast in the background, see BroadcastModeQueued.
+type BroadcastJob struct {
+	Id        string
+	Wallet    string
+	Initiator string
+	Created   time.Time
+	Status    BroadcastJobStatus
+	Result    *BroadcastResponse `json:",omitempty"`
+	Error     string             `json:",omitempty"`
+
+	host    string
+	network int
+	tx      []byte
+	options BroadcastOptions
+}
+
+var errBroadcastQueueFull = errors.New("Broadcast queue is full.")
+
+type BroadcastJobMessage struct {
+	JobId string
+}
+
+type broadcastJobQueue struct {
+	sync.Mutex
+	jobs  map[string]*BroadcastJob
+	queue chan *BroadcastJob
+}
+
+// Jobs are kept in memory only and lost on restart.
+var broadcastJobs = &broadcastJobQueue{jobs: map[string]*BroadcastJob{}}
+
+// Starts the worker. Jobs are broadcast one at a time, in order, so
+// consecutive sequences of a wallet reach the node in order.
+func (q *broadcastJobQueue) Start(max int) {
+	q.queue = make(chan *BroadcastJob, max)
+	go func() {
+		for job := range q.queue {
+			q.run(job)
+		}
+	}()
+}
+
+func (q *broadcastJobQueue) run(job *BroadcastJob) {
+	q.Lock()
+	job.Status = BroadcastJobRunning
+	q.Unlock()
+
+	result, err := broadcastMessage(job.host, job.network, job.tx, job.options)
+
+	q.Lock()
+	defer q.Unlock()
+	if err != nil {
+		fmt.Println("Broadcast job " + job.Id + " failed: " + err.Error())
+		job.Status = BroadcastJobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = BroadcastJobDone
+		job.Result = result
+	}
+	job.tx = nil
+}
+
+// Removes finished jobs past their retention. Must hold the lock.
+func (q *broadcastJobQueue) prune() {
+	for id, job := range q.jobs {
+		finished := job.Status == BroadcastJobDone || job.Status == BroadcastJobFailed
+		if finished && time.Since(job.Created) > broadcastJobRetention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// Queues a transaction for broadcasting. Rejects it with 429 if
+// max_broadcast_jobs jobs are already waiting.
+func (q *broadcastJobQueue) Enqueue(job *BroadcastJob) error {
+	bytes, err := GenerateRandomBytes(16)
+	if err != nil {
+		return err
+	}
+	job.Id = hex.EncodeToString(bytes)
+	job.Created = time.Now().UTC()
+	job.Status = BroadcastJobQueued
+
+	q.Lock()
+	defer q.Unlock()
+	q.prune()
+	select {
+	case q.queue <- job:
+		q.jobs[job.Id] = job
+		return nil
+	default:
+		return &RequestError{
+			HTTPStatusCode: http.StatusTooManyRequests,
+			StatusText:     errBroadcastQueueFull.Error(),
+			RetryAfter:     broadcastQueueRetryAfter,
+			AppCode:        ErrorCodeQueueFull,
+			Err:            fmt.Errorf("%d broadcast jobs are already queued.", cap(q.queue)),
+		}
+	}
+}
+
+// Number of jobs waiting to be broadcast.
+func (q *broadcastJobQueue) Depth() int {
+	return len(q.queue)
+}
+
+func (q *broadcastJobQueue) Max() int {
+	return cap(q.queue)
+}
+
+// Returns a copy of the job.
+func (q *broadcastJobQueue) Get(id string) (BroadcastJob, bool) {
+	q.Lock()
+	defer q.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return BroadcastJob{}, false
+	}
+	return *job, true
+}
+
+// Only the user who submitted a job can see it.
+func getBroadcastJobHandler(w http.ResponseWriter, r *http.Request) {
+	data := &BroadcastJobMessage{}
+	datastore, user, err := decodeRequestBasic(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	u := datastore.GetUser(user)
+	if !u.HasPermission(PermissionRead) {
+		render.Render(w, r, ErrPermissionDenied())
+		return
+	}
+
+	job, ok := broadcastJobs.Get(data.JobId)
+	if !ok || job.Initiator != user {
+		render.Render(w, r, ErrInvalidRequest(errors.New("No matching broadcast job could be found.")))
+		return
+	}
+	WriteTypedResponse(w, r, ResponseTypeBroadcastJob, job)
+}
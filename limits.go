@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/go-chi/render"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Window of the spending limits
+const SpendingWindow = 24 * time.Hour
+
+// Amounts per wallet and symbol, in the smallest unit (1e-8), a
+// wallet may send within SpendingWindow. Wallets and symbols without
+// a limit are unlimited.
+type SpendingLimits map[string]map[string]int64
+
+func (l SpendingLimits) Validate() error {
+	for wallet, limits := range l {
+		for symbol, limit := range limits {
+			if limit <= 0 {
+				return errors.New("Limit of " + symbol + " for wallet " + wallet + " must be positive.")
+			}
+		}
+	}
+	return nil
+}
+
+// An amount sent by a wallet, kept for SpendingWindow.
+type SpendingRecord struct {
+	Wallet string
+	Symbol string
+	Amount int64
+	Time   time.Time
+}
+
+// Guards Spending in the datastore.
+var spendingMutex sync.Mutex
+
+type LimitExceededError struct {
+	Wallet string
+	Symbol string
+	// Amounts the wallet may still send per limited symbol
+	Remaining map[string]int64
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("Wallet %s would exceed its daily limit of %s, it may send %d more.", e.Wallet, e.Symbol, e.Remaining[e.Symbol])
+}
+
+func ErrLimitExceeded(e *LimitExceededError) render.Renderer {
+	return &ErrResponse{
+		Err:            e,
+		HTTPStatusCode: http.StatusForbidden,
+		StatusText:     "Spending limit exceeded.",
+		AppCode:        ErrorCodeLimitExceeded,
+		ErrorText:      e.Error(),
+		Remaining:      e.Remaining,
+	}
+}
+
+// Removes records older than SpendingWindow. Must hold spendingMutex.
+func (b *DexVaultDatastore) pruneSpending(now time.Time) {
+	records := []*SpendingRecord{}
+	for _, s := range b.Spending {
+		if now.Sub(s.Time) < SpendingWindow {
+			records = append(records, s)
+		}
+	}
+	b.Spending = records
+}
+
+// Rejects the transfers if they would exceed a spending limit of the
+// wallet, otherwise reserves them. Called right before signing, so
+// requests waiting for approval do not count. The reservation is
+// released if the request signs nothing or its broadcast fails, see
+// requestReservations, and kept right away outside of requests.
+func checkSpendingLimit(r *http.Request, cfg *DexVaultConfiguration, datastore *DexVaultDatastore, wallet string, transfers []msg.Transfer) *LimitExceededError {
+	limits := cfg.SpendingLimits[wallet]
+	if len(limits) == 0 {
+		return nil
+	}
+
+	spendingMutex.Lock()
+	defer spendingMutex.Unlock()
+
+	now := time.Now()
+	datastore.pruneSpending(now)
+	remaining := map[string]int64{}
+	for symbol, limit := range limits {
+		remaining[symbol] = limit
+	}
+	for _, s := range datastore.Spending {
+		if _, ok := remaining[s.Symbol]; ok && s.Wallet == wallet {
+			remaining[s.Symbol] -= s.Amount
+		}
+	}
+	for symbol := range remaining {
+		if remaining[symbol] < 0 {
+			remaining[symbol] = 0
+		}
+	}
+
+	totals := map[string]int64{}
+	for _, t := range transfers {
+		for _, c := range t.Coins {
+			if _, ok := limits[c.Denom]; ok {
+				totals[c.Denom] += c.Amount
+			}
+		}
+	}
+	symbols := []string{}
+	for symbol := range totals {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		if totals[symbol] > remaining[symbol] {
+			return &LimitExceededError{Wallet: wallet, Symbol: symbol, Remaining: remaining}
+		}
+	}
+	if len(symbols) == 0 {
+		return nil
+	}
+
+	records := []*SpendingRecord{}
+	for _, symbol := range symbols {
+		records = append(records, &SpendingRecord{Wallet: wallet, Symbol: symbol, Amount: totals[symbol], Time: now})
+	}
+	// Concurrent requests see the reserved amounts as spent.
+	datastore.Spending = append(datastore.Spending, records...)
+	if reservations := GetRequestReservations(r); reservations != nil && !reservations.settled {
+		reservations.datastore = datastore
+		reservations.spending = append(reservations.spending, records...)
+	} else {
+		datastore.persist()
+	}
+	return nil
+}
+
+// Removes reserved records of a request that did not sign.
+func (b *DexVaultDatastore) releaseSpending(released []*SpendingRecord) {
+	spendingMutex.Lock()
+	defer spendingMutex.Unlock()
+	records := []*SpendingRecord{}
+	for _, s := range b.Spending {
+		keep := true
+		for _, r := range released {
+			if s == r {
+				keep = false
+			}
+		}
+		if keep {
+			records = append(records, s)
+		}
+	}
+	b.Spending = records
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+)
+
+const testLimitHost = "limits.test"
+
+func limitsTest(t *testing.T, limit int64) (*DexVaultConfiguration, *DexVaultDatastore) {
+	cfg := &DexVaultConfiguration{
+		SpendingLimits: SpendingLimits{"hot": {"BNB": limit}},
+	}
+	datastore := &DexVaultDatastore{
+		Secret: "test secret",
+		Users:  []*DexVaultAuth{{Name: "alice", Permissions: []Permission{PermissionAll}}},
+	}
+	_, err := datastore.ImportWallet("hot", testMnemonic, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, datastore
+}
+
+func testTransfers(amount int64) []msg.Transfer {
+	to, _ := types.AccAddressFromHex("0202020202020202020202020202020202020202")
+	return []msg.Transfer{{ToAddr: to, Coins: types.Coins{{Denom: "BNB", Amount: amount}}}}
+}
+
+func sendTokenPayload(amount int64, host string) *SendToken {
+	send := &SendToken{Transfers: testTransfers(amount), SkipMemoCheck: true}
+	send.Wallet = "hot"
+	send.ChainId = "Binance-Chain-Test"
+	send.AccountNumber = 1
+	send.Sequence = 1
+	send.BroadcastHost = host
+	return send
+}
+
+// Runs the request through the middleware like the router does.
+func serveSigning(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	SigningReservations(handler).ServeHTTP(w, r)
+	return w
+}
+
+func spent(datastore *DexVaultDatastore) int64 {
+	var total int64 = 0
+	for _, s := range datastore.Spending {
+		total += s.Amount
+	}
+	return total
+}
+
+func TestSpendingLimitCountsSignedTransfers(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	r := testRequest("POST", "/v1/token/send", "alice", sendTokenPayload(600, ""), datastore, cfg)
+	if w := serveSigning(sendTokenHandler, r); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if spent(datastore) != 600 {
+		t.Errorf("spent %d, want 600", spent(datastore))
+	}
+
+	r = testRequest("POST", "/v1/token/send", "alice", sendTokenPayload(600, ""), datastore, cfg)
+	if w := serveSigning(sendTokenHandler, r); w.Code != http.StatusForbidden {
+		t.Errorf("status %d above the limit, want 403", w.Code)
+	}
+	if spent(datastore) != 600 {
+		t.Errorf("spent %d after a rejected transfer, want 600", spent(datastore))
+	}
+}
+
+func TestSpendingLimitIgnoresFailedBroadcasts(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	useTestClient(testLimitHost, 0, &testDexClient{Failures: 1, Err: errors.New("insufficient fund")})
+	r := testRequest("POST", "/v1/token/send", "alice", sendTokenPayload(600, testLimitHost), datastore, cfg)
+	if w := serveSigning(sendTokenHandler, r); w.Code == http.StatusOK {
+		t.Fatalf("failed broadcast returned status %d", w.Code)
+	}
+	if spent(datastore) != 0 {
+		t.Errorf("spent %d after a failed broadcast, want 0", spent(datastore))
+	}
+
+	useTestClient(testLimitHost, 0, &testDexClient{})
+	r = testRequest("POST", "/v1/token/send", "alice", sendTokenPayload(1000, testLimitHost), datastore, cfg)
+	if w := serveSigning(sendTokenHandler, r); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if spent(datastore) != 1000 {
+		t.Errorf("spent %d, want 1000", spent(datastore))
+	}
+}
+
+func TestSpendingLimitIgnoresDryRuns(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	send := sendTokenPayload(600, testLimitHost)
+	send.DryRun = true
+	r := testRequest("POST", "/v1/token/send", "alice", send, datastore, cfg)
+	if w := serveSigning(sendTokenHandler, r); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if spent(datastore) != 0 {
+		t.Errorf("spent %d after a dry run, want 0", spent(datastore))
+	}
+}
+
+func TestSpendingLimitAppliesToPresign(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	item := func(amount int64) PresignItem {
+		j, _ := json.Marshal(&SendToken{Transfers: testTransfers(amount)})
+		return PresignItem{Action: PermissionSendToken, Payload: j}
+	}
+	presign := &Presign{Transactions: []PresignItem{item(600), item(600)}}
+	presign.Wallet = "hot"
+	presign.ChainId = "Binance-Chain-Test"
+	presign.Sequence = 1
+
+	r := testRequest("POST", "/v1/presign", "alice", presign, datastore, cfg)
+	if w := serveSigning(presignHandler, r); w.Code != http.StatusForbidden {
+		t.Fatalf("status %d for pre-signing above the limit, want 403", w.Code)
+	}
+	presign.Transactions = presign.Transactions[:1]
+	r = testRequest("POST", "/v1/presign", "alice", presign, datastore, cfg)
+	if w := serveSigning(presignHandler, r); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if spent(datastore) != 600 {
+		t.Errorf("spent %d, want 600", spent(datastore))
+	}
+}
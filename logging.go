@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const RequestLogCtxKey = "requestlogctxkey"
+
+// Request log formats
+const RequestLogFormatText = "text"
+const RequestLogFormatJSON = "json"
+
+// Request log levels: every request, only failed ones, or none
+const RequestLogLevelInfo = "info"
+const RequestLogLevelError = "error"
+const RequestLogLevelOff = "off"
+
+// Counts successful requests for sampling the request log.
+var requestLogCounter uint64
+
+// Where the request log is written, set from request_log_output.
+var requestLogOutput io.Writer = os.Stdout
+var requestLogMutex sync.Mutex
+
+// An entry of the request log. It never contains the payload, so no
+// key material or secrets can end up in the log.
+type RequestLogEntry struct {
+	Time     time.Time
+	Method   string
+	Path     string
+	Status   int
+	Duration float64 // milliseconds
+	User     string
+	IP       string
+	Wallet   string     `json:",omitempty"`
+	Action   Permission `json:",omitempty"`
+	TxHash   string     `json:",omitempty"`
+}
+
+// Opens the configured request log output, stdout, stderr or a file
+// the log is appended to.
+func openRequestLog(output string) (io.Writer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	return os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+}
+
+func validateRequestLog(cfg *DexVaultConfiguration) error {
+	switch cfg.RequestLogFormat {
+	case RequestLogFormatText, RequestLogFormatJSON:
+	default:
+		return errors.New("Unknown request_log_format: " + cfg.RequestLogFormat)
+	}
+	switch cfg.RequestLogLevel {
+	case RequestLogLevelInfo, RequestLogLevelError, RequestLogLevelOff:
+	default:
+		return errors.New("Unknown request_log_level: " + cfg.RequestLogLevel)
+	}
+	return nil
+}
+
+func getRequestLogEntry(r *http.Request) *RequestLogEntry {
+	e, _ := r.Context().Value(RequestLogCtxKey).(*RequestLogEntry)
+	return e
+}
+
+// Records the wallet and action of a request for the request log.
+func logRequestAction(r *http.Request, wallet string, action Permission) {
+	if e := getRequestLogEntry(r); e != nil {
+		e.Wallet = wallet
+		e.Action = action
+	}
+}
+
+// Records the hash of the signed transaction for the request log.
+func logRequestTx(r *http.Request, hash string) {
+	if e := getRequestLogEntry(r); e != nil {
+		e.TxHash = hash
+	}
+}
+
+func writeRequestLog(cfg *DexVaultConfiguration, e *RequestLogEntry) {
+	var line string
+	if cfg.RequestLogFormat == RequestLogFormatJSON {
+		j, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		line = string(j) + "\n"
+	} else {
+		line = fmt.Sprintf("Request: %s %s %d %s user %s from %s", e.Method, e.Path, e.Status, time.Duration(e.Duration*float64(time.Millisecond)), e.User, e.IP)
+		if e.Wallet != "" {
+			line += " wallet " + e.Wallet + " action " + string(e.Action)
+		}
+		if e.TxHash != "" {
+			line += " tx " + e.TxHash
+		}
+		line += "\n"
+	}
+	requestLogMutex.Lock()
+	defer requestLogMutex.Unlock()
+	io.WriteString(requestLogOutput, line)
+}
+
+// Records the status written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Logs requests for diagnostics, with the wallet, action and
+// transaction hash of signing requests. Failed requests are always
+// logged unless request_log_level is off, successful ones only at
+// level info and 1 in request_log_sampling. Signing events are logged
+// separately by auditLog and never sampled.
+func RequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := GetRequestConfig(r)
+		if cfg.RequestLogLevel == RequestLogLevelOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		entry := &RequestLogEntry{Time: start.UTC(), Method: r.Method, Path: r.URL.Path}
+		r = r.WithContext(context.WithValue(r.Context(), RequestLogCtxKey, entry))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status < 400 {
+			if cfg.RequestLogLevel == RequestLogLevelError {
+				return
+			}
+			rate := uint64(cfg.RequestLogSampling)
+			if rate > 1 && atomic.AddUint64(&requestLogCounter, 1)%rate != 0 {
+				return
+			}
+		}
+		entry.Status = rec.status
+		entry.Duration = milliseconds(time.Since(start))
+		entry.User = GetRequestUser(r)
+		entry.IP = ClientIP(r)
+		writeRequestLog(cfg, entry)
+	})
+}
+
+// Writes an unsampled entry to the security audit log.
+func auditLog(r *http.Request, event string) {
+	auditLogger.Log(newAuditEvent(r, event))
+}
+
+func auditBroadcast(r *http.Request, host string, br *BroadcastResponse) {
+	for _, result := range br.Results {
+		auditLog(r, fmt.Sprintf("Broadcast to %s: hash %s, ok %t", host, result.Hash, result.Ok))
+	}
+}
@@ -4,22 +4,24 @@ import (
 	"github.com/binance-chain/go-sdk/keys"
 
 	// "context"
+	"bufio"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
-	// "errors"
+	"errors"
+	"flag"
 	"fmt"
-	// jwt "github.com/dgrijalva/jwt-go"
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/jwtauth"
-	// "github.com/go-chi/render"
-	"bufio"
-	"crypto/rand"
-	"flag"
+	"github.com/go-chi/render"
 	"github.com/go-yaml/yaml"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 func GetRequestConfig(r *http.Request) *DexVaultConfiguration {
@@ -47,8 +49,91 @@ type DexVaultConfiguration struct {
 	// Whitelist
 	IpWhitelist bool     `yaml:"ip_whitelist"`
 	Whitelist   []string `yaml:"whitelist"`
+	// Proxies whose X-Forwarded-For header is trusted, IPs or CIDRs
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Return the pre-envelope {"Response": ...} shape
+	LegacyResponses bool `yaml:"legacy_responses"`
+	// Deployment environment, "development" or "production"
+	Environment string `yaml:"environment"`
+	// Whether denied requests report the reason, "detailed" or "generic"
+	DenialDetail string `yaml:"denial_detail"`
+	// Number of approvals required per action before signing
+	ApprovalThresholds map[Permission]int `yaml:"approval_thresholds"`
+	// Approvals required for large transfers
+	TransferApproval TransferApprovalPolicy `yaml:"transfer_approval"`
+	// Retries of broadcasts that failed transiently
+	BroadcastRetry BroadcastRetryPolicy `yaml:"broadcast_retry"`
+	// Skipping of read hosts that keep failing
+	HostCircuitBreaker HostCircuitBreakerPolicy `yaml:"host_circuit_breaker"`
+	// Seconds after which pending actions expire
+	ApprovalTTL int `yaml:"approval_ttl"`
+	// Broadcast mode and confirmations per action
+	BroadcastPolicies map[Permission]BroadcastPolicy `yaml:"broadcast_policies"`
+	// Seconds to wait for confirmations before giving up
+	ConfirmationTimeout int `yaml:"confirmation_timeout"`
+	// Hosts whose chain information is cached
+	BroadcastHosts []BroadcastHostConfig `yaml:"broadcast_hosts"`
+	// Seconds between refreshes of the cached chain information
+	ChainInfoRefresh int `yaml:"chain_info_refresh"`
+	// Bounds for issued tokens
+	TokenIssuancePolicy TokenIssuancePolicy `yaml:"token_issuance_policy"`
+	// Minimum seconds between signing requests per wallet
+	SigningCooldowns map[string]int `yaml:"signing_cooldowns"`
+	// Log 1 in N successful requests, errors are always logged
+	RequestLogSampling int `yaml:"request_log_sampling"`
+	// Format, level and destination of the request log
+	RequestLogFormat string `yaml:"request_log_format"`
+	RequestLogLevel  string `yaml:"request_log_level"`
+	RequestLogOutput string `yaml:"request_log_output"`
+	// Minimum order notional per quote asset in the smallest unit
+	MinNotionals map[string]int64 `yaml:"min_notionals"`
+	// Amounts wallets may send per day
+	SpendingLimits SpendingLimits `yaml:"spending_limits"`
+	// Maximum deviation of order prices from the market
+	PriceDeviation PriceDeviationPolicy `yaml:"price_deviation"`
+	// Maximum number of queued broadcast jobs
+	MaxBroadcastJobs int `yaml:"max_broadcast_jobs"`
+	// Funding of newly created wallets
+	WalletFunding WalletFundingPolicy `yaml:"wallet_funding"`
+	// Allowed clock drift of payload timestamps in seconds
+	MaxIssuedAtFuture int `yaml:"max_issued_at_future"`
+	MaxIssuedAtAge    int `yaml:"max_issued_at_age"`
+	// Allowed clock skew of token timestamps and maximum remaining
+	// lifetime of tokens in seconds
+	TokenClockSkew   int `yaml:"token_clock_skew"`
+	MaxTokenLifetime int `yaml:"max_token_lifetime"`
+	// Maximum elements of payload arrays and nesting of payloads
+	MaxPayloadItems int `yaml:"max_payload_items"`
+	MaxPayloadDepth int `yaml:"max_payload_depth"`
+	// Hosts wallet webhooks may point to
+	WebhookAllowlist []string `yaml:"webhook_allowlist"`
+	// Wallets whose sequences are kept cached, and how often they are
+	// refreshed in seconds
+	SequenceWarmWallets  []string `yaml:"sequence_warm_wallets"`
+	SequenceWarmInterval int      `yaml:"sequence_warm_interval"`
+	// Seconds broadcast clients are reused, forever if zero
+	ClientCacheTTL int `yaml:"client_cache_ttl"`
+	// Where consumed nonces are kept and for how many seconds
+	NonceStore     string `yaml:"nonce_store"`
+	NonceStorePath string `yaml:"nonce_store_path"`
+	NonceTTL       int    `yaml:"nonce_ttl"`
+	// Signing payloads must carry a Nonce and an IssuedAt
+	RequireNonce bool `yaml:"require_nonce"`
+	// Hash-chained record of every signing, off if empty
+	AuditChainFile string `yaml:"audit_chain_file"`
+	// Serve /metrics on this address instead of listen_address
+	MetricsListenAddr string `yaml:"metrics_listen_address"`
+	// Format of the audit log and where it is written
+	AuditLogFormat string `yaml:"audit_log_format"`
+	AuditLogOutput string `yaml:"audit_log_output"`
 }
 
+const EnvironmentDevelopment = "development"
+const EnvironmentProduction = "production"
+
+const DenialDetailDetailed = "detailed"
+const DenialDetailGeneric = "generic"
+
 func newAuthToken(name string, secret string) DexVaultAuth {
 	// tokenAuth := jwtauth.New("HS256", []byte(secret), nil)
 	tokenAuth2 := DexVaultAuth{
@@ -60,8 +145,10 @@ func newAuthToken(name string, secret string) DexVaultAuth {
 	return tokenAuth2
 }
 
+// Only verifies the signature, exp, nbf and iat are checked by the
+// Authenticator, which allows for clock skew.
 func (b *DexVaultAuth) GetJwtAuth() *jwtauth.JWTAuth {
-	return jwtauth.New("HS256", []byte(b.Secret), nil)
+	return jwtauth.NewWithParser("HS256", &jwt.Parser{SkipClaimsValidation: true}, []byte(b.Secret), nil)
 }
 
 func readSecret() string {
@@ -85,27 +172,75 @@ func unseal() DexVaultDatastore {
 		fmt.Println("Unsealing datastore using DEXVAULT_SECRET env var.")
 	}
 
-	contents := decryptFile("datastore.bin", secret)
-
-	datastore := DexVaultDatastore{}
-	err := json.Unmarshal(contents, &datastore)
+	datastore := DexVaultDatastore{Secret: secret}
+	err := datastore.Load(DatastoreFile)
 	if err != nil {
-		panic("Failed to load datastore!")
+		panic("Failed to load datastore: " + err.Error())
+	}
+	if datastore.plaintextWallets > 0 {
+		fmt.Printf("Sealing the keys of %d wallets.\n", datastore.plaintextWallets)
+		err = datastore.Save(DatastoreFile)
+		if err != nil {
+			panic("Failed to save datastore: " + err.Error())
+		}
 	}
 	fmt.Println("Successfully unsealed.")
-	datastore.Secret = secret
 
 	return datastore
 }
 
-func (b *DexVaultDatastore) Save() {
+// Replaces the contents of the datastore with the file at path,
+// unsealed with the Secret of the datastore. Later saves go to path.
+func (b *DexVaultDatastore) Load(path string) error {
+	contents, err := decryptFile(path, b.Secret)
+	if err != nil {
+		return err
+	}
+	loaded := DexVaultDatastore{}
+	err = json.Unmarshal(contents, &loaded)
+	if err != nil {
+		return err
+	}
+	loaded.Secret = b.Secret
+	loaded.Path = path
+	err = loaded.sealWallets()
+	if err != nil {
+		return err
+	}
+	*b = loaded
+	return nil
+}
+
+// Seals the datastore to path. Saves are serialized and each takes its
+// snapshot under saveMutex, so an older snapshot never replaces a
+// newer one.
+func (b *DexVaultDatastore) Save(path string) error {
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
 	fmt.Println("Updating datastore.")
+	walletsMutex.RLock()
 	bin, err := json.Marshal(b)
+	walletsMutex.RUnlock()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	return encryptFile(path, bin, b.Secret)
+}
 
-	encryptFile("datastore.bin", bin, b.Secret)
+// Saves the datastore to the file it was loaded from, after a change.
+// A failed save is logged and returned, the change stays in memory and
+// is written by the next save. Datastores without a Path, e.g. in
+// tests, are only kept in memory.
+func (b *DexVaultDatastore) persist() error {
+	if b.Path == "" {
+		return nil
+	}
+	err := b.Save(b.Path)
+	if err != nil {
+		fmt.Println("Failed to save datastore: " + err.Error())
+		return errors.New("Failed to save datastore.")
+	}
+	return nil
 }
 
 func commandServe() {
@@ -124,11 +259,189 @@ func commandServe() {
 	if cfg.ListenAddr == "" {
 		cfg.ListenAddr = ":1234"
 	}
+	if cfg.Environment == "" {
+		cfg.Environment = EnvironmentProduction
+	}
+	if cfg.Environment != EnvironmentDevelopment && cfg.Environment != EnvironmentProduction {
+		panic("Unknown environment: " + cfg.Environment)
+	}
+	if cfg.DenialDetail == "" {
+		if cfg.Environment == EnvironmentDevelopment {
+			cfg.DenialDetail = DenialDetailDetailed
+		} else {
+			cfg.DenialDetail = DenialDetailGeneric
+		}
+	}
+	if cfg.DenialDetail != DenialDetailDetailed && cfg.DenialDetail != DenialDetailGeneric {
+		panic("Unknown denial_detail: " + cfg.DenialDetail)
+	}
+	if cfg.ConfirmationTimeout == 0 {
+		cfg.ConfirmationTimeout = 60
+	}
+	for action, policy := range cfg.BroadcastPolicies {
+		if policy.Mode != BroadcastModeSync && policy.Mode != BroadcastModeAsync && policy.Mode != BroadcastModeBlock && policy.Mode != BroadcastModeQueued {
+			panic("Unknown broadcast mode for " + string(action) + ": " + string(policy.Mode))
+		}
+	}
+	err = cfg.BroadcastRetry.Validate()
+	if err != nil {
+		panic("Invalid broadcast_retry: " + err.Error())
+	}
+	if cfg.BroadcastRetry.MaxAttempts == 0 {
+		cfg.BroadcastRetry.MaxAttempts = 1
+	}
+	broadcastRetry = cfg.BroadcastRetry
+	err = cfg.PriceDeviation.Validate()
+	if err != nil {
+		panic("Invalid price_deviation: " + err.Error())
+	}
+	err = cfg.HostCircuitBreaker.Validate()
+	if err != nil {
+		panic("Invalid host_circuit_breaker: " + err.Error())
+	}
+	if cfg.HostCircuitBreaker.Failures == 0 {
+		cfg.HostCircuitBreaker.Failures = 3
+	}
+	if cfg.HostCircuitBreaker.Cooldown == 0 {
+		cfg.HostCircuitBreaker.Cooldown = 30
+	}
+	readHosts.SetPolicy(cfg.HostCircuitBreaker)
+	if cfg.ChainInfoRefresh == 0 {
+		cfg.ChainInfoRefresh = 60
+	}
+	_, err = parseIPNets(cfg.TrustedProxies)
+	if err != nil {
+		panic("Invalid trusted_proxies: " + err.Error())
+	}
+	if cfg.RequestLogSampling <= 0 {
+		cfg.RequestLogSampling = 1
+	}
+	if cfg.RequestLogFormat == "" {
+		cfg.RequestLogFormat = RequestLogFormatText
+	}
+	if cfg.RequestLogLevel == "" {
+		cfg.RequestLogLevel = RequestLogLevelInfo
+	}
+	err = validateRequestLog(&cfg)
+	if err != nil {
+		panic("Invalid request log: " + err.Error())
+	}
+	requestLogOutput, err = openRequestLog(cfg.RequestLogOutput)
+	if err != nil {
+		panic("Invalid request_log_output: " + err.Error())
+	}
+	if cfg.AuditLogFormat == "" {
+		cfg.AuditLogFormat = AuditLogFormatText
+	}
+	auditLogger, err = newAuditLogger(&cfg)
+	if err != nil {
+		panic("Invalid audit log: " + err.Error())
+	}
+	if cfg.MaxBroadcastJobs <= 0 {
+		cfg.MaxBroadcastJobs = 100
+	}
+	if cfg.MaxIssuedAtFuture == 0 {
+		cfg.MaxIssuedAtFuture = 30
+	}
+	if cfg.MaxIssuedAtAge == 0 {
+		cfg.MaxIssuedAtAge = 300
+	}
+	if cfg.TokenClockSkew == 0 {
+		cfg.TokenClockSkew = 30
+	}
+	if cfg.MaxTokenLifetime < 0 {
+		panic("max_token_lifetime must not be negative.")
+	}
+	if cfg.SequenceWarmInterval <= 0 {
+		cfg.SequenceWarmInterval = 10
+	}
+	if cfg.ClientCacheTTL < 0 {
+		panic("client_cache_ttl must not be negative.")
+	}
+	dexClients.SetTTL(time.Duration(cfg.ClientCacheTTL) * time.Second)
+	if cfg.NonceTTL <= 0 {
+		// Payloads with an IssuedAt can not be replayed after this.
+		cfg.NonceTTL = cfg.MaxIssuedAtAge + cfg.MaxIssuedAtFuture
+		if cfg.NonceTTL <= 0 {
+			cfg.NonceTTL = 600
+		}
+	}
+	if cfg.RequireNonce && (cfg.MaxIssuedAtAge < 0 || cfg.MaxIssuedAtFuture < 0 || cfg.NonceTTL < cfg.MaxIssuedAtAge+cfg.MaxIssuedAtFuture) {
+		panic("require_nonce needs max_issued_at_age and max_issued_at_future, and a nonce_ttl of at least their sum.")
+	}
+	if cfg.MaxPayloadItems <= 0 {
+		cfg.MaxPayloadItems = 1000
+	}
+	if cfg.MaxPayloadDepth <= 0 {
+		cfg.MaxPayloadDepth = 16
+	}
+	err = cfg.TokenIssuancePolicy.Validate()
+	if err != nil {
+		panic("Invalid token_issuance_policy: " + err.Error())
+	}
+	fmt.Println("Token issuance policy: " + cfg.TokenIssuancePolicy.String())
+	err = cfg.WalletFunding.Validate()
+	if err != nil {
+		panic("Invalid wallet_funding: " + err.Error())
+	}
+	err = cfg.TransferApproval.Validate()
+	if err != nil {
+		panic("Invalid transfer_approval: " + err.Error())
+	}
+	err = cfg.SpendingLimits.Validate()
+	if err != nil {
+		panic("Invalid spending_limits: " + err.Error())
+	}
+	if cfg.ApprovalTTL <= 0 {
+		cfg.ApprovalTTL = 86400
+	}
+	for action, required := range cfg.ApprovalThresholds {
+		fmt.Printf("%s requires %d approvals.\n", action, required)
+	}
 	// Load and unseal datastore
 	datastore := unseal()
+	setDatastoreLoaded()
+
+	for _, h := range cfg.BroadcastHosts {
+		err = validateNetwork(h.Network)
+		if err != nil {
+			panic("Invalid broadcast_hosts: " + h.Host + ": " + err.Error())
+		}
+	}
+	chainInfo.Start(cfg.BroadcastHosts, time.Duration(cfg.ChainInfoRefresh)*time.Second)
+	startScheduler(&cfg, &datastore)
+	err = startNonceStore(&cfg)
+	if err != nil {
+		panic("Invalid nonce_store: " + err.Error())
+	}
+	if cfg.AuditChainFile != "" {
+		auditChain, err = openAuditLog(cfg.AuditChainFile)
+		if err != nil {
+			panic("Invalid audit_chain_file: " + err.Error())
+		}
+	}
+	broadcastJobs.Start(cfg.MaxBroadcastJobs)
+	registerMetrics()
+	stopSequenceWarmer := startSequenceWarmer(&cfg, &datastore)
 
 	// Configure router
 	r := chi.NewRouter()
+	// Respond with JSON, also errors, whatever the Accept header says
+	r.Use(render.SetContentType(render.ContentTypeJSON))
+	r.Get("/health", healthHandler)
+	r.Get("/ready", readyHandler)
+	r.Get("/version", versionHandler)
+	if cfg.MetricsListenAddr == "" {
+		r.Get("/metrics", metricsHandler)
+	} else {
+		go func() {
+			fmt.Println("Serving metrics on: " + cfg.MetricsListenAddr)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/metrics", metricsHandler)
+			err := http.ListenAndServe(cfg.MetricsListenAddr, mux)
+			fmt.Println("Metrics server quit: " + err.Error())
+		}()
+	}
 	r.Group(func(r chi.Router) {
 		// Attach datastore to request
 		r.Use(DatastoreContext(&datastore, &cfg))
@@ -137,25 +450,76 @@ func commandServe() {
 		r.Use(IPWhitelist)
 
 		// Second check: JWT
-		r.Use(Verifier(datastore.Users))
+		r.Use(Verifier(&datastore))
 		r.Use(Authenticator)
-
+		r.Use(RequestLog)
+		r.Use(UserIPAllowlist)
+		r.Use(PayloadLimits)
+		r.Use(IssuedAtWindow)
+		r.Use(ReplayProtection)
+		r.Use(SigningTimer)
+		r.Use(SigningReservations)
+
+		r.Get("/whoami", whoamiHandler)
+		r.Post("/permitted-batch", permittedBatchHandler)
 		r.Post("/v1/address", getAddressHandler)
+		r.Post("/v1/address/validate", validateAddressHandler)
+		r.Post("/v1/tx/decode", decodeTxHandler)
+		r.Get("/v1/tx/{hash}", getTxStatusHandler)
+		r.Get("/v1/node/", getNodeInfoHandler)
+		r.Get("/v1/capabilities", getCapabilitiesHandler)
 		r.Get("/v1/wallet/", getWalletsHandler)
 		r.Post("/v1/wallet/", getWalletHandler)
+		r.Get("/v1/wallet/signable", getSignableWalletsHandler)
+		r.Post("/v1/wallet/fees", getFeesHandler)
+		r.Post("/v1/wallet/balance", getBalanceHandler)
+		r.Get("/v1/wallet/{name}/balance", getWalletBalanceHandler)
+		r.Post("/v1/wallet/balances", getBalanceHistoryHandler)
+		r.Post("/v1/wallet/sequence", getSequenceHandler)
+		r.Post("/v1/wallet/mempool", getMempoolHandler)
 		r.Post("/v1/wallet/create", createWalletHandler)
+		r.Post("/v1/wallet/import", importWalletHandler)
+		r.Post("/v1/wallet/export", exportWalletHandler)
+		r.Post("/v1/wallet/delete", deleteWalletHandler)
+		r.Post("/v1/wallet/rename", renameWalletHandler)
 		r.Post("/v1/order/create", createOrderHandler)
 		r.Post("/v1/order/cancel", cancelOrderHandler)
+		r.Post("/v1/order/cancel/batch", cancelOrdersHandler)
+		r.Post("/v1/order/replace", replaceOrderHandler)
+		r.Post("/v1/order/schedule", scheduleOrderHandler)
+		r.Post("/v1/order/scheduled", getScheduledOrdersHandler)
+		r.Post("/v1/order/open", getOpenOrdersHandler)
 		r.Post("/v1/token/burn", tokenBurnHandler)
 		r.Post("/v1/token/freeze", freezeTokenHandler)
 		r.Post("/v1/token/unfreeze", unfreezeTokenHandler)
 		r.Post("/v1/token/issue", issueTokenHandler)
+		r.Post("/v1/token/issueMini", issueMiniTokenHandler)
+		r.Post("/v1/token/info", getTokenInfoHandler)
+		r.Post("/v1/token/issued", getIssuedTokensHandler)
+		r.Post("/v1/token/uri", setTokenURIHandler)
 		r.Post("/v1/token/mint", mintTokenHandler)
 		r.Post("/v1/token/send", sendTokenHandler)
+		r.Post("/v1/token/multisend", multiSendHandler)
+		r.Post("/v1/swap/htlt", createHTLTHandler)
+		r.Post("/v1/swap/deposit", depositHTLTHandler)
+		r.Post("/v1/swap/claim", claimHTLTHandler)
+		r.Post("/v1/swap/refund", refundHTLTHandler)
 		r.Post("/v1/listPair", listPairHandler)
+		r.Post("/v1/market/ticker", getTickerHandler)
+		r.Post("/v1/market/klines", getKlinesHandler)
+		r.Post("/v1/validator/rewards", getValidatorRewardsHandler)
 		r.Post("/v1/proposal/submit", submitProposalHandler)
 		r.Post("/v1/proposal/vote", voteProposalHandler)
 		r.Post("/v1/deposit/", depositHandler)
+		r.Post("/v1/broadcast/job", getBroadcastJobHandler)
+		r.Post("/v1/presign", presignHandler)
+		r.Get("/v1/approval/", getPendingActionsHandler)
+		r.Post("/v1/approval/approve", approveHandler)
+		r.Post("/v1/admin/backup", backupHandler)
+		r.Post("/v1/admin/restore", restoreHandler)
+		r.Get("/v1/admin/config", getConfigHandler)
+		r.Post("/v1/admin/wallet/freeze", freezeWalletHandler)
+		r.Get("/v1/admin/audit", getAuditLogHandler)
 	})
 
 	fmt.Println("Starting server on: " + cfg.ListenAddr)
@@ -164,6 +528,7 @@ func commandServe() {
 	} else {
 		err = http.ListenAndServe(cfg.ListenAddr, r)
 	}
+	stopSequenceWarmer()
 	fmt.Println("Server quit: ")
 	fmt.Println(err)
 }
@@ -179,15 +544,18 @@ func GenerateRandomBytes(n int) ([]byte, error) {
 }
 
 func commandInit() {
-	if _, err := os.Stat("datastore.bin"); os.IsNotExist(err) {
+	if _, err := os.Stat(DatastoreFile); os.IsNotExist(err) {
 		fmt.Println("Welcome to the initial DexVault configuration.")
 		fmt.Println("Please enter a password to use as sealing secret:")
 		secret := readSecret()
-		datastore := &DexVaultDatastore{}
-		datastore.Secret = secret
-		datastore.Save()
+		datastore := &DexVaultDatastore{Secret: secret}
+		err := datastore.Save(DatastoreFile)
+		if err != nil {
+			fmt.Println("Failed to save datastore: " + err.Error())
+			os.Exit(1)
+		}
 	} else {
-		fmt.Println("datastore.bin already exists. Cancelling init.")
+		fmt.Println(DatastoreFile + " already exists. Cancelling init.")
 	}
 }
 
@@ -209,6 +577,10 @@ func main() {
 	name := flag.String("name", "", "Username to create/modify")
 	permission := flag.String("permission", "", "A permission to add/revoke")
 	wallet := flag.String("wallet", "", "Wallet to work on")
+	network := flag.String("network", "", "Network a new wallet is intended for: testnet, mainnet")
+	ips := flag.String("ips", "", "Comma separated IPs/CIDRs a user may connect from, empty for unrestricted")
+	webhookURL := flag.String("url", "", "Webhook URL notified of every signing with a wallet, empty to remove")
+	memo := flag.String("memo", "", "Default memo of transfers from a wallet, empty to remove")
 	flag.Parse()
 
 	if *command == "" {
@@ -271,6 +643,35 @@ func main() {
 		fmt.Println("User: " + user.Name)
 		fmt.Print("Permissions: ")
 		fmt.Println(user.Permissions)
+		if len(user.AllowedIPs) > 0 {
+			fmt.Println("Allowed IPs: " + strings.Join(user.AllowedIPs, ", "))
+		}
+	}
+	if *command == "set-allowed-ips" {
+		datastore := unseal()
+		user := existingUser(&datastore, *name)
+		allowed := []string{}
+		for _, ip := range strings.Split(*ips, ",") {
+			ip = strings.TrimSpace(ip)
+			if ip != "" {
+				allowed = append(allowed, ip)
+			}
+		}
+		_, err := parseIPNets(allowed)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		user.AllowedIPs = allowed
+		if err := datastore.Save(DatastoreFile); err != nil {
+			fmt.Println("Failed to save datastore: " + err.Error())
+			return
+		}
+		if len(allowed) == 0 {
+			fmt.Println("User " + user.Name + " is unrestricted.")
+		} else {
+			fmt.Println("User " + user.Name + " may connect from: " + strings.Join(allowed, ", "))
+		}
 	}
 	if *command == "add-permission" {
 		datastore := unseal()
@@ -280,7 +681,10 @@ func main() {
 			return
 		}
 		user.AddPermission(Permission(*permission))
-		datastore.Save()
+		if err := datastore.Save(DatastoreFile); err != nil {
+			fmt.Println("Failed to save datastore: " + err.Error())
+			return
+		}
 	}
 	if *command == "revoke-permission" {
 		datastore := unseal()
@@ -290,7 +694,10 @@ func main() {
 			return
 		}
 		user.RevokePermission(Permission(*permission))
-		datastore.Save()
+		if err := datastore.Save(DatastoreFile); err != nil {
+			fmt.Println("Failed to save datastore: " + err.Error())
+			return
+		}
 	}
 
 	// Wallet management
@@ -300,6 +707,13 @@ func main() {
 			fmt.Println("Wallet name required.")
 			return
 		}
+		if *network != "" && !isNetworkName(*network) {
+			fmt.Println("Unknown network: " + *network)
+			return
+		}
+		if *network == "" {
+			fmt.Println("Warning: wallet is not tagged with a network, consider setting -network.")
+		}
 
 		manager, err := keys.NewKeyManager()
 		if err != nil {
@@ -319,11 +733,20 @@ func main() {
 			return
 		}
 		w := Wallet{
-			Name: *wallet,
-			Seed: mnemonic,
+			Name:    *wallet,
+			Seed:    mnemonic,
+			Network: *network,
+		}
+		err = w.Seal(datastore.Secret)
+		if err != nil {
+			fmt.Println("Failed to seal the key: " + err.Error())
+			return
 		}
 		datastore.Wallets = append(datastore.Wallets, w)
-		datastore.Save()
+		if err := datastore.Save(DatastoreFile); err != nil {
+			fmt.Println("Failed to save datastore: " + err.Error())
+			return
+		}
 		addr := manager.GetAddr().String()
 		fmt.Println("New wallet generated: " + addr)
 		for {
@@ -349,6 +772,51 @@ func main() {
 			fmt.Println("- " + w.Name + *addr)
 		}
 	}
+	if *command == "set-webhook" {
+		datastore := unseal()
+		w := datastore.GetWallet(*wallet)
+		if w == nil {
+			fmt.Println("Wallet not found.")
+			return
+		}
+		if *webhookURL == "" {
+			datastore.SetWebhook(w.Name, nil)
+			fmt.Println("Webhook of wallet " + w.Name + " removed.")
+			return
+		}
+		// The host is checked against webhook_allowlist on every delivery.
+		u, err := url.Parse(*webhookURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			fmt.Println("Webhook URL must be an http or https URL.")
+			return
+		}
+		bytes, err := GenerateRandomBytes(32)
+		if err != nil {
+			panic("Failed to generate random!")
+		}
+		webhook := &WalletWebhook{URL: *webhookURL, Secret: hex.EncodeToString(bytes)}
+		datastore.SetWebhook(w.Name, webhook)
+		fmt.Println("Webhook of wallet " + w.Name + ": " + webhook.URL)
+		fmt.Println("HMAC secret: " + webhook.Secret)
+	}
+	if *command == "set-default-memo" {
+		datastore := unseal()
+		w := datastore.GetWallet(*wallet)
+		if w == nil {
+			fmt.Println("Wallet not found.")
+			return
+		}
+		err := datastore.SetDefaultMemo(w.Name, *memo)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if *memo == "" {
+			fmt.Println("Default memo of wallet " + w.Name + " removed.")
+		} else {
+			fmt.Println("Default memo of wallet " + w.Name + ": " + *memo)
+		}
+	}
 	if *command == "export-wallet" {
 		datastore := unseal()
 		fmt.Println("ARE YOU SURE? THIS WILL DISPLAY YOUR SEED.")
@@ -360,7 +828,16 @@ func main() {
 				fmt.Println("Wallet not found.")
 				return
 			}
-			fmt.Println("Seed: " + w.Seed)
+			err := w.Unseal(datastore.Secret)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if w.PrivateKey != "" {
+				fmt.Println("Private key: " + w.PrivateKey)
+			} else {
+				fmt.Println("Seed: " + w.Seed)
+			}
 		} else {
 			fmt.Println("Cancelled.")
 		}
@@ -391,24 +868,16 @@ func main() {
 
 		fmt.Println("Please enter the mnemonic seed:")
 		seed := readSecret()
-		manager, err := keys.NewMnemonicKeyManager(seed)
+		w, err := datastore.ImportWallet(*wallet, seed, "", *network)
 		if err != nil {
-			fmt.Println("Failed to parse mnemonic.")
+			fmt.Println("Failed to import wallet: " + err.Error())
 			return
 		}
-
-		old_w := datastore.GetWallet(*wallet)
-		if old_w != nil {
-			fmt.Println("Wallet with name already exists.")
+		addr, err := w.GetAddress()
+		if err != nil {
+			fmt.Println("Failed to get address.")
 			return
 		}
-		w := Wallet{
-			Name: *wallet,
-			Seed: seed,
-		}
-		datastore.Wallets = append(datastore.Wallets, w)
-		datastore.Save()
-		addr := manager.GetAddr().String()
-		fmt.Println("New wallet imported: " + addr)
+		fmt.Println("New wallet imported: " + *addr)
 	}
 }
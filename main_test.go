@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/tx"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+)
+
+// Builds a request as the middleware passes it to the handlers, with
+// the payload claim of a verified token.
+func testRequest(method string, path string, user string, payload interface{}, datastore *DexVaultDatastore, cfg *DexVaultConfiguration) *http.Request {
+	j, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	token := &jwt.Token{Claims: jwt.MapClaims{"payload": string(j)}, Valid: true}
+	r := httptest.NewRequest(method, path, nil)
+	ctx := jwtauth.NewContext(r.Context(), token, nil)
+	ctx = context.WithValue(ctx, NameCtxKey, &user)
+	ctx = context.WithValue(ctx, DatastoreCtxKey, datastore)
+	ctx = context.WithValue(ctx, ConfigurationCtxKey, cfg)
+	return r.WithContext(ctx)
+}
+
+// Audit events of the tests, see recordAudit.
+type testAuditLogger struct {
+	events []*AuditEvent
+}
+
+func (l *testAuditLogger) Log(e *AuditEvent) {
+	l.events = append(l.events, e)
+}
+
+// Collects the audit events until the returned function is called.
+func recordAudit() (*testAuditLogger, func()) {
+	previous := auditLogger
+	l := &testAuditLogger{}
+	auditLogger = l
+	return l, func() { auditLogger = previous }
+}
+
+// A node that accepts every transaction after failing the first
+// Failures posts and commits them at Height. Methods other than
+// PostTx, the tx query and GetNodeInfo are not implemented.
+type testDexClient struct {
+	sdk.DexClient
+	sync.Mutex
+	Failures int
+	Err      error
+	Height   int64
+	Posted   [][]byte
+	Params   []map[string]string
+	// Accounts by address, others were never funded
+	Accounts map[string]*types.BalanceAccount
+	// Returned for every query, like a node ignoring its filters
+	OpenOrders []types.Order
+	Queries    []*types.OpenOrdersQuery
+}
+
+func (c *testDexClient) PostTx(hexTx []byte, param map[string]string) ([]tx.TxCommitResult, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.Params = append(c.Params, param)
+	if c.Failures > 0 {
+		c.Failures--
+		if c.Err != nil {
+			return nil, c.Err
+		}
+		return nil, errors.New("bad response, status code 503")
+	}
+	c.Posted = append(c.Posted, hexTx)
+	return []tx.TxCommitResult{{Ok: true, Hash: txHash(hexTx)}}, nil
+}
+
+// Answers the tx query, see getCommittedTx.
+func (c *testDexClient) Get(path string, qp map[string]string) ([]byte, int, error) {
+	c.Lock()
+	defer c.Unlock()
+	for _, posted := range c.Posted {
+		if "/tx/"+txHash(posted) == path && c.Height > 0 {
+			bz, err := json.Marshal(CommittedTx{Hash: txHash(posted), Height: c.Height})
+			return bz, http.StatusOK, err
+		}
+	}
+	return nil, http.StatusNotFound, errors.New("bad response, status code 404")
+}
+
+func (c *testDexClient) GetAccount(address string) (*types.BalanceAccount, error) {
+	c.Lock()
+	defer c.Unlock()
+	if account, ok := c.Accounts[address]; ok {
+		return account, nil
+	}
+	return nil, errors.New("bad response, status code 404")
+}
+
+func (c *testDexClient) GetOpenOrders(query *types.OpenOrdersQuery) (*types.OpenOrders, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.Queries = append(c.Queries, query)
+	return &types.OpenOrders{Order: c.OpenOrders, Total: len(c.OpenOrders)}, nil
+}
+
+func (c *testDexClient) GetNodeInfo() (*types.ResultStatus, error) {
+	c.Lock()
+	defer c.Unlock()
+	status := &types.ResultStatus{}
+	status.SyncInfo.LatestBlockHeight = c.Height
+	return status, nil
+}
+
+// Sends the broadcasts to host through the client.
+func useTestClient(host string, network int, client sdk.DexClient) {
+	dexClients.Lock()
+	defer dexClients.Unlock()
+	dexClients.clients[host+"/"+strconv.Itoa(network)] = clientCacheEntry{client: client, created: time.Now()}
+}
+
+// Returns the signed transaction of a response of type hex or signed.
+func signedTx(t *testing.T, w *httptest.ResponseRecorder) []byte {
+	response := struct {
+		Type ResponseType
+		Data json.RawMessage
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("response %q: %v", w.Body.String(), err)
+	}
+	if response.Type == ResponseTypeHex {
+		var hexTx string
+		err = json.Unmarshal(response.Data, &hexTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte(hexTx)
+	}
+	signed := SignedTxResponse{}
+	err = json.Unmarshal(response.Data, &signed)
+	if err != nil || signed.Tx == "" {
+		t.Fatalf("response %q without a signed transaction", w.Body.String())
+	}
+	return []byte(signed.Tx)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/go-chi/render"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Maximum number of symbols per ticker request
+const MaxTickerSymbols = 20
+
+// Token symbols, e.g. BNB, BTCB-1DE or mini-tokens like XYZ-000M
+var tokenSymbolRegexp = regexp.MustCompile(`^[A-Z0-9]{2,8}(-[0-9A-F]{3}M?)?$`)
+
+// Trading pairs, e.g. BTCB-1DE_BNB
+var pairSymbolRegexp = regexp.MustCompile(`^[A-Z0-9]{2,8}(-[0-9A-F]{3}M?)?_[A-Z0-9]{2,8}(-[0-9A-F]{3}M?)?$`)
+
+// Splits a pair symbol, e.g. BTCB-1DE_BNB, into its base and quote
+// asset. Symbols must match pairSymbolRegexp.
+func splitPairSymbol(symbol string) (string, string) {
+	parts := strings.SplitN(symbol, "_", 2)
+	if len(parts) < 2 {
+		return symbol, ""
+	}
+	return parts[0], parts[1]
+}
+
+var tickerCache = newTTLCache(5 * time.Second)
+
+// Maximum number of candles per klines request
+const MaxKlines = 1000
+
+// Kline intervals supported by the node
+var KlineIntervals = []string{"1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "8h", "12h", "1d", "3d", "1w", "1M"}
+
+// Order of the values of each candle in a KlinesResponse
+var KlineColumns = []string{"OpenTime", "Open", "High", "Low", "Close", "Volume", "CloseTime"}
+
+type TickerMessage struct {
+	QueryMessage
+	Symbols []string
+}
+
+type Ticker struct {
+	Symbol             string
+	LastPrice          string
+	HighPrice          string
+	LowPrice           string
+	Volume             string
+	PriceChange        string
+	PriceChangePercent string
+}
+
+type TickersResponse struct {
+	Tickers []Ticker
+}
+
+type KlinesMessage struct {
+	QueryMessage
+	Symbol   string
+	Interval string
+	// Defaults to MaxKlines
+	Limit uint32
+	// Milliseconds since epoch, optional
+	StartTime int64
+	EndTime   int64
+}
+
+// Candles are arrays with the values in the order of Columns, so
+// they can be passed to charting libraries directly.
+type KlinesResponse struct {
+	Symbol   string
+	Interval string
+	Columns  []string
+	Candles  [][]interface{}
+}
+
+// Returns the first node for a read request, see queryHostsForRequest.
+func queryHostForRequest(r *http.Request, qm *QueryMessage) (string, int, error) {
+	hosts, network, err := queryHostsForRequest(r, qm)
+	if err != nil {
+		return "", 0, err
+	}
+	return hosts[0], network, nil
+}
+
+// Checks the user has PermissionRead and decodes the payload.
+func decodeReadRequest(w http.ResponseWriter, r *http.Request, payload interface{}) bool {
+	datastore, user, err := decodeRequestBasic(r, payload)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return false
+	}
+	u := datastore.GetUser(user)
+	if !u.HasPermission(PermissionRead) {
+		render.Render(w, r, ErrPermissionDenied())
+		return false
+	}
+	return true
+}
+
+func getTicker(client sdk.DexClient, host string, symbol string) (*Ticker, error) {
+	key := host + "/" + symbol
+	if cached, ok := tickerCache.Get(key); ok {
+		t := cached.(Ticker)
+		return &t, nil
+	}
+
+	base, quote := splitPairSymbol(symbol)
+	tickers, err := client.GetTicker24h(types.NewTicker24hQuery().WithSymbol(base, quote))
+	if err != nil {
+		return nil, err
+	}
+	if len(tickers) == 0 {
+		return nil, errors.New("No ticker found for symbol: " + symbol)
+	}
+	t := Ticker{
+		Symbol:             tickers[0].Symbol,
+		LastPrice:          tickers[0].LastPrice,
+		HighPrice:          tickers[0].HighPrice,
+		LowPrice:           tickers[0].LowPrice,
+		Volume:             tickers[0].Volume,
+		PriceChange:        tickers[0].PriceChange,
+		PriceChangePercent: tickers[0].PriceChangePercent,
+	}
+	tickerCache.Set(key, t)
+	return &t, nil
+}
+
+func getTickerHandler(w http.ResponseWriter, r *http.Request) {
+	data := &TickerMessage{}
+	if !decodeReadRequest(w, r, data) {
+		return
+	}
+
+	if len(data.Symbols) == 0 {
+		render.Render(w, r, ErrInvalidRequest(errors.New("No symbols supplied.")))
+		return
+	}
+	if len(data.Symbols) > MaxTickerSymbols {
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("At most %d symbols can be requested.", MaxTickerSymbols)))
+		return
+	}
+	for _, s := range data.Symbols {
+		if !pairSymbolRegexp.MatchString(s) {
+			render.Render(w, r, ErrInvalidRequest(errors.New("Invalid symbol: "+s)))
+			return
+		}
+	}
+
+	hosts, network, err := queryHostsForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	tr := TickersResponse{}
+	err = queryWithFailover(w, hosts, func(host string) error {
+		client, err := newQueryClient(host, network)
+		if err != nil {
+			return err
+		}
+		tr.Tickers = []Ticker{}
+		for _, s := range data.Symbols {
+			t, err := getTicker(client, host, s)
+			if err != nil {
+				return err
+			}
+			tr.Tickers = append(tr.Tickers, *t)
+		}
+		return nil
+	})
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeTickers, tr)
+}
+
+func isKlineInterval(interval string) bool {
+	for _, i := range KlineIntervals {
+		if i == interval {
+			return true
+		}
+	}
+	return false
+}
+
+func getKlinesHandler(w http.ResponseWriter, r *http.Request) {
+	data := &KlinesMessage{}
+	if !decodeReadRequest(w, r, data) {
+		return
+	}
+
+	if !pairSymbolRegexp.MatchString(data.Symbol) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Invalid symbol: "+data.Symbol)))
+		return
+	}
+	if !isKlineInterval(data.Interval) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Unsupported interval: "+data.Interval)))
+		return
+	}
+	if data.Limit == 0 || data.Limit > MaxKlines {
+		data.Limit = MaxKlines
+	}
+	if data.StartTime < 0 || data.EndTime < 0 || (data.EndTime > 0 && data.StartTime > data.EndTime) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Invalid time range.")))
+		return
+	}
+
+	hosts, network, err := queryHostsForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	base, quote := splitPairSymbol(data.Symbol)
+	query := types.NewKlineQuery(base, quote, data.Interval).WithLimit(data.Limit)
+	if data.StartTime > 0 {
+		query = query.WithStartTime(data.StartTime)
+	}
+	if data.EndTime > 0 {
+		query = query.WithEndTime(data.EndTime)
+	}
+	var klines []types.Kline
+	err = queryWithFailover(w, hosts, func(host string) error {
+		client, err := newQueryClient(host, network)
+		if err != nil {
+			return err
+		}
+		klines, err = client.GetKlines(query)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	kr := KlinesResponse{
+		Symbol:   data.Symbol,
+		Interval: data.Interval,
+		Columns:  KlineColumns,
+		Candles:  [][]interface{}{},
+	}
+	for i, k := range klines {
+		if i >= MaxKlines {
+			break
+		}
+		kr.Candles = append(kr.Candles, []interface{}{k.OpenTime, k.Open, k.High, k.Low, k.Close, k.Volume, k.CloseTime})
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeKlines, kr)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"github.com/go-chi/render"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// The node returns at most this many unconfirmed transactions
+const mempoolQueryLimit = 1000
+
+type MempoolMessage struct {
+	QueryMessage
+	Wallet string
+}
+
+type MempoolResponse struct {
+	Wallet  string
+	Address string
+	// Transactions of the wallet waiting to be included in a block
+	Pending int
+	Hashes  []string
+}
+
+// Result of the unconfirmed_txs RPC of Tendermint
+type unconfirmedTxs struct {
+	Result struct {
+		Txs []string `json:"txs"`
+	} `json:"result"`
+}
+
+var errMempoolUnsupported = &RequestError{
+	HTTPStatusCode: http.StatusNotImplemented,
+	StatusText:     "Not supported.",
+	AppCode:        ErrorCodeNotSupported,
+	Err:            errors.New("The node does not expose its unconfirmed transactions."),
+}
+
+// Fetches the unconfirmed transactions of the node. Only full nodes
+// serving the Tendermint RPC expose them, API servers do not.
+func getUnconfirmedTxs(host string) ([][]byte, error) {
+	resp, err := historyHttpClient.Get(fmt.Sprintf("https://%s/unconfirmed_txs?limit=%d", host, mempoolQueryLimit))
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errMempoolUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Mempool query failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	result := unconfirmedTxs{}
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return nil, errMempoolUnsupported
+	}
+	txs := [][]byte{}
+	for _, encoded := range result.Result.Txs {
+		bz, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, bz)
+	}
+	return txs, nil
+}
+
+// Whether any message of the transaction is signed by the address.
+// Transactions that can not be decoded are skipped.
+func txSignedBy(bz []byte, addr types.AccAddress) bool {
+	var stdTx tx.StdTx
+	if tx.Cdc.UnmarshalBinaryLengthPrefixed(bz, &stdTx) != nil {
+		return false
+	}
+	for _, m := range stdTx.Msgs {
+		for _, signer := range m.GetSigners() {
+			if bytes.Equal(signer, addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reports the transactions of the wallet in the mempool of the node,
+// so clients can wait for them before signing with the next sequence.
+func getMempoolHandler(w http.ResponseWriter, r *http.Request) {
+	data := &MempoolMessage{}
+	_, _, keyManager, err := decodeRequest(r, data, PermissionRead)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	hosts, network, err := queryHostsForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	address, err := addressForNetwork(keyManager.GetAddr(), network)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	var txs [][]byte
+	err = queryWithFailover(w, hosts, func(host string) error {
+		var err error
+		txs, err = getUnconfirmedTxs(host)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	response := MempoolResponse{Wallet: data.Wallet, Address: address, Hashes: []string{}}
+	for _, bz := range txs {
+		if txSignedBy(bz, keyManager.GetAddr()) {
+			sum := sha256.Sum256(bz)
+			response.Hashes = append(response.Hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+		}
+	}
+	response.Pending = len(response.Hashes)
+	WriteTypedResponse(w, r, ResponseTypeMempool, response)
+}
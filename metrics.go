@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds of the broadcast latency buckets in seconds. Broadcasts
+// in block mode wait for confirmations, hence the long tail.
+var broadcastLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// A metric in the Prometheus text format.
+type metric interface {
+	write(b *strings.Builder)
+}
+
+// Collectors served by /metrics, in order of registration.
+var metricsRegistry = []metric{}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+metricLabelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+extra[i+1]+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// A counter per combination of label values.
+type counterVec struct {
+	sync.Mutex
+	name   string
+	help   string
+	labels []string
+	values map[string]uint64
+}
+
+func newCounterVec(name string, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: map[string]uint64{}}
+}
+
+func (c *counterVec) Inc(values ...string) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[strings.Join(values, "\x00")]++
+}
+
+func (c *counterVec) write(b *strings.Builder) {
+	c.Lock()
+	defer c.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := []string{}
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(b, "%s%s %d\n", c.name, formatLabels(c.labels, strings.Split(key, "\x00")), c.values[key])
+	}
+}
+
+type histogramSeries struct {
+	// Observations per bucket, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// A histogram per combination of label values.
+type histogramVec struct {
+	sync.Mutex
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+func newHistogramVec(name string, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+}
+
+func (h *histogramVec) Observe(value float64, values ...string) {
+	h.Lock()
+	defer h.Unlock()
+	key := strings.Join(values, "\x00")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *histogramVec) write(b *strings.Builder) {
+	h.Lock()
+	defer h.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := []string{}
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := strings.Split(key, "\x00")
+		s := h.series[key]
+		var cumulative uint64 = 0
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", strconv.FormatFloat(bound, 'g', -1, 64)), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values), strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), s.count)
+	}
+}
+
+var signedTxMetric = newCounterVec("dexvault_signed_transactions_total", "Transactions signed, by action.", "action")
+var broadcastMetric = newCounterVec("dexvault_broadcasts_total", "Broadcasts of signed transactions, by network and result.", "network", "result")
+var broadcastLatencyMetric = newHistogramVec("dexvault_broadcast_duration_seconds", "Duration of broadcasts including failover, retries and waiting for confirmations.", broadcastLatencyBuckets, "network")
+var authFailureMetric = newCounterVec("dexvault_auth_failures_total", "Requests rejected by authentication, by reason.", "reason")
+
+// Reasons of authentication failures
+const AuthFailureIP = "ip"
+const AuthFailureToken = "token"
+const AuthFailureTokenExpired = "token_expired"
+
+// Registers the collectors, called once at startup.
+func registerMetrics() {
+	metricsRegistry = []metric{signedTxMetric, broadcastMetric, broadcastLatencyMetric, authFailureMetric}
+}
+
+// Records a broadcast in the metrics. Transactions the node rejected
+// count as failed.
+func observeBroadcast(network int, start time.Time, br *BroadcastResponse, err error) {
+	name, ok := networkName(network)
+	if !ok {
+		name = strconv.Itoa(network)
+	}
+	result := "ok"
+	if err != nil {
+		result = "fail"
+	} else {
+		for _, r := range br.Results {
+			if !r.Ok {
+				result = "fail"
+			}
+		}
+	}
+	broadcastMetric.Inc(name, result)
+	broadcastLatencyMetric.Observe(time.Since(start).Seconds(), name)
+}
+
+// Serves the metrics in the Prometheus text format. Requires no
+// token, the metrics contain no wallet names or addresses.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	b := &strings.Builder{}
+	for _, m := range metricsRegistry {
+		m.write(b)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
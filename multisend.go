@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+// Maximum recipients of a multisend
+const MaxMultiSendOutputs = 1000
+
+type MultiSendOutput struct {
+	Address types.AccAddress
+	Coins   types.Coins
+}
+
+type MultiSend struct {
+	SignedMessage
+	Outputs []MultiSendOutput
+	// Optional sum of all outputs, checked before signing
+	Total types.Coins
+	// Defaults to the default memo of the wallet
+	Memo *string
+	// Skip checking whether recipients require a memo
+	SkipMemoCheck bool
+}
+
+func (ms *MultiSend) Validate() error {
+	if len(ms.Outputs) == 0 || len(ms.Outputs) > MaxMultiSendOutputs {
+		return fmt.Errorf("Between 1 and %d outputs can be sent.", MaxMultiSendOutputs)
+	}
+	for i, o := range ms.Outputs {
+		if len(o.Address) == 0 {
+			return fmt.Errorf("Output %d has no address.", i)
+		}
+		if len(o.Coins) == 0 {
+			return fmt.Errorf("Output %d has no coins.", i)
+		}
+		for _, c := range o.Coins {
+			if c.Amount <= 0 {
+				return fmt.Errorf("Output %d: amount of %s must be positive.", i, c.Denom)
+			}
+		}
+		// The chain only accepts sorted coins without duplicates.
+		ms.Outputs[i].Coins = o.Coins.Sort()
+		if !ms.Outputs[i].Coins.IsValid() {
+			return fmt.Errorf("Output %d lists a symbol more than once.", i)
+		}
+	}
+	if len(ms.Total) > 0 {
+		sum := types.Coins{}
+		for _, o := range ms.Outputs {
+			sum = sum.Plus(o.Coins)
+		}
+		if !sum.IsEqual(ms.Total.Sort()) {
+			return fmt.Errorf("The outputs add up to %v, not to the Total %v.", sum, ms.Total)
+		}
+	}
+	return nil
+}
+
+func (ms *MultiSend) Transfers() []msg.Transfer {
+	transfers := []msg.Transfer{}
+	for _, o := range ms.Outputs {
+		transfers = append(transfers, msg.Transfer{ToAddr: o.Address, Coins: o.Coins})
+	}
+	return transfers
+}
+
+// Signs a single send message with one output per recipient.
+func createSignedMultiSendMsg(keyManager keys.KeyManager, ms *MultiSend) ([]byte, error) {
+	st := &SendToken{
+		SignedMessage: ms.SignedMessage,
+		Transfers:     ms.Transfers(),
+		Memo:          ms.Memo,
+	}
+	return createSignedSendTokenMsg(keyManager, st)
+}
+
+func multiSendHandler(w http.ResponseWriter, r *http.Request) {
+	data := &MultiSend{}
+	datastore, _, keyManager, err := decodeRequest(r, data, PermissionMultiSend)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	err = data.Validate()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	st := &SendToken{SignedMessage: data.SignedMessage, Memo: data.Memo}
+	err = applyDefaultMemo(datastore, st)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	data.Memo = st.Memo
+	if data.BroadcastHost != "" && !data.SkipMemoCheck && memoText(data.Memo) == "" {
+		client, err := newQueryClient(data.BroadcastHost, data.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		err = checkMemoRequired(client, memoText(data.Memo), data.Transfers())
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if requireApprovals(w, r, PermissionMultiSend, transferApprovals(GetRequestConfig(r), PermissionMultiSend, data.Transfers())) {
+		return
+	}
+	if e := checkSpendingLimit(r, GetRequestConfig(r), datastore, data.Wallet, data.Transfers()); e != nil {
+		render.Render(w, r, ErrLimitExceeded(e))
+		return
+	}
+
+	hexTx, err := createSignedMultiSendMsg(keyManager, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	writeSignedResponse(w, r, keyManager, PermissionMultiSend, &data.SignedMessage, hexTx)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+)
+
+func multiSendPayload(outputs ...MultiSendOutput) *MultiSend {
+	ms := &MultiSend{Outputs: outputs, SkipMemoCheck: true}
+	ms.Wallet = "hot"
+	ms.ChainId = "Binance-Chain-Test"
+	ms.Sequence = 1
+	return ms
+}
+
+func testOutput(address string, coins ...types.Coin) MultiSendOutput {
+	to, _ := types.AccAddressFromHex(strings.Repeat(address, 20))
+	return MultiSendOutput{Address: to, Coins: coins}
+}
+
+func TestMultiSendSignsOneMessage(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	ms := multiSendPayload(testOutput("02", types.Coin{Denom: "BNB", Amount: 100}), testOutput("03", types.Coin{Denom: "BNB", Amount: 200}))
+	ms.Total = types.Coins{{Denom: "BNB", Amount: 300}}
+
+	r := testRequest("POST", "/v1/token/multisend", "alice", ms, datastore, cfg)
+	w := serveSigning(multiSendHandler, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	summary, err := decodeSignedTx(signedTx(t, w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Messages) != 1 || len(summary.Messages[0].Outputs) != 2 {
+		t.Fatalf("signed %v, want one message with 2 outputs", summary.Messages)
+	}
+	for i, o := range summary.Messages[0].Outputs {
+		if o.To != ms.Outputs[i].Address.String() || !o.Coins.IsEqual(ms.Outputs[i].Coins) {
+			t.Errorf("output %d is %v, want %v", i, o, ms.Outputs[i])
+		}
+	}
+	if spent(datastore) != 300 {
+		t.Errorf("spent %d, want 300", spent(datastore))
+	}
+}
+
+func TestMultiSendValidate(t *testing.T) {
+	bnb := types.Coin{Denom: "BNB", Amount: 100}
+	mismatch := multiSendPayload(testOutput("02", bnb))
+	mismatch.Total = types.Coins{{Denom: "BNB", Amount: 101}}
+	for name, ms := range map[string]*MultiSend{
+		"no outputs":     multiSendPayload(),
+		"no address":     multiSendPayload(MultiSendOutput{Coins: types.Coins{bnb}}),
+		"no coins":       multiSendPayload(testOutput("02")),
+		"negative":       multiSendPayload(testOutput("02", types.Coin{Denom: "BNB", Amount: -1})),
+		"duplicate coin": multiSendPayload(testOutput("02", bnb, bnb)),
+		"total mismatch": mismatch,
+	} {
+		if ms.Validate() == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	ms := multiSendPayload(testOutput("02", types.Coin{Denom: "XYZ", Amount: 1}, bnb))
+	ms.Total = types.Coins{bnb, {Denom: "XYZ", Amount: 1}}
+	if err := ms.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ms.Outputs[0].Coins[0].Denom != "BNB" {
+		t.Errorf("coins %v not sorted", ms.Outputs[0].Coins)
+	}
+}
+
+func TestMultiSendRequiresPermission(t *testing.T) {
+	cfg, datastore := limitsTest(t, 1000)
+	datastore.Users[0].Permissions = []Permission{PermissionSendToken}
+	r := testRequest("POST", "/v1/token/multisend", "alice", multiSendPayload(testOutput("02", types.Coin{Denom: "BNB", Amount: 1})), datastore, cfg)
+	if w := serveSigning(multiSendHandler, r); w.Code == http.StatusOK {
+		t.Errorf("multisend without PermissionMultiSend returned status %d", w.Code)
+	}
+}
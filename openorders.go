@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+// The node returns at most this many open orders per query
+const MaxOpenOrders = 1000
+
+type OpenOrdersMessage struct {
+	BasicMessage
+	QueryMessage
+	// Optional, only orders of this pair, e.g. BTCB-1DE_BNB
+	Symbol string
+}
+
+// An open order, amounts in the smallest unit (1e-8). RefId is the ID
+// to cancel the order with.
+type OpenOrder struct {
+	RefId  string
+	Symbol string
+	// 1 is buy, 2 is sell
+	Side     int
+	Price    int64
+	Quantity int64
+	Filled   int64
+	// Set if the order was created with a ClientOrderId
+	ClientOrderId string `json:",omitempty"`
+	Created       string
+}
+
+type OpenOrdersResponse struct {
+	Wallet  string
+	Address string
+	Orders  []OpenOrder
+	// Open orders on the node, more than Orders if there are more than
+	// MaxOpenOrders
+	Total int
+}
+
+// Maps the order IDs of the wallet to their ClientOrderId.
+func (b *DexVaultDatastore) clientOrderIds(wallet string) map[string]string {
+	clientOrdersMutex.Lock()
+	defer clientOrdersMutex.Unlock()
+	b.pruneClientOrders()
+	ids := map[string]string{}
+	for _, o := range b.ClientOrders {
+		if o.Wallet == wallet {
+			ids[o.OrderId] = o.ClientOrderId
+		}
+	}
+	return ids
+}
+
+func toOpenOrder(o types.Order, clientOrderIds map[string]string) (OpenOrder, error) {
+	price, err := types.Fixed8DecodeString(o.Price)
+	if err != nil {
+		return OpenOrder{}, err
+	}
+	quantity, err := types.Fixed8DecodeString(o.Quantity)
+	if err != nil {
+		return OpenOrder{}, err
+	}
+	filled, err := types.Fixed8DecodeString(o.CumulateQuantity)
+	if err != nil {
+		return OpenOrder{}, err
+	}
+	return OpenOrder{
+		RefId:         o.ID,
+		Symbol:        o.Symbol,
+		Side:          o.Side,
+		Price:         price.ToInt64(),
+		Quantity:      quantity.ToInt64(),
+		Filled:        filled.ToInt64(),
+		ClientOrderId: clientOrderIds[o.ID],
+		Created:       o.OrderCreateTime,
+	}, nil
+}
+
+// Lists the open orders of a wallet, e.g. to look up the RefId to
+// cancel an order with.
+func getOpenOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	data := &OpenOrdersMessage{}
+	datastore, _, keyManager, err := decodeRequest(r, data, PermissionRead)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if data.Symbol != "" && !pairSymbolRegexp.MatchString(data.Symbol) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Invalid symbol: "+data.Symbol)))
+		return
+	}
+	hosts, network, err := queryHostsForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	address, err := addressForNetwork(keyManager.GetAddr(), network)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	query := types.NewOpenOrdersQuery(address, true).WithLimit(MaxOpenOrders)
+	if data.Symbol != "" {
+		query = query.WithSymbol(data.Symbol)
+	}
+	var orders *types.OpenOrders
+	err = queryWithFailover(w, hosts, func(host string) error {
+		client, err := newQueryClient(host, network)
+		if err != nil {
+			return err
+		}
+		orders, err = client.GetOpenOrders(query)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	clientOrderIds := datastore.clientOrderIds(data.Wallet)
+	response := OpenOrdersResponse{Wallet: data.Wallet, Address: address, Orders: []OpenOrder{}, Total: orders.Total}
+	for _, o := range orders.Order {
+		// Also filtered here, in case the node ignores the symbol.
+		if data.Symbol != "" && o.Symbol != data.Symbol {
+			continue
+		}
+		order, err := toOpenOrder(o, clientOrderIds)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		response.Orders = append(response.Orders, order)
+	}
+	WriteTypedResponse(w, r, ResponseTypeOpenOrders, response)
+}
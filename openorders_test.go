@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+)
+
+func openOrdersRequest(datastore *DexVaultDatastore, user string, symbol string) *http.Request {
+	data := &OpenOrdersMessage{QueryMessage: QueryMessage{QueryHost: "orders.test", QueryNetwork: int(types.TestNetwork)}, Symbol: symbol}
+	data.Wallet = "mnemonic"
+	return testRequest("POST", "/v1/order/open", user, data, datastore, &DexVaultConfiguration{})
+}
+
+func TestOpenOrdersHandler(t *testing.T) {
+	datastore := testDatastore()
+	datastore.Users = append(datastore.Users, &DexVaultAuth{Name: "bob", Permissions: []Permission{PermissionCancelOrder}})
+	keyManager, err := datastore.GetWallet("mnemonic").GetKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := addressForNetwork(keyManager.GetAddr(), int(types.TestNetwork))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &testDexClient{OpenOrders: []types.Order{
+		{ID: "ORDER-1", Symbol: "XYZ-000_BNB", Side: 1, Price: "1.5", Quantity: "10.00000000", CumulateQuantity: "2.25000000", OrderCreateTime: "2020-01-01T00:00:00Z"},
+		{ID: "ORDER-2", Symbol: "ABC-111_BNB", Side: 2, Price: "0.00000001", Quantity: "1", CumulateQuantity: "0"},
+	}}
+	defer useQueryClient(client)()
+
+	for symbol, want := range map[string][]OpenOrder{
+		"": {
+			{RefId: "ORDER-1", Symbol: "XYZ-000_BNB", Side: 1, Price: 150000000, Quantity: 1000000000, Filled: 225000000, Created: "2020-01-01T00:00:00Z"},
+			{RefId: "ORDER-2", Symbol: "ABC-111_BNB", Side: 2, Price: 1, Quantity: 100000000},
+		},
+		"ABC-111_BNB": {{RefId: "ORDER-2", Symbol: "ABC-111_BNB", Side: 2, Price: 1, Quantity: 100000000}},
+	} {
+		w := serveSigning(getOpenOrdersHandler, openOrdersRequest(datastore, "alice", symbol))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: status %d: %s", symbol, w.Code, w.Body.String())
+		}
+		query := client.Queries[len(client.Queries)-1]
+		if query.SenderAddress != address || query.Symbol != symbol {
+			t.Errorf("queried %s for %q, want %s for %q", query.SenderAddress, query.Symbol, address, symbol)
+		}
+		response := struct {
+			Type ResponseType
+			Data OpenOrdersResponse
+		}{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders := response.Data.Orders
+		if response.Type != ResponseTypeOpenOrders || response.Data.Address != address || len(orders) != len(want) {
+			t.Errorf("%q: response %s, want %d orders", symbol, w.Body.String(), len(want))
+			continue
+		}
+		for i := range want {
+			if orders[i] != want[i] {
+				t.Errorf("%q: order %+v, want %+v", symbol, orders[i], want[i])
+			}
+		}
+	}
+
+	queries := len(client.Queries)
+	for _, test := range []struct {
+		user   string
+		symbol string
+		code   ErrorCode
+	}{
+		{"bob", "XYZ-000_BNB", ErrorCodePermissionDenied},
+		{"alice", "not a symbol", ErrorCodeInvalidPayload},
+	} {
+		w := serveSigning(getOpenOrdersHandler, openOrdersRequest(datastore, test.user, test.symbol))
+		if errorCode(t, w) != test.code {
+			t.Errorf("%s for %q: %s, want code %s", test.user, test.symbol, w.Body.String(), test.code)
+		}
+	}
+	if len(client.Queries) != queries {
+		t.Errorf("%d queries for rejected requests", len(client.Queries)-queries)
+	}
+}
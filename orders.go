@@ -0,0 +1,321 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/go-chi/render"
+	"math"
+	"math/big"
+	"net/http"
+)
+
+type ReplaceOrderResponse struct {
+	CancelTx string
+	CreateTx string
+	// Only set if the transactions were broadcast
+	Cancel *BroadcastResponse `json:",omitempty"`
+	Create *BroadcastResponse `json:",omitempty"`
+}
+
+// Creates a client for querying a node.
+func newQueryClient(host string, network int) (sdk.DexClient, error) {
+	if host == "" {
+		return nil, errors.New("No host to query supplied.")
+	}
+	err := validateBroadcastHost(host)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newDexClient(host, types.ChainNetwork(network), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create a client for host %s: %s", host, err)
+	}
+	return client, nil
+}
+
+func isOrderOpen(client sdk.DexClient, keyManager keys.KeyManager, symbol string, id string) (bool, error) {
+	query := types.NewOpenOrdersQuery(keyManager.GetAddr().String(), false).WithSymbol(symbol)
+	orders, err := client.GetOpenOrders(query)
+	if err != nil {
+		return false, err
+	}
+	for _, o := range orders.Order {
+		if o.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Returns an error unless the wallet has an open order with the ID.
+func checkOrderOpen(client sdk.DexClient, keyManager keys.KeyManager, symbol string, id string) error {
+	open, err := isOrderOpen(client, keyManager, symbol, id)
+	if err != nil {
+		return err
+	}
+	if !open {
+		return errors.New("No open order found with ID: " + id)
+	}
+	return nil
+}
+
+func getTradingPair(client sdk.DexClient, base string, quote string) (*types.TradingPair, error) {
+	markets, err := client.GetMarkets(types.NewMarketsQuery().WithLimit(1000))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range markets {
+		if m.BaseAssetSymbol == base && m.QuoteAssetSymbol == quote {
+			return &m, nil
+		}
+	}
+	return nil, errors.New("Unknown market: " + base + "_" + quote)
+}
+
+// Checks price and quantity against the tick and lot size of the market.
+func checkTickAndLot(pair *types.TradingPair, price int64, quantity int64) error {
+	tick := pair.TickSize.ToInt64()
+	lot := pair.LotSize.ToInt64()
+	if tick > 0 && price%tick != 0 {
+		return fmt.Errorf("Price %d is not a multiple of the tick size %d.", price, tick)
+	}
+	if lot > 0 && quantity%lot != 0 {
+		return fmt.Errorf("Quantity %d is not a multiple of the lot size %d.", quantity, lot)
+	}
+	return nil
+}
+
+// Returns price * quantity in the smallest unit. Both are given with
+// 8 implied decimals, so the product is scaled back by 1e8.
+func orderNotional(price int64, quantity int64) *big.Int {
+	n := new(big.Int).Mul(big.NewInt(price), big.NewInt(quantity))
+	return n.Div(n, big.NewInt(1e8))
+}
+
+// Rejects orders below the configured minimum notional of the quote
+// asset. The node does not report a minimum, so unconfigured quote
+// assets are not checked.
+func checkMinNotional(cfg *DexVaultConfiguration, quote string, price int64, quantity int64) error {
+	min, ok := cfg.MinNotionals[quote]
+	if !ok || min <= 0 {
+		return nil
+	}
+	notional := orderNotional(price, quantity)
+	if notional.Cmp(big.NewInt(min)) < 0 {
+		return fmt.Errorf("Order notional %s is below the minimum of %d %s.", notional.String(), min, quote)
+	}
+	return nil
+}
+
+// Deployment policy rejecting orders whose price deviates too far
+// from the last price of the market. Deviations are in percent,
+// symbols are pairs such as "XYZ-000_BNB". Zero disables the check.
+type PriceDeviationPolicy struct {
+	MaxPercent float64            `yaml:"max_percent"`
+	Symbols    map[string]float64 `yaml:"symbols"`
+}
+
+func (p *PriceDeviationPolicy) Validate() error {
+	if p.MaxPercent < 0 {
+		return errors.New("max_percent must not be negative.")
+	}
+	for symbol, max := range p.Symbols {
+		if max < 0 {
+			return errors.New("The deviation of " + symbol + " must not be negative.")
+		}
+	}
+	return nil
+}
+
+// Maximum deviation for the symbol, the override if there is one.
+func (p *PriceDeviationPolicy) MaxDeviation(symbol string) float64 {
+	if max, ok := p.Symbols[symbol]; ok {
+		return max
+	}
+	return p.MaxPercent
+}
+
+// Rejects orders whose price deviates from the last price of the
+// market by more than price_deviation allows. The ticker is queried
+// from the broadcast host of the request, or the configured hosts.
+func checkPriceDeviation(w http.ResponseWriter, r *http.Request, sm *SignedMessage, symbol string, price int64) error {
+	max := GetRequestConfig(r).PriceDeviation.MaxDeviation(symbol)
+	if max <= 0 {
+		return nil
+	}
+	qm := &QueryMessage{QueryHost: sm.BroadcastHost, QueryNetwork: sm.BroadcastNetwork, QueryHosts: sm.BroadcastHosts}
+	hosts, network, err := queryHostsForRequest(r, qm)
+	if err != nil {
+		return err
+	}
+	var ticker *Ticker
+	err = queryWithFailover(w, hosts, func(host string) error {
+		client, err := newQueryClient(host, network)
+		if err != nil {
+			return err
+		}
+		ticker, err = getTicker(client, host, symbol)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Could not check the price deviation: %s", err)
+	}
+	last, err := types.Fixed8DecodeString(ticker.LastPrice)
+	if err != nil || last.ToInt64() <= 0 {
+		return errors.New("No last price of " + symbol + " to check the price deviation against, set SkipPriceCheck to sign anyway.")
+	}
+	reference := last.ToInt64()
+	deviation := math.Abs(float64(price-reference)) * 100 / float64(reference)
+	if deviation > max {
+		return codedError(ErrorCodePolicyViolation, fmt.Errorf("Price %d deviates %.2f%% from the last price %d of %s, at most %.2f%% are allowed.", price, deviation, reference, symbol, max))
+	}
+	return nil
+}
+
+// Cancels an order and creates a new one. Binance Chain only supports
+// one message per transaction, so two transactions are signed: the
+// cancel with Sequence and the create with Sequence+1. If a broadcast
+// host is supplied both are validated against the node and broadcast
+// back-to-back.
+func replaceOrderHandler(w http.ResponseWriter, r *http.Request) {
+	data := &ReplaceOrder{}
+	datastore, user, keyManager, err := decodeRequest(r, data, PermissionCancelOrder)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if !datastore.IsPermitted(user, data.Wallet, PermissionCreateOrder) {
+		render.Render(w, r, ErrInvalidRequest(denialError(r, codedError(ErrorCodePermissionDenied, errors.New("Not permitted.")))))
+		return
+	}
+
+	action := PermissionCreateOrder
+	cfg := GetRequestConfig(r)
+	if !data.SkipNotionalCheck {
+		err = checkMinNotional(cfg, data.QuoteAssetSymbol, data.Price, data.Quantity)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if !data.SkipPriceCheck {
+		symbol := (&CreateOrder{BaseAssetSymbol: data.BaseAssetSymbol, QuoteAssetSymbol: data.QuoteAssetSymbol}).CombinedSymbol()
+		err = checkPriceDeviation(w, r, &data.SignedMessage, symbol, data.Price)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if cfg.ApprovalThresholds[PermissionCancelOrder] > cfg.ApprovalThresholds[action] {
+		action = PermissionCancelOrder
+	}
+	if requireApproval(w, r, action) {
+		return
+	}
+
+	cancel := &CancelOrder{
+		SignedMessage:    data.SignedMessage,
+		BaseAssetSymbol:  data.BaseAssetSymbol,
+		QuoteAssetSymbol: data.QuoteAssetSymbol,
+		RefId:            data.RefId,
+	}
+	create := &CreateOrder{
+		SignedMessage:    data.SignedMessage,
+		BaseAssetSymbol:  data.BaseAssetSymbol,
+		QuoteAssetSymbol: data.QuoteAssetSymbol,
+		Op:               data.Op,
+		Price:            data.Price,
+		Quantity:         data.Quantity,
+	}
+	create.Sequence = data.Sequence + 1
+
+	if data.BroadcastHost != "" {
+		err = checkWalletNetwork(datastore, data.Wallet, data.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeNetworkMismatch, err)))
+			return
+		}
+		client, err := newQueryClient(data.BroadcastHost, data.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		err = checkOrderOpen(client, keyManager, cancel.CombinedSymbol(), data.RefId)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		pair, err := getTradingPair(client, data.BaseAssetSymbol, data.QuoteAssetSymbol)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		err = checkTickAndLot(pair, data.Price, data.Quantity)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+
+	cancelTx, err := createSignedCancelOrderMsg(keyManager, cancel)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	createTx, err := createSignedCreateOrderMessage(keyManager, create)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	auditLog(r, "Signed order replacement with wallet "+data.Wallet)
+	err = recordSigning(r, data.Wallet, PermissionCancelOrder, cancelTx)
+	if err == nil {
+		err = recordSigning(r, data.Wallet, PermissionCreateOrder, createTx)
+	}
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	response := ReplaceOrderResponse{
+		CancelTx: string(cancelTx),
+		CreateTx: string(createTx),
+	}
+	if data.BroadcastHost != "" {
+		options, err := resolveBroadcastOptions(cfg, PermissionCreateOrder, &data.SignedMessage)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if options.Mode == BroadcastModeQueued {
+			options.Mode = BroadcastModeSync
+		}
+		response.Cancel, err = broadcastMessage(data.BroadcastHost, data.BroadcastNetwork, cancelTx, options)
+		signingEvent(r, data.Wallet, PermissionCancelOrder, cancelTx, data.BroadcastHost, broadcastOutcome(err), err)
+		if err == nil {
+			auditBroadcast(r, data.BroadcastHost, response.Cancel)
+		}
+		if err != nil {
+			signingEvent(r, data.Wallet, PermissionCreateOrder, createTx, "", SigningOutcomeSigned, nil)
+			render.Render(w, r, ErrInvalidRequest(broadcastError(err)))
+			return
+		}
+		response.Create, err = broadcastMessage(data.BroadcastHost, data.BroadcastNetwork, createTx, options)
+		signingEvent(r, data.Wallet, PermissionCreateOrder, createTx, data.BroadcastHost, broadcastOutcome(err), err)
+		if err == nil {
+			auditBroadcast(r, data.BroadcastHost, response.Create)
+		}
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(broadcastError(fmt.Errorf("Order was cancelled, but creating the new order failed: %s", err.Error()))))
+			return
+		}
+	} else {
+		signingEvent(r, data.Wallet, PermissionCancelOrder, cancelTx, "", SigningOutcomeSigned, nil)
+		signingEvent(r, data.Wallet, PermissionCreateOrder, createTx, "", SigningOutcomeSigned, nil)
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeReplaceOrder, response)
+}
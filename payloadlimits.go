@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/go-chi/render"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Walks the JSON tokens of the payload and rejects it if an array has
+// more than maxItems elements or values are nested deeper than
+// maxDepth. Nothing is allocated for the values themselves.
+func checkPayloadLimits(payload string, maxItems int, maxDepth int) error {
+	dec := json.NewDecoder(strings.NewReader(payload))
+	// Element counts of the open arrays, -1 for objects
+	counts := []int{}
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Malformed payloads are rejected by the handlers.
+			return nil
+		}
+
+		if len(counts) > 0 && counts[len(counts)-1] >= 0 {
+			if d, ok := token.(json.Delim); !ok || (d != ']' && d != '}') {
+				counts[len(counts)-1]++
+				if counts[len(counts)-1] > maxItems {
+					return fmt.Errorf("Payload contains an array with more than %d elements.", maxItems)
+				}
+			}
+		}
+
+		switch token {
+		case json.Delim('['):
+			counts = append(counts, 0)
+		case json.Delim('{'):
+			counts = append(counts, -1)
+		case json.Delim(']'), json.Delim('}'):
+			counts = counts[:len(counts)-1]
+		}
+		if len(counts) > maxDepth {
+			return fmt.Errorf("Payload is nested deeper than %d levels.", maxDepth)
+		}
+	}
+}
+
+// Rejects payloads exceeding max_payload_items or max_payload_depth
+// before they are decoded. Must run after the Authenticator.
+func PayloadLimits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, _ := jwtauth.FromContext(r.Context())
+		claims, ok := token.Claims.(jwt.MapClaims)
+		payload, hasPayload := claims["payload"].(string)
+		if ok && hasPayload {
+			cfg := GetRequestConfig(r)
+			err := checkPayloadLimits(payload, cfg.MaxPayloadItems, cfg.MaxPayloadDepth)
+			if err != nil {
+				fmt.Println("Rejected request of " + GetRequestUser(r) + ": " + err.Error())
+				render.Render(w, r, ErrInvalidRequest(err))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -5,15 +5,86 @@ type Permission string
 const PermissionAll Permission = "PermissionAll"
 const PermissionRead Permission = "PermissionRead"
 const PermissionCreateWallet Permission = "PermissionCreateWallet"
+const PermissionImportWallet Permission = "PermissionImportWallet"
+const PermissionDeleteWallet Permission = "PermissionDeleteWallet"
+const PermissionRenameWallet Permission = "PermissionRenameWallet"
+const PermissionExportWallet Permission = "PermissionExportWallet"
 const PermissionCreateOrder Permission = "PermissionCreateOrder"
 const PermissionCancelOrder Permission = "PermissionCancelOrder"
 const PermissionTokenBurn Permission = "PermissionTokenBurn"
 const PermissionDeposit Permission = "PermissionDeposit"
 const PermissionFreezeToken Permission = "PermissionFreezeToken"
 const PermissionIssueToken Permission = "PermissionIssueToken"
+const PermissionIssueMiniToken Permission = "PermissionIssueMiniToken"
+const PermissionSetTokenURI Permission = "PermissionSetTokenURI"
 const PermissionListPair Permission = "PermissionListPair"
 const PermissionMintToken Permission = "PermissionMintToken"
 const PermissionSendToken Permission = "PermissionSendToken"
+const PermissionMultiSend Permission = "PermissionMultiSend"
 const PermissionSubmitProposal Permission = "PermissionSubmitProposal"
 const PermissionUnfreezeToken Permission = "PermissionUnfreezeToken"
 const PermissionVoteProposal Permission = "PermissionVoteProposal"
+const PermissionHTLT Permission = "PermissionHTLT"
+const PermissionDepositHTLT Permission = "PermissionDepositHTLT"
+const PermissionClaimHTLT Permission = "PermissionClaimHTLT"
+const PermissionRefundHTLT Permission = "PermissionRefundHTLT"
+const PermissionApprove Permission = "PermissionApprove"
+const PermissionAdmin Permission = "PermissionAdmin"
+
+// Permissions that allow signing transactions with a wallet
+var SigningPermissions = []Permission{
+	PermissionCreateOrder,
+	PermissionCancelOrder,
+	PermissionTokenBurn,
+	PermissionDeposit,
+	PermissionFreezeToken,
+	PermissionIssueToken,
+	PermissionIssueMiniToken,
+	PermissionSetTokenURI,
+	PermissionListPair,
+	PermissionMintToken,
+	PermissionSendToken,
+	PermissionMultiSend,
+	PermissionSubmitProposal,
+	PermissionUnfreezeToken,
+	PermissionVoteProposal,
+	PermissionHTLT,
+	PermissionDepositHTLT,
+	PermissionClaimHTLT,
+	PermissionRefundHTLT,
+}
+
+// All permissions granted by PermissionAll
+var AllPermissions = append([]Permission{
+	PermissionRead,
+	PermissionCreateWallet,
+	PermissionImportWallet,
+	PermissionDeleteWallet,
+	PermissionRenameWallet,
+	PermissionApprove,
+	PermissionAdmin,
+}, SigningPermissions...)
+
+// Permissions that PermissionAll does not grant, they must be granted
+// explicitly
+var StrictPermissions = []Permission{
+	PermissionExportWallet,
+}
+
+func isStrictPermission(p Permission) bool {
+	for _, sp := range StrictPermissions {
+		if sp == p {
+			return true
+		}
+	}
+	return false
+}
+
+func isSigningPermission(p Permission) bool {
+	for _, sp := range SigningPermissions {
+		if sp == p {
+			return true
+		}
+	}
+	return false
+}
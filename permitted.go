@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+// Upper bound on the checks of one batch
+const MaxPermissionChecks = 1000
+
+type PermissionCheck struct {
+	Wallet string
+	Action Permission
+}
+
+type PermittedBatchMessage struct {
+	// Defaults to the user of the token, checking other users
+	// requires PermissionAdmin
+	User   string
+	Checks []PermissionCheck
+}
+
+type PermissionCheckResult struct {
+	PermissionCheck
+	Permitted bool
+	// Why the action is not permitted
+	Reason string `json:",omitempty"`
+	// Approvals needed before signing, see approval_thresholds
+	Approvals int `json:",omitempty"`
+}
+
+type PermittedBatchResponse struct {
+	User    string
+	Results []PermissionCheckResult
+}
+
+func isKnownPermission(p Permission) bool {
+	for _, known := range AllPermissions {
+		if known == p {
+			return true
+		}
+	}
+	return isStrictPermission(p)
+}
+
+// Evaluates many permission checks at once, e.g. to render a matrix of
+// actions and wallets. Checks that fail are reported per check, the
+// request itself only fails if it is malformed or not permitted.
+func permittedBatchHandler(w http.ResponseWriter, r *http.Request) {
+	data := &PermittedBatchMessage{}
+	datastore, user, err := decodeRequestBasic(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if len(data.Checks) == 0 || len(data.Checks) > MaxPermissionChecks {
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("Between 1 and %d checks can be evaluated.", MaxPermissionChecks)))
+		return
+	}
+	if data.User != "" && data.User != user {
+		u := datastore.GetUser(user)
+		if u == nil || !u.HasPermission(PermissionAdmin) {
+			render.Render(w, r, ErrPermissionDenied())
+			return
+		}
+		if datastore.GetUser(data.User) == nil {
+			render.Render(w, r, ErrInvalidRequest(errors.New("User not found.")))
+			return
+		}
+		user = data.User
+	}
+
+	cfg := GetRequestConfig(r)
+	generic := cfg.DenialDetail == DenialDetailGeneric
+	response := PermittedBatchResponse{User: user, Results: []PermissionCheckResult{}}
+	for _, check := range data.Checks {
+		result := PermissionCheckResult{PermissionCheck: check}
+		switch {
+		case !isKnownPermission(check.Action):
+			result.Reason = "Unknown action."
+		case datastore.GetWallet(check.Wallet) == nil:
+			result.Reason = "No matching wallet could be found."
+		case !datastore.IsPermitted(user, check.Wallet, check.Action):
+			result.Reason = "Not permitted."
+		default:
+			result.Permitted = true
+			result.Approvals = cfg.ApprovalThresholds[check.Action]
+		}
+		if !result.Permitted && generic {
+			result.Reason = errGenericDenial.Error()
+		}
+		response.Results = append(response.Results, result)
+	}
+	WriteTypedResponse(w, r, ResponseTypePermittedBatch, response)
+}
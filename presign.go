@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+// Upper bound on the transactions pre-signed by one request
+const MaxPresignTransactions = 100
+
+type PresignItem struct {
+	Action Permission
+	// Payload of the action's endpoint. Its signing fields are
+	// ignored, they are taken from the enclosing request.
+	Payload json.RawMessage
+}
+
+type Presign struct {
+	SignedMessage
+	Transactions []PresignItem
+}
+
+type PresignedTx struct {
+	Sequence int64
+	Action   Permission
+	Tx       string
+}
+
+type PresignResponse struct {
+	Wallet       string
+	Transactions []PresignedTx
+}
+
+// Signs a single pre-signed transaction. Only actions that can be
+// validated without a node are supported.
+func presignTransaction(cfg *DexVaultConfiguration, datastore *DexVaultDatastore, keyManager keys.KeyManager, sm SignedMessage, item PresignItem) ([]byte, error) {
+	switch item.Action {
+	case PermissionCreateOrder:
+		data := &CreateOrder{}
+		if err := json.Unmarshal(item.Payload, data); err != nil {
+			return nil, err
+		}
+		if data.ClientOrderId != "" {
+			return nil, errors.New("ClientOrderId is not supported for pre-signed orders.")
+		}
+		if !data.SkipNotionalCheck {
+			if err := checkMinNotional(cfg, data.QuoteAssetSymbol, data.Price, data.Quantity); err != nil {
+				return nil, err
+			}
+		}
+		data.SignedMessage = sm
+		return createSignedCreateOrderMessage(keyManager, data)
+	case PermissionCancelOrder:
+		data := &CancelOrder{}
+		if err := json.Unmarshal(item.Payload, data); err != nil {
+			return nil, err
+		}
+		if data.RefId == "" {
+			return nil, errors.New("Pre-signed cancels require a RefId.")
+		}
+		data.SignedMessage = sm
+		return createSignedCancelOrderMsg(keyManager, data)
+	case PermissionSendToken:
+		data := &SendToken{}
+		if err := json.Unmarshal(item.Payload, data); err != nil {
+			return nil, err
+		}
+		data.SignedMessage = sm
+		if err := applyDefaultMemo(datastore, data); err != nil {
+			return nil, err
+		}
+		return createSignedSendTokenMsg(keyManager, data)
+	case PermissionTokenBurn:
+		data := &TokenBurn{}
+		if err := json.Unmarshal(item.Payload, data); err != nil {
+			return nil, err
+		}
+		data.SignedMessage = sm
+		return createSignedTokenBurnMsg(keyManager, data)
+	case PermissionFreezeToken:
+		data := &FreezeToken{}
+		if err := json.Unmarshal(item.Payload, data); err != nil {
+			return nil, err
+		}
+		data.SignedMessage = sm
+		return createSignedFreezeTokenMsg(keyManager, data)
+	case PermissionUnfreezeToken:
+		data := &UnfreezeToken{}
+		if err := json.Unmarshal(item.Payload, data); err != nil {
+			return nil, err
+		}
+		data.SignedMessage = sm
+		return createUnfreezeTokenMsg(keyManager, data)
+	}
+	return nil, errors.New("Action can not be pre-signed: " + string(item.Action))
+}
+
+// Signs the transactions with the sequences Sequence, Sequence + 1,
+// ... so they can be broadcast later. The chain only accepts them in
+// order, so either all transactions are signed or none.
+func presignHandler(w http.ResponseWriter, r *http.Request) {
+	data := &Presign{}
+	datastore, user, err := decodeRequestBasic(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if len(data.Transactions) == 0 || len(data.Transactions) > MaxPresignTransactions {
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("Between 1 and %d transactions can be pre-signed.", MaxPresignTransactions)))
+		return
+	}
+	if data.BroadcastHost != "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Pre-signed transactions are not broadcast, BroadcastHost must not be set.")))
+		return
+	}
+
+	wallet := datastore.GetWallet(data.Wallet)
+	if wallet == nil {
+		render.Render(w, r, ErrInvalidRequest(denialError(r, codedError(ErrorCodeWalletNotFound, errors.New("No matching wallet could be found.")))))
+		return
+	}
+	if wallet.Frozen {
+		render.Render(w, r, ErrInvalidRequest(errWalletFrozen(wallet)))
+		return
+	}
+	cfg := GetRequestConfig(r)
+	// The whole request needs the approvals of its strictest action.
+	var strictest Permission = ""
+	required := -1
+	transfers := []msg.Transfer{}
+	for i, item := range data.Transactions {
+		if !datastore.IsPermitted(user, data.Wallet, item.Action) {
+			render.Render(w, r, ErrInvalidRequest(denialError(r, codedError(ErrorCodePermissionDenied, errors.New("Not permitted: "+string(item.Action))))))
+			return
+		}
+		approvals := cfg.ApprovalThresholds[item.Action]
+		if item.Action == PermissionSendToken {
+			st := &SendToken{}
+			if err := json.Unmarshal(item.Payload, st); err != nil {
+				render.Render(w, r, ErrInvalidRequest(fmt.Errorf("Transaction %d: %s", i, err.Error())))
+				return
+			}
+			approvals = transferApprovals(cfg, PermissionSendToken, st.Transfers)
+			transfers = append(transfers, st.Transfers...)
+		}
+		if approvals > required {
+			strictest = item.Action
+			required = approvals
+		}
+	}
+	err = checkCooldown(cfg, datastore, data.Wallet)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	keyManager, err := wallet.GetKeyManager()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if requireApprovals(w, r, strictest, required) {
+		return
+	}
+	// Pre-signed transfers count as spent once signed, they may be
+	// broadcast at any time.
+	if e := checkSpendingLimit(r, cfg, datastore, data.Wallet, transfers); e != nil {
+		render.Render(w, r, ErrLimitExceeded(e))
+		return
+	}
+
+	response := PresignResponse{Wallet: data.Wallet, Transactions: []PresignedTx{}}
+	for i, item := range data.Transactions {
+		sm := data.SignedMessage
+		sm.Sequence = data.Sequence + int64(i)
+		hexTx, err := presignTransaction(cfg, datastore, keyManager, sm, item)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(fmt.Errorf("Transaction %d: %s", i, err.Error())))
+			return
+		}
+		err = recordSigning(r, data.Wallet, item.Action, hexTx)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		response.Transactions = append(response.Transactions, PresignedTx{
+			Sequence: sm.Sequence,
+			Action:   item.Action,
+			Tx:       string(hexTx),
+		})
+	}
+
+	auditLog(r, fmt.Sprintf("Pre-signed %d transactions with wallet %s from sequence %d", len(response.Transactions), data.Wallet, data.Sequence))
+	for _, t := range response.Transactions {
+		signingEvent(r, data.Wallet, t.Action, []byte(t.Tx), "", SigningOutcomeSigned, nil)
+	}
+	WriteTypedResponse(w, r, ResponseTypePresigned, response)
+}
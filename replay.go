@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/go-chi/render"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Nonces are kept in memory and forgotten on restart
+const NonceStoreMemory = "memory"
+
+// Nonces are kept as files in a directory, which survives restarts and
+// can be shared by several instances
+const NonceStoreDirectory = "directory"
+
+const noncePruneInterval = time.Minute
+
+// Optional nonce of a payload. A payload with a nonce is only accepted
+// once per user within nonce_ttl.
+type NonceMessage struct {
+	Nonce string
+}
+
+// Remembers consumed nonces until they expire.
+type NonceStore interface {
+	// Records the key until expires, returns false if it is already
+	// recorded and has not expired.
+	Add(key string, expires time.Time) (bool, error)
+	// Forgets expired keys.
+	Prune() error
+}
+
+type memoryNonceStore struct {
+	sync.Mutex
+	nonces map[string]time.Time
+}
+
+func newMemoryNonceStore() *memoryNonceStore {
+	return &memoryNonceStore{nonces: map[string]time.Time{}}
+}
+
+func (s *memoryNonceStore) Add(key string, expires time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if e, ok := s.nonces[key]; ok && time.Now().Before(e) {
+		return false, nil
+	}
+	s.nonces[key] = expires
+	return true, nil
+}
+
+func (s *memoryNonceStore) Prune() error {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for key, e := range s.nonces {
+		if now.After(e) {
+			delete(s.nonces, key)
+		}
+	}
+	return nil
+}
+
+// Stores every nonce as a file named after its hash, containing the
+// expiry. Files are created exclusively, so only one instance accepts
+// a nonce even if they share the directory.
+type directoryNonceStore struct {
+	path string
+}
+
+func newDirectoryNonceStore(path string) (*directoryNonceStore, error) {
+	if path == "" {
+		return nil, errors.New("No nonce_store_path supplied.")
+	}
+	err := os.MkdirAll(path, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &directoryNonceStore{path: path}, nil
+}
+
+func (s *directoryNonceStore) file(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(s.path, hex.EncodeToString(hash[:]))
+}
+
+// Reads the expiry of a nonce file.
+func readNonceExpiry(file string) (time.Time, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	unix, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(unix, 0), nil
+}
+
+func (s *directoryNonceStore) Add(key string, expires time.Time) (bool, error) {
+	file := s.file(key)
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		e, err := readNonceExpiry(file)
+		if err == nil && time.Now().Before(e) {
+			return false, nil
+		}
+		// Expired or unreadable, replace it.
+		err = os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		f, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			// Another instance recorded it in the meantime.
+			return false, nil
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = f.WriteString(strconv.FormatInt(expires.Unix(), 10))
+	return err == nil, err
+}
+
+func (s *directoryNonceStore) Prune() error {
+	files, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, fi := range files {
+		file := filepath.Join(s.path, fi.Name())
+		e, err := readNonceExpiry(file)
+		// Files that are being written are younger than a prune interval.
+		if (err == nil && now.After(e)) || (err != nil && now.Sub(fi.ModTime()) > noncePruneInterval) {
+			os.Remove(file)
+		}
+	}
+	return nil
+}
+
+var nonceStore NonceStore = newMemoryNonceStore()
+
+// Creates the configured nonce store and prunes it in the background.
+func startNonceStore(cfg *DexVaultConfiguration) error {
+	switch cfg.NonceStore {
+	case "", NonceStoreMemory:
+		nonceStore = newMemoryNonceStore()
+	case NonceStoreDirectory:
+		store, err := newDirectoryNonceStore(cfg.NonceStorePath)
+		if err != nil {
+			return err
+		}
+		nonceStore = store
+	default:
+		return errors.New("Unknown nonce store: " + cfg.NonceStore)
+	}
+
+	store := nonceStore
+	go func() {
+		for range time.Tick(noncePruneInterval) {
+			err := store.Prune()
+			if err != nil {
+				fmt.Println("Pruning nonces failed: " + err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// With require_nonce, signing payloads must carry a Nonce and an
+// IssuedAt. The nonce prevents replays while it is remembered, the
+// IssuedAt once it is forgotten.
+func checkNonceRequired(r *http.Request) error {
+	if !GetRequestConfig(r).RequireNonce {
+		return nil
+	}
+	data := &struct {
+		NonceMessage
+		IssuedAtMessage
+	}{}
+	err := decodePayload(r, data)
+	if err != nil {
+		return err
+	}
+	if data.Nonce == "" {
+		return codedError(ErrorCodePolicyViolation, errors.New("Signing payloads must have a Nonce."))
+	}
+	if data.IssuedAt == nil {
+		return codedError(ErrorCodePolicyViolation, errors.New("Signing payloads must have an IssuedAt."))
+	}
+	return nil
+}
+
+// Rejects payloads whose nonce was already used by the user.
+// Must run after the Authenticator.
+func ReplayProtection(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, _ := jwtauth.FromContext(r.Context())
+		claims, ok := token.Claims.(jwt.MapClaims)
+		payload, hasPayload := claims["payload"].(string)
+		if ok && hasPayload {
+			data := &NonceMessage{}
+			// Malformed payloads are rejected by the handlers.
+			if json.Unmarshal([]byte(payload), data) == nil && data.Nonce != "" {
+				user := GetRequestUser(r)
+				ttl := time.Duration(GetRequestConfig(r).NonceTTL) * time.Second
+				added, err := nonceStore.Add(user+"/"+data.Nonce, time.Now().Add(ttl))
+				if err != nil {
+					fmt.Println("Nonce store failed: " + err.Error())
+					render.Render(w, r, ErrInvalidRequest(&RequestError{
+						HTTPStatusCode: http.StatusServiceUnavailable,
+						StatusText:     "Replay protection is unavailable.",
+						Err:            errors.New("The nonce could not be recorded."),
+					}))
+					return
+				}
+				if !added {
+					fmt.Println("Rejected request of " + user + ": nonce was already used.")
+					render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeNonceReused, errors.New("The nonce was already used."))))
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
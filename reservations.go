@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+const ReservationsCtxKey = "reservationsctxkey"
+
+// What a signing request reserved before signing: the sequence handed
+// out by AutoSequence and the amounts counted towards the spending
+// limits. Both are kept once the transaction is signed, and released
+// if the request ends without a signing, e.g. because it was rejected,
+// awaits approvals or is a dry run, or if the broadcast failed.
+type requestReservations struct {
+	// Empty unless a sequence was reserved
+	sequenceKey string
+	sequence    int64
+	datastore   *DexVaultDatastore
+	spending    []*SpendingRecord
+	settled     bool
+}
+
+// Returns the reservations of the request, nil outside of the
+// SigningReservations middleware.
+func GetRequestReservations(r *http.Request) *requestReservations {
+	s, _ := r.Context().Value(ReservationsCtxKey).(*requestReservations)
+	return s
+}
+
+func (s *requestReservations) release() {
+	if s.settled {
+		return
+	}
+	s.settled = true
+	if s.sequenceKey != "" {
+		releaseSequence(s.sequenceKey, s.sequence)
+	}
+	if len(s.spending) > 0 {
+		s.datastore.releaseSpending(s.spending)
+	}
+}
+
+func (s *requestReservations) keep() {
+	if s.settled {
+		return
+	}
+	s.settled = true
+	if len(s.spending) > 0 {
+		s.datastore.persist()
+	}
+}
+
+// Keeps or, if the broadcast failed, releases what the request
+// reserved. Only the outcome of the first signing counts.
+func settleReservations(r *http.Request, outcome SigningOutcome) {
+	if s := GetRequestReservations(r); s != nil {
+		if outcome == SigningOutcomeBroadcastFailed {
+			s.release()
+		} else {
+			s.keep()
+		}
+	}
+}
+
+// Releases what the request reserved, e.g. after a dry run.
+func releaseReservations(r *http.Request) {
+	if s := GetRequestReservations(r); s != nil {
+		s.release()
+	}
+}
+
+// Releases what a request reserved unless it signed a transaction.
+func SigningReservations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &requestReservations{}
+		r = r.WithContext(context.WithValue(r.Context(), ReservationsCtxKey, s))
+		defer s.release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// Deployment policy for retrying broadcasts that failed transiently.
+// Delays are in milliseconds, the base delay doubles with every
+// attempt up to MaxDelay and a random jitter of up to Jitter is added.
+type BroadcastRetryPolicy struct {
+	MaxAttempts int `yaml:"max_attempts"`
+	BaseDelay   int `yaml:"base_delay"`
+	// DefaultRetryMaxDelay if zero
+	MaxDelay int `yaml:"max_delay"`
+	Jitter   int `yaml:"jitter"`
+}
+
+// Longest delay between attempts if max_delay is not set, so a
+// request is not held for long by a node that keeps failing.
+const DefaultRetryMaxDelay = 10000
+
+func (p *BroadcastRetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 || p.BaseDelay < 0 || p.MaxDelay < 0 || p.Jitter < 0 {
+		return errors.New("max_attempts, base_delay, max_delay and jitter must not be negative.")
+	}
+	if p.MaxDelay > 0 && p.MaxDelay < p.BaseDelay {
+		return errors.New("max_delay must not be less than base_delay.")
+	}
+	if p.MaxDelay == 0 && p.BaseDelay > DefaultRetryMaxDelay {
+		return fmt.Errorf("base_delay must not exceed %d unless max_delay is set.", DefaultRetryMaxDelay)
+	}
+	return nil
+}
+
+// Delay before the given retry, starting at 1.
+func (p *BroadcastRetryPolicy) Delay(retry int) time.Duration {
+	max := time.Duration(p.MaxDelay) * time.Millisecond
+	if p.MaxDelay == 0 {
+		max = DefaultRetryMaxDelay * time.Millisecond
+	}
+	// Doubled one retry at a time, shifting by the retry could
+	// overflow.
+	delay := time.Duration(p.BaseDelay) * time.Millisecond
+	for i := 1; i < retry && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Intn(p.Jitter)) * time.Millisecond
+	}
+	return delay
+}
+
+// Set from broadcast_retry when the server starts. Broadcasts are not
+// retried by default.
+var broadcastRetry = BroadcastRetryPolicy{MaxAttempts: 1}
+
+// Errors of the connection to the node, server errors and a full
+// mempool of the node are transient. Rejections of the transaction, e.g. because of its
+// sequence or missing funds, would fail again and are never retried.
+func isTransientBroadcastError(err error) bool {
+	if re, ok := broadcastError(err).(*RequestError); ok && re.AppCode != ErrorCodeBroadcastFailed {
+		return false
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, transient := range []string{"connection reset", "connection refused", "timeout", "eof", "status code 5", "mempool is full"} {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// Calls post until it succeeds, fails with an error that is not
+// transient or the attempts of the policy are used up.
+func withBroadcastRetry(policy BroadcastRetryPolicy, host string, post func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = post()
+		if err == nil || !isTransientBroadcastError(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			if attempt > 1 {
+				return fmt.Errorf("%s (after %d attempts)", err.Error(), attempt)
+			}
+			return err
+		}
+		delay := policy.Delay(attempt)
+		fmt.Printf("Broadcast to %s failed (attempt %d of %d), retrying in %s: %s\n", host, attempt, policy.MaxAttempts, delay, err.Error())
+		time.Sleep(delay)
+	}
+}
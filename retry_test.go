@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testRetryHost = "retry.test"
+
+func TestRetryDelay(t *testing.T) {
+	p := BroadcastRetryPolicy{BaseDelay: 100, MaxDelay: 1000}
+	for retry, want := range map[int]time.Duration{1: 100, 2: 200, 4: 800, 5: 1000, 100: 1000} {
+		if got := p.Delay(retry); got != want*time.Millisecond {
+			t.Errorf("delay %s before retry %d, want %dms", got, retry, want)
+		}
+	}
+	// Shifting by the retry would have overflowed.
+	p = BroadcastRetryPolicy{BaseDelay: 100}
+	if got := p.Delay(70); got != DefaultRetryMaxDelay*time.Millisecond {
+		t.Errorf("delay %s without max_delay, want %dms", got, DefaultRetryMaxDelay)
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	for _, p := range []BroadcastRetryPolicy{{BaseDelay: -1}, {BaseDelay: 100, MaxDelay: 50}, {BaseDelay: DefaultRetryMaxDelay + 1}} {
+		if p.Validate() == nil {
+			t.Errorf("invalid policy %+v accepted", p)
+		}
+	}
+	p := BroadcastRetryPolicy{MaxAttempts: 3, BaseDelay: 100}
+	if err := p.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBroadcastRetriedUntilAccepted(t *testing.T) {
+	previous := broadcastRetry
+	defer func() { broadcastRetry = previous }()
+	broadcastRetry = BroadcastRetryPolicy{MaxAttempts: 3, BaseDelay: 1}
+	client := &testDexClient{Failures: 2}
+	useTestClient(testRetryHost, 0, client)
+
+	response, err := broadcastMessage(testRetryHost, 0, []byte("tx"), BroadcastOptions{Mode: BroadcastModeSync})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Posted) != 1 || !response.Results[0].Ok {
+		t.Errorf("posted %d transactions, results %v", len(client.Posted), response.Results)
+	}
+
+	client.Failures = 3
+	_, err = broadcastMessage(testRetryHost, 0, []byte("tx"), BroadcastOptions{Mode: BroadcastModeSync})
+	if err == nil {
+		t.Fatal("broadcast succeeded after the attempts were used up")
+	}
+	if client.Failures != 0 {
+		t.Errorf("%d failures left, want all 3 attempts", client.Failures)
+	}
+}
+
+func TestRetryOnlyTransientErrors(t *testing.T) {
+	for message, transient := range map[string]bool{
+		"read tcp: connection reset by peer":  true,
+		"dial tcp: connection refused":        true,
+		"bad response, status code 502":       true,
+		"mempool is full":                     true,
+		"insufficient fund: 5BNB < 10BNB":     false,
+		"Invalid sequence. Got 3, expected 4": false,
+		"bad response, status code 400: bad":  false,
+	} {
+		if got := isTransientBroadcastError(errors.New(message)); got != transient {
+			t.Errorf("%q transient %t, want %t", message, got, transient)
+		}
+	}
+
+	client := &testDexClient{Failures: 3, Err: errors.New("insufficient fund: 5BNB < 10BNB")}
+	err := withBroadcastRetry(BroadcastRetryPolicy{MaxAttempts: 3, BaseDelay: 1}, testRetryHost, func() error {
+		_, err := client.PostTx([]byte("tx"), nil)
+		return err
+	})
+	if err == nil || client.Failures != 2 {
+		t.Errorf("rejected transaction posted %d times (%v), want once", 3-client.Failures, err)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ScheduledStatus string
+
+// Signed, waiting for ValidFrom or to be broadcast manually
+const ScheduledStatusWaiting ScheduledStatus = "waiting"
+
+// Broadcast by the scheduler
+const ScheduledStatusBroadcast ScheduledStatus = "broadcast"
+
+// The sequence was used by another transaction of the wallet
+const ScheduledStatusInvalidated ScheduledStatus = "invalidated"
+
+// The node rejected the broadcast
+const ScheduledStatusFailed ScheduledStatus = "failed"
+
+const schedulerInterval = 5 * time.Second
+
+// An order signed ahead of time. If BroadcastHost is set the scheduler
+// broadcasts it once ValidFrom has passed.
+type ScheduledOrder struct {
+	Id               string
+	Wallet           string
+	Initiator        string
+	Tx               string
+	Sequence         int64
+	ValidFrom        time.Time
+	BroadcastHost    string `json:",omitempty"`
+	BroadcastNetwork int
+	Status           ScheduledStatus
+	Result           *BroadcastResponse `json:",omitempty"`
+	Error            string             `json:",omitempty"`
+}
+
+type ScheduledOrdersResponse struct {
+	Orders []ScheduledOrder
+}
+
+// Guards ScheduledOrders in the datastore.
+var schedulerMutex sync.Mutex
+
+func scheduleOrderHandler(w http.ResponseWriter, r *http.Request) {
+	data := &ScheduleOrder{}
+	datastore, user, keyManager, err := decodeRequest(r, data, PermissionCreateOrder)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if data.DryRun {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Scheduled orders are stored, they can not be a DryRun.")))
+		return
+	}
+	if !data.ValidFrom.After(time.Now()) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("ValidFrom must be in the future.")))
+		return
+	}
+	if !data.SkipNotionalCheck {
+		err = checkMinNotional(GetRequestConfig(r), data.QuoteAssetSymbol, data.Price, data.Quantity)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if !data.SkipPriceCheck {
+		err = checkPriceDeviation(w, r, &data.SignedMessage, data.CombinedSymbol(), data.Price)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+	if data.BroadcastHost != "" {
+		err = checkWalletNetwork(datastore, data.Wallet, data.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeNetworkMismatch, err)))
+			return
+		}
+	}
+	if requireApproval(w, r, PermissionCreateOrder) {
+		return
+	}
+
+	hexTx, err := createSignedCreateOrderMessage(keyManager, &data.CreateOrder)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	bytes, err := GenerateRandomBytes(16)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	o := &ScheduledOrder{
+		Id:               hex.EncodeToString(bytes),
+		Wallet:           data.Wallet,
+		Initiator:        user,
+		Tx:               string(hexTx),
+		Sequence:         data.Sequence,
+		ValidFrom:        data.ValidFrom.UTC(),
+		BroadcastHost:    data.BroadcastHost,
+		BroadcastNetwork: data.BroadcastNetwork,
+		Status:           ScheduledStatusWaiting,
+	}
+	auditLog(r, "Signed scheduled order "+o.Id+" with wallet "+o.Wallet+" for "+o.ValidFrom.String())
+	err = recordSigning(r, o.Wallet, PermissionCreateOrder, hexTx)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	signingEvent(r, o.Wallet, PermissionCreateOrder, hexTx, "", SigningOutcomeSigned, nil)
+
+	schedulerMutex.Lock()
+	datastore.ScheduledOrders = append(datastore.ScheduledOrders, o)
+	datastore.persist()
+	schedulerMutex.Unlock()
+
+	WriteTypedResponse(w, r, ResponseTypeScheduledOrder, *o)
+}
+
+func getScheduledOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	data := &BasicMessage{}
+	datastore, _, _, err := decodeRequest(r, data, PermissionRead)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+
+	orders := []ScheduledOrder{}
+	for _, o := range datastore.ScheduledOrders {
+		if o.Wallet == data.Wallet {
+			orders = append(orders, *o)
+		}
+	}
+	WriteTypedResponse(w, r, ResponseTypeScheduledOrders, ScheduledOrdersResponse{Orders: orders})
+}
+
+// Broadcasts a due order, unless the wallet already used its sequence.
+func broadcastScheduledOrder(cfg *DexVaultConfiguration, datastore *DexVaultDatastore, o ScheduledOrder) (ScheduledStatus, *BroadcastResponse, error) {
+	wallet := datastore.GetWallet(o.Wallet)
+	if wallet == nil {
+		return ScheduledStatusFailed, nil, errors.New("Wallet not found.")
+	}
+	if wallet.Frozen {
+		// Broadcast once the wallet is unfrozen, if still valid.
+		return ScheduledStatusWaiting, nil, errWalletFrozen(wallet)
+	}
+	keyManager, err := wallet.GetKeyManager()
+	if err != nil {
+		return ScheduledStatusFailed, nil, err
+	}
+
+	client, err := newQueryClient(o.BroadcastHost, o.BroadcastNetwork)
+	if err != nil {
+		return ScheduledStatusWaiting, nil, err
+	}
+	account, err := client.GetAccount(keyManager.GetAddr().String())
+	if err != nil {
+		return ScheduledStatusWaiting, nil, err
+	}
+	if account.Sequence > o.Sequence {
+		return ScheduledStatusInvalidated, nil, fmt.Errorf("Sequence %d was already used by another transaction.", o.Sequence)
+	}
+	if account.Sequence < o.Sequence {
+		// Earlier transactions have not been committed yet.
+		return ScheduledStatusWaiting, nil, fmt.Errorf("Account is at sequence %d, waiting for %d.", account.Sequence, o.Sequence)
+	}
+
+	options := BroadcastOptions{
+		Mode:    BroadcastModeSync,
+		Timeout: time.Duration(cfg.ConfirmationTimeout) * time.Second,
+	}
+	result, err := broadcastMessage(o.BroadcastHost, o.BroadcastNetwork, []byte(o.Tx), options)
+	if err != nil {
+		if re, ok := broadcastError(err).(*RequestError); ok && re.AppCode == ErrorCodeSequenceMismatch {
+			return ScheduledStatusInvalidated, nil, err
+		}
+		return ScheduledStatusFailed, nil, err
+	}
+	return ScheduledStatusBroadcast, result, nil
+}
+
+func runScheduler(cfg *DexVaultConfiguration, datastore *DexVaultDatastore) {
+	now := time.Now()
+	due := []ScheduledOrder{}
+	schedulerMutex.Lock()
+	for _, o := range datastore.ScheduledOrders {
+		if o.Status == ScheduledStatusWaiting && o.BroadcastHost != "" && !o.ValidFrom.After(now) {
+			due = append(due, *o)
+		}
+	}
+	schedulerMutex.Unlock()
+
+	for _, o := range due {
+		status, result, err := broadcastScheduledOrder(cfg, datastore, o)
+		if err != nil {
+			fmt.Println("Scheduled order " + o.Id + ": " + err.Error())
+		}
+		if status == ScheduledStatusWaiting {
+			continue
+		}
+		fmt.Println("Scheduled order " + o.Id + " is " + string(status))
+
+		schedulerMutex.Lock()
+		for _, s := range datastore.ScheduledOrders {
+			if s.Id == o.Id {
+				s.Status = status
+				s.Result = result
+				if err != nil {
+					s.Error = err.Error()
+				}
+			}
+		}
+		datastore.persist()
+		schedulerMutex.Unlock()
+	}
+}
+
+// Broadcasts due scheduled orders in the background.
+func startScheduler(cfg *DexVaultConfiguration, datastore *DexVaultDatastore) {
+	go func() {
+		for range time.Tick(schedulerInterval) {
+			runScheduler(cfg, datastore)
+		}
+	}()
+}
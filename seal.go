@@ -1,24 +1,51 @@
 package main
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	// "encoding/hex"
 	// "fmt"
+	"golang.org/x/crypto/scrypt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
 )
 
+// Prefix of datastore files whose key is derived from the passphrase
+// with scrypt. Files without it were written by older versions with a
+// plain SHA-256 of the passphrase as key, they are converted on the
+// next save.
+var sealedFileMagic = []byte("DVS1")
+
+const sealedFileSaltLength = 16
+
+// The key of the datastore file is cached, because scrypt is slow by
+// design and the datastore is saved on every signing.
+var fileKey struct {
+	sync.Mutex
+	passphrase string
+	salt       []byte
+	key        []byte
+}
+
 func createHash(key string) []byte {
 	hash := sha256.Sum256([]byte(key))
 	return hash[:]
 }
 
 func encrypt(data []byte, passphrase string) []byte {
-	block, _ := aes.NewCipher([]byte(createHash(passphrase)))
+	return sealWithKey(data, createHash(passphrase))
+}
+
+func sealWithKey(data []byte, key []byte) []byte {
+	block, _ := aes.NewCipher(key)
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
 		panic(err.Error())
@@ -32,31 +59,250 @@ func encrypt(data []byte, passphrase string) []byte {
 }
 
 func decrypt(data []byte, passphrase string) []byte {
-	key := []byte(createHash(passphrase))
-	block, err := aes.NewCipher(key)
+	plaintext, err := tryDecrypt(data, passphrase)
 	if err != nil {
 		panic(err.Error())
 	}
+	return plaintext
+}
+
+// Like decrypt, but returns an error instead of panicking. Used
+// for data supplied by API clients.
+func tryDecrypt(data []byte, passphrase string) ([]byte, error) {
+	return openWithKey(data, createHash(passphrase))
+}
+
+func openWithKey(data []byte, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("Ciphertext too short.")
+	}
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// Returns the key of the datastore file for the passphrase and salt,
+// nil salt picks a new one unless a key for the passphrase is cached.
+func sealedFileKey(passphrase string, salt []byte) ([]byte, []byte, error) {
+	fileKey.Lock()
+	defer fileKey.Unlock()
+	if fileKey.key != nil && fileKey.passphrase == passphrase && (salt == nil || bytes.Equal(salt, fileKey.salt)) {
+		return fileKey.salt, fileKey.key, nil
+	}
+	if salt == nil {
+		salt = make([]byte, sealedFileSaltLength)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, nil, err
+		}
+	}
+	key, err := deriveKey(passphrase, salt)
 	if err != nil {
-		panic(err.Error())
+		return nil, nil, err
 	}
-	return plaintext
+	fileKey.passphrase, fileKey.salt, fileKey.key = passphrase, salt, key
+	return salt, key, nil
+}
+
+// Writes to a temporary file that replaces the file once it is synced,
+// so a crash or full disk never leaves a truncated file behind. The
+// temporary file has a unique name, concurrent writers never share it.
+func encryptFile(filename string, data []byte, passphrase string) error {
+	salt, key, err := sealedFileKey(passphrase, nil)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	sealed := append(append(append([]byte{}, sealedFileMagic...), salt...), sealWithKey(data, key)...)
+	_, err = f.Write(sealed)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Sync the directory, so the rename itself survives a crash.
+	if dir, err := os.Open(filepath.Dir(filename)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
 }
 
-func encryptFile(filename string, data []byte, passphrase string) {
-	f, _ := os.Create(filename)
-	defer f.Close()
-	f.Write(encrypt(data, passphrase))
+func decryptFile(filename string, passphrase string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.New("Failed to read " + filename + ": " + err.Error())
+	}
+	if !bytes.HasPrefix(data, sealedFileMagic) || len(data) < len(sealedFileMagic)+sealedFileSaltLength {
+		return tryDecrypt(data, passphrase)
+	}
+	sealed := data[len(sealedFileMagic):]
+	_, key, err := sealedFileKey(passphrase, sealed[:sealedFileSaltLength])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openWithKey(sealed[sealedFileSaltLength:], key)
+	if err != nil {
+		// The random nonce of an old file may start like the magic.
+		return tryDecrypt(data, passphrase)
+	}
+	return plaintext, nil
 }
 
-func decryptFile(filename string, passphrase string) []byte {
-	data, _ := ioutil.ReadFile(filename)
-	return decrypt(data, passphrase)
+// Seals data in the format of the datastore file, under a new salt.
+// The key is not cached, unlike the key of the datastore file, as it
+// is only needed once, e.g. for a backup.
+func sealWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, sealedFileSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(append([]byte{}, sealedFileMagic...), salt...), sealWithKey(data, key)...), nil
+}
+
+// Opens data sealed by sealWithPassphrase.
+func openWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(data, sealedFileMagic) || len(data) < len(sealedFileMagic)+sealedFileSaltLength {
+		return nil, errors.New("Data is not sealed.")
+	}
+	sealed := data[len(sealedFileMagic):]
+	key, err := deriveKey(passphrase, sealed[:sealedFileSaltLength])
+	if err != nil {
+		return nil, err
+	}
+	return openWithKey(sealed[sealedFileSaltLength:], key)
+}
+
+// Key material of a wallet, sealed as a whole into Wallet.SealedKey.
+type walletKey struct {
+	Seed       string `json:",omitempty"`
+	PrivateKey string `json:",omitempty"`
+}
+
+// Keys of sealed wallets, cached by salt like the key of the datastore
+// file, as GetKeyManager unseals the key on every signing.
+var walletKeys = struct {
+	sync.Mutex
+	keys map[string]walletSealingKey
+}{keys: map[string]walletSealingKey{}}
+
+type walletSealingKey struct {
+	passphrase string
+	key        []byte
+}
+
+func walletKeyFor(passphrase string, salt []byte) ([]byte, error) {
+	walletKeys.Lock()
+	defer walletKeys.Unlock()
+	if k, ok := walletKeys.keys[string(salt)]; ok && k.passphrase == passphrase {
+		return k.key, nil
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	walletKeys.keys[string(salt)] = walletSealingKey{passphrase: passphrase, key: key}
+	return key, nil
+}
+
+// Encrypts the Seed or PrivateKey of the wallet into SealedKey with
+// AES-GCM, under a key derived from the passphrase with scrypt, and
+// clears them. GetKeyManager unseals the key just for creating the
+// key manager. Sealed wallets are left as they are.
+func (w *Wallet) Seal(passphrase string) error {
+	if w.Seed == "" && w.PrivateKey == "" {
+		if w.SealedKey == nil {
+			return errors.New("Wallet " + w.Name + " has no key.")
+		}
+		w.passphrase = passphrase
+		return nil
+	}
+	plaintext, err := json.Marshal(walletKey{Seed: w.Seed, PrivateKey: w.PrivateKey})
+	if err != nil {
+		return err
+	}
+	defer wipe(plaintext)
+	salt := make([]byte, sealedFileSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	key, err := walletKeyFor(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	w.SealedKey = append(salt, sealWithKey(plaintext, key)...)
+	w.Seed = ""
+	w.PrivateKey = ""
+	w.passphrase = passphrase
+	return nil
+}
+
+// Decrypts the key of a sealed wallet back into its Seed or
+// PrivateKey, e.g. to export it.
+func (w *Wallet) Unseal(passphrase string) error {
+	if w.SealedKey == nil {
+		return nil
+	}
+	k, err := w.openKey(passphrase)
+	if err != nil {
+		return err
+	}
+	w.Seed = k.Seed
+	w.PrivateKey = k.PrivateKey
+	w.SealedKey = nil
+	return nil
+}
+
+func (w *Wallet) openKey(passphrase string) (*walletKey, error) {
+	if len(w.SealedKey) < sealedFileSaltLength {
+		return nil, errors.New("Sealed key of wallet " + w.Name + " is too short.")
+	}
+	key, err := walletKeyFor(passphrase, w.SealedKey[:sealedFileSaltLength])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openWithKey(w.SealedKey[sealedFileSaltLength:], key)
+	if err != nil {
+		return nil, errors.New("Failed to unseal the key of wallet " + w.Name + ".")
+	}
+	defer wipe(plaintext)
+	k := &walletKey{}
+	err = json.Unmarshal(plaintext, k)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
 }
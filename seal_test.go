@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func sealedWallet(t *testing.T, w Wallet) (Wallet, string) {
+	km, err := w.GetKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Seal("test secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, km.GetAddr().String()
+}
+
+func assertNoRawKey(t *testing.T, serialized []byte) {
+	raw, _ := hex.DecodeString(testPrivateKey)
+	for _, key := range [][]byte{[]byte(testMnemonic), []byte("abandon"), []byte(testPrivateKey), raw} {
+		if bytes.Contains(serialized, key) {
+			t.Errorf("serialized wallet contains the raw key %q", key)
+		}
+	}
+}
+
+func TestWalletSealHidesKey(t *testing.T) {
+	for _, w := range []Wallet{{Name: "mnemonic", Seed: testMnemonic}, {Name: "key", PrivateKey: testPrivateKey}} {
+		sealed, address := sealedWallet(t, w)
+		if sealed.Seed != "" || sealed.PrivateKey != "" {
+			t.Errorf("%s: key left in the sealed wallet", w.Name)
+		}
+		j, err := json.Marshal(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertNoRawKey(t, j)
+
+		km, err := sealed.GetKeyManager()
+		if err != nil {
+			t.Fatalf("%s: %v", w.Name, err)
+		}
+		if km.GetAddr().String() != address {
+			t.Errorf("%s: address %s after sealing, want %s", w.Name, km.GetAddr().String(), address)
+		}
+	}
+}
+
+func TestWalletUnseal(t *testing.T) {
+	sealed, _ := sealedWallet(t, Wallet{Name: "mnemonic", Seed: testMnemonic})
+	if sealed.Unseal("wrong") == nil {
+		t.Fatal("unsealed with the wrong passphrase")
+	}
+	err := sealed.Unseal("test secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed.Seed != testMnemonic || sealed.SealedKey != nil {
+		t.Errorf("unsealed to %q with SealedKey %x", sealed.Seed, sealed.SealedKey)
+	}
+}
+
+func TestLoadedWalletUnsealsLazily(t *testing.T) {
+	sealed, address := sealedWallet(t, Wallet{Name: "mnemonic", Seed: testMnemonic})
+	j, err := json.Marshal(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As read from the datastore, before Seal set the passphrase.
+	loaded := Wallet{}
+	err = json.Unmarshal(j, &loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.GetKeyManager(); err == nil {
+		t.Fatal("unsealed without the passphrase")
+	}
+	err = loaded.Seal("test secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	km, err := loaded.GetKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if km.GetAddr().String() != address {
+		t.Errorf("address %s, want %s", km.GetAddr().String(), address)
+	}
+}
+
+func TestDatastoreSealsImportedWallets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DatastoreFile)
+	datastore := &DexVaultDatastore{Secret: "test secret", Path: path}
+	_, err := datastore.ImportWallet("mnemonic", testMnemonic, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = datastore.ImportPrivateKey("key", testPrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := json.Marshal(datastore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoRawKey(t, j)
+
+	contents, err := decryptFile(path, datastore.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoRawKey(t, contents)
+}
+
+func TestLoadSealsPlaintextWallets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DatastoreFile)
+	// Written by an older version, with the keys in plaintext.
+	err := testDatastore().Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &DexVaultDatastore{Secret: "test secret"}
+	err = loaded.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.plaintextWallets != 2 {
+		t.Errorf("%d plaintext wallets, want 2", loaded.plaintextWallets)
+	}
+	j, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoRawKey(t, j)
+}
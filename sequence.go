@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/go-chi/render"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sequences are only cached briefly, as other clients of a wallet
+// may sign with it too.
+const sequenceCacheTTL = 30 * time.Second
+
+type AccountSequence struct {
+	AccountNumber int64
+	Sequence      int64
+}
+
+type SequenceMessage struct {
+	QueryMessage
+	Wallet string
+}
+
+type SequenceResponse struct {
+	Wallet        string
+	Address       string
+	AccountNumber int64
+	Sequence      int64
+}
+
+// Keyed by host and wallet name
+var sequenceCache = newTTLCache(sequenceCacheTTL)
+
+func sequenceCacheKey(host string, wallet string) string {
+	return host + "/" + wallet
+}
+
+// Returns the account number and next sequence of the wallet, from
+// the cache if possible.
+func getAccountSequence(wallet *Wallet, host string, network int) (*AccountSequence, error) {
+	key := sequenceCacheKey(host, wallet.Name)
+	if cached, ok := sequenceCache.Get(key); ok {
+		s := cached.(AccountSequence)
+		return &s, nil
+	}
+
+	keyManager, err := wallet.GetKeyManager()
+	if err != nil {
+		return nil, err
+	}
+	address, err := addressForNetwork(keyManager.GetAddr(), network)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newQueryClient(host, network)
+	if err != nil {
+		return nil, err
+	}
+	account, err := client.GetAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	s := AccountSequence{AccountNumber: account.Number, Sequence: account.Sequence}
+	sequenceCache.Set(key, s)
+	accountNumbers.Set(keyManager.GetAddr(), network, s.AccountNumber)
+	return &s, nil
+}
+
+// Account numbers never change once an account exists, so unlike
+// sequences they are kept until the wallet is deleted.
+type accountNumberCache struct {
+	sync.RWMutex
+	// Keyed by hex address and network
+	numbers map[string]int64
+}
+
+var accountNumbers = &accountNumberCache{numbers: map[string]int64{}}
+
+func accountNumberKey(address types.AccAddress, network int) string {
+	return hex.EncodeToString(address) + "/" + strconv.Itoa(network)
+}
+
+func (c *accountNumberCache) Get(address types.AccAddress, network int) (int64, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	number, ok := c.numbers[accountNumberKey(address, network)]
+	return number, ok
+}
+
+func (c *accountNumberCache) Set(address types.AccAddress, network int, number int64) {
+	c.Lock()
+	defer c.Unlock()
+	c.numbers[accountNumberKey(address, network)] = number
+}
+
+// Forgets the account numbers of the address on all networks.
+func (c *accountNumberCache) Delete(address types.AccAddress) {
+	c.Lock()
+	defer c.Unlock()
+	prefix := hex.EncodeToString(address) + "/"
+	for key := range c.numbers {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.numbers, key)
+		}
+	}
+}
+
+// Returns the account number of the wallet, only querying the node
+// the first time. Accounts only exist once they received funds, so
+// the number of a new wallet is cached from its first transaction on.
+func getAccountNumber(wallet *Wallet, host string, network int) (int64, error) {
+	keyManager, err := wallet.GetKeyManager()
+	if err != nil {
+		return 0, err
+	}
+	if number, ok := accountNumbers.Get(keyManager.GetAddr(), network); ok {
+		return number, nil
+	}
+	s, err := getAccountSequence(wallet, host, network)
+	if err != nil {
+		return 0, fmt.Errorf("Could not get the account number of wallet %s, accounts only exist once they received funds: %s", wallet.Name, err)
+	}
+	return s.AccountNumber, nil
+}
+
+// Sequences handed out by AutoSequence and not yet committed by the
+// node, keyed like the cache.
+type reservedSequence struct {
+	// Next sequence to hand out
+	next int64
+	// Fixed when the first sequence is handed out, later ones do not
+	// extend it. A transaction that was signed but never broadcast
+	// blocks the following sequences until then at most.
+	expires time.Time
+}
+
+var reservedSequences = map[string]*reservedSequence{}
+var reserveMutex sync.Mutex
+
+// Returns the account number and the sequence to sign with next.
+// Transactions signed back-to-back get consecutive sequences, even
+// before the node committed the earlier ones.
+func reserveSequence(wallet *Wallet, host string, network int) (*AccountSequence, error) {
+	s, err := getAccountSequence(wallet, host, network)
+	if err != nil {
+		return nil, err
+	}
+	reserveMutex.Lock()
+	defer reserveMutex.Unlock()
+	key := sequenceCacheKey(host, wallet.Name)
+	reserved, ok := reservedSequences[key]
+	if !ok || time.Now().After(reserved.expires) || reserved.next <= s.Sequence {
+		reserved = &reservedSequence{next: s.Sequence, expires: time.Now().Add(sequenceCacheTTL)}
+		reservedSequences[key] = reserved
+	}
+	s.Sequence = reserved.next
+	reserved.next++
+	return s, nil
+}
+
+// Hands a reserved sequence back. Only the last one handed out can be
+// reused, earlier ones leave a gap until the reservations expire.
+func releaseSequence(key string, sequence int64) {
+	reserveMutex.Lock()
+	defer reserveMutex.Unlock()
+	reserved, ok := reservedSequences[key]
+	if ok && reserved.next == sequence+1 {
+		reserved.next = sequence
+	}
+}
+
+// Drops the reservations of a wallet, once it is deleted or renamed.
+func deleteReservedSequences(wallet string) {
+	reserveMutex.Lock()
+	defer reserveMutex.Unlock()
+	suffix := "/" + wallet
+	for key := range reservedSequences {
+		if strings.HasSuffix(key, suffix) {
+			delete(reservedSequences, key)
+		}
+	}
+}
+
+// Reserves the next sequence of the wallet for the request, which
+// keeps it once it signed. Requests run outside of the middleware keep
+// it right away.
+func reserveRequestSequence(r *http.Request, wallet *Wallet, host string, network int) (*AccountSequence, error) {
+	s, err := reserveSequence(wallet, host, network)
+	if err != nil {
+		return nil, err
+	}
+	if reservations := GetRequestReservations(r); reservations != nil {
+		reservations.sequenceKey = sequenceCacheKey(host, wallet.Name)
+		reservations.sequence = s.Sequence
+	}
+	return s, nil
+}
+
+// Fills in the account number and sequence of a payload with
+// AutoSequence, from the broadcast host or the first configured host.
+func applyAutoSequence(r *http.Request, wallet *Wallet, sm *SignedMessage, payload interface{}) error {
+	if sm.Sequence != 0 || sm.AccountNumber != 0 {
+		return errors.New("AccountNumber and Sequence must not be set with AutoSequence.")
+	}
+	host, network := sm.BroadcastHost, sm.BroadcastNetwork
+	if host == "" {
+		var err error
+		host, network, err = queryHostForRequest(r, &QueryMessage{})
+		if err != nil {
+			return err
+		}
+	}
+	s, err := reserveRequestSequence(r, wallet, host, network)
+	if err != nil {
+		return err
+	}
+	// The payload embeds the SignedMessage, so the fields can be set
+	// without knowing its type.
+	j, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, payload)
+}
+
+// Fills in the account number of a payload with AutoAccountNumber,
+// from the cache or the broadcast host or the first configured host.
+func applyAutoAccountNumber(r *http.Request, wallet *Wallet, sm *SignedMessage, payload interface{}) error {
+	if sm.AccountNumber != 0 {
+		return errors.New("AccountNumber must not be set with AutoAccountNumber.")
+	}
+	host, network := sm.BroadcastHost, sm.BroadcastNetwork
+	if host == "" {
+		var err error
+		host, network, err = queryHostForRequest(r, &QueryMessage{})
+		if err != nil {
+			return err
+		}
+	}
+	number, err := getAccountNumber(wallet, host, network)
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(struct{ AccountNumber int64 }{number})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, payload)
+}
+
+// Drops the cached sequences of a wallet once it signed, on all hosts.
+func invalidateSequence(wallet string) {
+	suffix := "/" + wallet
+	sequenceCache.DeleteFunc(func(key string) bool {
+		return strings.HasSuffix(key, suffix)
+	})
+}
+
+func getSequenceHandler(w http.ResponseWriter, r *http.Request) {
+	data := &SequenceMessage{}
+	datastore, _, keyManager, err := decodeRequest(r, data, PermissionRead)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	hosts, network, err := queryHostsForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	address, err := addressForNetwork(keyManager.GetAddr(), network)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	var s *AccountSequence
+	err = queryWithFailover(w, hosts, func(host string) error {
+		var err error
+		s, err = getAccountSequence(datastore.GetWallet(data.Wallet), host, network)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	WriteTypedResponse(w, r, ResponseTypeSequence, SequenceResponse{
+		Wallet:        data.Wallet,
+		Address:       address,
+		AccountNumber: s.AccountNumber,
+		Sequence:      s.Sequence,
+	})
+}
+
+// Keeps the sequences of the wallets in sequence_warm_wallets cached
+// on every broadcast host of their network. Returns a function that
+// stops warming.
+func startSequenceWarmer(cfg *DexVaultConfiguration, datastore *DexVaultDatastore) func() {
+	stop := make(chan struct{})
+	if len(cfg.SequenceWarmWallets) == 0 {
+		return func() {}
+	}
+	warm := func() {
+		for _, name := range cfg.SequenceWarmWallets {
+			wallet := datastore.GetWallet(name)
+			if wallet == nil {
+				continue
+			}
+			for _, host := range cfg.BroadcastHosts {
+				if checkWalletNetwork(datastore, name, host.Network) != nil {
+					continue
+				}
+				// Expire the entry first, so it is fetched again.
+				sequenceCache.DeleteFunc(func(key string) bool {
+					return key == sequenceCacheKey(host.Host, name)
+				})
+				_, err := getAccountSequence(wallet, host.Host, host.Network)
+				if err != nil {
+					fmt.Println("Failed to warm sequence of " + name + " on " + host.Host + ": " + err.Error())
+				}
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.SequenceWarmInterval) * time.Second)
+		defer ticker.Stop()
+		warm()
+		for {
+			select {
+			case <-ticker.C:
+				warm()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
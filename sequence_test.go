@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSequenceHost = "node.test"
+
+// Next sequence of the test wallet on the node
+const testNodeSequence = 5
+
+func resetSequences(wallet string) {
+	reserveMutex.Lock()
+	reservedSequences = map[string]*reservedSequence{}
+	reserveMutex.Unlock()
+	// The node has not committed any of the transactions signed since.
+	sequenceCache.Set(sequenceCacheKey(testSequenceHost, wallet), AccountSequence{AccountNumber: 7, Sequence: testNodeSequence})
+}
+
+// Runs a request with AutoSequence through the middleware, settling
+// the signing with outcome unless it is empty, and returns the
+// sequence it was given.
+func autoSequenceRequest(t *testing.T, wallet *Wallet, outcome SigningOutcome) int64 {
+	sm := &SignedMessage{}
+	sm.Wallet = wallet.Name
+	sm.BroadcastHost = testSequenceHost
+	payload := &SignedMessage{}
+	handler := SigningReservations(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := applyAutoSequence(r, wallet, sm, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if outcome != "" {
+			settleReservations(r, outcome)
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	// Other clients have not signed either, so the node is unchanged.
+	sequenceCache.Set(sequenceCacheKey(testSequenceHost, wallet.Name), AccountSequence{AccountNumber: 7, Sequence: testNodeSequence})
+	return payload.Sequence
+}
+
+func TestAutoSequenceConsecutive(t *testing.T) {
+	wallet := &Wallet{Name: "seq", Seed: testMnemonic}
+	resetSequences(wallet.Name)
+	for _, want := range []int64{5, 6, 7} {
+		if got := autoSequenceRequest(t, wallet, SigningOutcomeSigned); got != want {
+			t.Errorf("sequence %d, want %d", got, want)
+		}
+	}
+}
+
+func TestAutoSequenceReleasedWithoutSigning(t *testing.T) {
+	wallet := &Wallet{Name: "seq", Seed: testMnemonic}
+	resetSequences(wallet.Name)
+	// Rejected or queued for approval, nothing was signed.
+	if got := autoSequenceRequest(t, wallet, ""); got != 5 {
+		t.Fatalf("sequence %d, want 5", got)
+	}
+	if got := autoSequenceRequest(t, wallet, SigningOutcomeBroadcast); got != 5 {
+		t.Errorf("sequence %d after a request without signing, want 5", got)
+	}
+	if got := autoSequenceRequest(t, wallet, SigningOutcomeSigned); got != 6 {
+		t.Errorf("sequence %d, want 6", got)
+	}
+}
+
+func TestAutoSequenceReleasedOnBroadcastFailure(t *testing.T) {
+	wallet := &Wallet{Name: "seq", Seed: testMnemonic}
+	resetSequences(wallet.Name)
+	autoSequenceRequest(t, wallet, SigningOutcomeBroadcastFailed)
+	if got := autoSequenceRequest(t, wallet, SigningOutcomeSigned); got != 5 {
+		t.Errorf("sequence %d after a failed broadcast, want 5", got)
+	}
+}
+
+func TestAutoSequenceReservationExpires(t *testing.T) {
+	wallet := &Wallet{Name: "seq", Seed: testMnemonic}
+	resetSequences(wallet.Name)
+	autoSequenceRequest(t, wallet, SigningOutcomeSigned)
+	autoSequenceRequest(t, wallet, SigningOutcomeSigned)
+
+	// Signed but never broadcast, so the node is still at 5.
+	reserveMutex.Lock()
+	reservedSequences[sequenceCacheKey(testSequenceHost, wallet.Name)].expires = time.Now().Add(-time.Second)
+	reserveMutex.Unlock()
+	if got := autoSequenceRequest(t, wallet, SigningOutcomeSigned); got != 5 {
+		t.Errorf("sequence %d after the reservations expired, want 5", got)
+	}
+}
+
+func TestDeleteReservedSequences(t *testing.T) {
+	wallet := &Wallet{Name: "seq", Seed: testMnemonic}
+	resetSequences(wallet.Name)
+	autoSequenceRequest(t, wallet, SigningOutcomeSigned)
+	autoSequenceRequest(t, wallet, SigningOutcomeSigned)
+
+	deleteReservedSequences(wallet.Name)
+	// A new wallet with the name starts from the node.
+	if got := autoSequenceRequest(t, wallet, SigningOutcomeSigned); got != 5 {
+		t.Errorf("sequence %d after deleting the reservations, want 5", got)
+	}
+}
@@ -1,35 +1,58 @@
 package main
 
 import (
-	"github.com/binance-chain/go-sdk/keys"
+	"encoding/hex"
+	"errors"
 	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/keys"
 	types_old "github.com/binance-chain/go-sdk/types"
 	"github.com/binance-chain/go-sdk/types/msg"
 	"github.com/binance-chain/go-sdk/types/tx"
+	"net/http"
 	"time"
 )
 
+// Binance Chain transactions have no timeout height, a transaction
+// stays valid until its sequence is used.
+var errTimeoutHeightUnsupported = &RequestError{
+	HTTPStatusCode: http.StatusNotImplemented,
+	StatusText:     "Not supported.",
+	AppCode:        ErrorCodeNotSupported,
+	Err:            errors.New("Binance Chain transactions have no timeout height. Sign with the next sequence and broadcast another transaction with it to invalidate a pending one."),
+}
+
 func signMessage(sm SignedMessage, memo string, m msg.Msg, keyManager keys.KeyManager) ([]byte, error) {
+	if sm.TimeoutHeight != 0 {
+		return nil, errTimeoutHeightUnsupported
+	}
 	err := m.ValidateBasic()
 	if err != nil {
 		return nil, err
 	}
+	err = validateMemo(memo)
+	if err != nil {
+		return nil, err
+	}
 
 	signMsg := tx.StdSignMsg{
 		ChainID:       sm.ChainId,
 		AccountNumber: sm.AccountNumber,
 		Sequence:      sm.Sequence,
-		Memo:          memo, // Only transfer supports memo
+		Memo:          memo,
 		Msgs:          []msg.Msg{m},
 		Source:        types_old.GoSdkSource,
 	}
 
-	hexTx, err := keyManager.Sign(signMsg)
+	signed, err := keyManager.Sign(signMsg)
 	if err != nil {
 		return nil, err
 	}
-
-	return hexTx, nil
+	// Key managers of the SDK return the amino encoded transaction,
+	// which is never valid hex. Older versions hex-encoded it already.
+	if _, err := hex.DecodeString(string(signed)); err != nil {
+		return []byte(hex.EncodeToString(signed)), nil
+	}
+	return signed, nil
 }
 
 func createSignedCreateOrderMessage(keyManager keys.KeyManager, co *CreateOrder) ([]byte, error) {
@@ -44,7 +67,7 @@ func createSignedCreateOrderMessage(keyManager keys.KeyManager, co *CreateOrder)
 		co.Quantity,
 	)
 
-	hexTx, err := signMessage(co.SignedMessage, "", newOrderMessage, keyManager)
+	hexTx, err := signMessage(co.SignedMessage, co.Memo, newOrderMessage, keyManager)
 	return hexTx, err
 }
 
@@ -58,7 +81,7 @@ func createSignedCancelOrderMsg(keyManager keys.KeyManager, co *CancelOrder) ([]
 		co.CombinedSymbol(),
 		co.RefId,
 	)
-	hexTx, err := signMessage(co.SignedMessage, "", cancelOrderMessage, keyManager)
+	hexTx, err := signMessage(co.SignedMessage, co.Memo, cancelOrderMessage, keyManager)
 	return hexTx, err
 }
 
@@ -67,13 +90,13 @@ func createSignedTokenBurnMsg(keyManager keys.KeyManager, tb *TokenBurn) ([]byte
 		keyManager.GetAddr(),
 		tb.Symbol,
 		tb.Amount)
-	hexTx, err := signMessage(tb.SignedMessage, "", burnMsg, keyManager)
+	hexTx, err := signMessage(tb.SignedMessage, tb.Memo, burnMsg, keyManager)
 	return hexTx, err
 }
 func createSignedDepositMsg(keyManager keys.KeyManager, dp *DepositProposal) ([]byte, error) {
 	coins := types.Coins{types.Coin{Denom: types_old.NativeSymbol, Amount: dp.Amount}}
 	depositMsg := msg.NewDepositMsg(keyManager.GetAddr(), dp.ProposalID, coins)
-	hexTx, err := signMessage(dp.SignedMessage, "", depositMsg, keyManager)
+	hexTx, err := signMessage(dp.SignedMessage, dp.Memo, depositMsg, keyManager)
 	return hexTx, err
 }
 
@@ -83,11 +106,22 @@ func createSignedFreezeTokenMsg(keyManager keys.KeyManager, ft *FreezeToken) ([]
 		ft.Symbol,
 		ft.Amount,
 	)
-	hexTx, err := signMessage(ft.SignedMessage, "", freezeMsg, keyManager)
+	hexTx, err := signMessage(ft.SignedMessage, ft.Memo, freezeMsg, keyManager)
 	return hexTx, err
 }
 
 func createSignedIssueTokenMsg(keyManager keys.KeyManager, it *IssueToken) ([]byte, error) {
+	if it.MiniToken {
+		return createSignedIssueMiniTokenMsg(keyManager, &IssueMiniToken{
+			SignedMessage: it.SignedMessage,
+			Name:          it.Name,
+			Symbol:        it.Symbol,
+			Supply:        it.Supply,
+			Mintable:      it.Mintable,
+			TokenURI:      it.TokenURI,
+		})
+	}
+
 	issueMsg := msg.NewTokenIssueMsg(
 		keyManager.GetAddr(),
 		it.Name,
@@ -95,13 +129,32 @@ func createSignedIssueTokenMsg(keyManager keys.KeyManager, it *IssueToken) ([]by
 		it.Supply,
 		it.Mintable)
 
-	hexTx, err := signMessage(it.SignedMessage, "", issueMsg, keyManager)
+	hexTx, err := signMessage(it.SignedMessage, it.Memo, issueMsg, keyManager)
+	return hexTx, err
+}
+
+func createSignedIssueMiniTokenMsg(keyManager keys.KeyManager, it *IssueMiniToken) ([]byte, error) {
+	issueMsg := msg.NewMiniTokenIssueMsg(
+		keyManager.GetAddr(),
+		it.Name,
+		it.Symbol,
+		it.Supply,
+		it.Mintable,
+		it.TokenURI)
+
+	hexTx, err := signMessage(it.SignedMessage, it.Memo, issueMsg, keyManager)
+	return hexTx, err
+}
+
+func createSignedSetTokenURIMsg(keyManager keys.KeyManager, su *SetTokenURI) ([]byte, error) {
+	msg := msg.NewSetUriMsg(keyManager.GetAddr(), su.Symbol, su.TokenURI)
+	hexTx, err := signMessage(su.SignedMessage, su.Memo, msg, keyManager)
 	return hexTx, err
 }
 
 func createSignedListPairMsg(keyManager keys.KeyManager, lp *ListPair) ([]byte, error) {
 	msg := msg.NewDexListMsg(keyManager.GetAddr(), lp.ProposalID, lp.BaseAssetSymbol, lp.QuoteAssetSymbol, lp.InitPrice)
-	hexTx, err := signMessage(lp.SignedMessage, "", msg, keyManager)
+	hexTx, err := signMessage(lp.SignedMessage, lp.Memo, msg, keyManager)
 	return hexTx, err
 }
 
@@ -110,7 +163,7 @@ func createSignedMintTokenMsg(keyManager keys.KeyManager, mt *MintToken) ([]byte
 		keyManager.GetAddr(),
 		mt.Symbol,
 		mt.Amount)
-	hexTx, err := signMessage(mt.SignedMessage, "", msg, keyManager)
+	hexTx, err := signMessage(mt.SignedMessage, mt.Memo, msg, keyManager)
 	return hexTx, err
 }
 
@@ -123,14 +176,14 @@ func createSignedSendTokenMsg(keyManager keys.KeyManager, st *SendToken) ([]byte
 		keyManager.GetAddr(),
 		fromCoins,
 		st.Transfers)
-	hexTx, err := signMessage(st.SignedMessage, "", sendMsg, keyManager)
+	hexTx, err := signMessage(st.SignedMessage, memoText(st.Memo), sendMsg, keyManager)
 	return hexTx, err
 }
 
 func createSignedSubmitProposalMsg(keyManager keys.KeyManager, sp *SubmitProposal) ([]byte, error) {
 	coins := types.Coins{types.Coin{Denom: types_old.NativeSymbol, Amount: sp.InitialDeposit}}
 	proposalMsg := msg.NewMsgSubmitProposal(sp.Title, sp.Description, msg.ProposalKind(sp.ProposalType), keyManager.GetAddr(), coins, time.Duration(sp.VotingPeriod))
-	hexTx, err := signMessage(sp.SignedMessage, "", proposalMsg, keyManager)
+	hexTx, err := signMessage(sp.SignedMessage, sp.Memo, proposalMsg, keyManager)
 	return hexTx, err
 }
 
@@ -139,12 +192,12 @@ func createUnfreezeTokenMsg(keyManager keys.KeyManager, ut *UnfreezeToken) ([]by
 		keyManager.GetAddr(),
 		ut.Symbol,
 		ut.Amount)
-	hexTx, err := signMessage(ut.SignedMessage, "", unfreezeMsg, keyManager)
+	hexTx, err := signMessage(ut.SignedMessage, ut.Memo, unfreezeMsg, keyManager)
 	return hexTx, err
 }
 
 func createSignedVoteProposalMsg(keyManager keys.KeyManager, vp *VoteProposal) ([]byte, error) {
 	voteMsg := msg.NewMsgVote(keyManager.GetAddr(), vp.ProposalID, msg.VoteOption(vp.Option))
-	hexTx, err := signMessage(vp.SignedMessage, "", voteMsg, keyManager)
+	hexTx, err := signMessage(vp.SignedMessage, vp.Memo, voteMsg, keyManager)
 	return hexTx, err
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"net/http"
+	"time"
+)
+
+const TimingsCtxKey = "timingsctxkey"
+
+// Time spent in each phase of a signing request, in milliseconds.
+// Only collected with ?timing=true, as timings can reveal details
+// about the key backend.
+type SigningTimings struct {
+	Decode     float64
+	KeyManager float64
+	Sign       float64
+	Broadcast  float64 `json:",omitempty"`
+	Total      float64
+
+	start time.Time
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Returns the timings of the request, nil unless they were requested.
+func GetRequestTimings(r *http.Request) *SigningTimings {
+	t, _ := r.Context().Value(TimingsCtxKey).(*SigningTimings)
+	return t
+}
+
+// Finishes and returns the timings of the request.
+func finishTimings(r *http.Request) *SigningTimings {
+	t := GetRequestTimings(r)
+	if t != nil {
+		t.Total = milliseconds(time.Since(t.start))
+	}
+	return t
+}
+
+// Attaches timings to requests with ?timing=true.
+func SigningTimer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("timing") == "true" {
+			ctx := context.WithValue(r.Context(), TimingsCtxKey, &SigningTimings{start: time.Now()})
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Key manager that records the time spent signing.
+type timedKeyManager struct {
+	keys.KeyManager
+	timings *SigningTimings
+}
+
+func (km *timedKeyManager) Sign(msg tx.StdSignMsg) ([]byte, error) {
+	start := time.Now()
+	defer func() { km.timings.Sign += milliseconds(time.Since(start)) }()
+	return km.KeyManager.Sign(msg)
+}
+
+// Wraps the key manager if timings are collected.
+func timedKeys(r *http.Request, km keys.KeyManager) keys.KeyManager {
+	if t := GetRequestTimings(r); t != nil {
+		return &timedKeyManager{KeyManager: km, timings: t}
+	}
+	return km
+}
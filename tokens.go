@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/go-chi/render"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Mini-tokens (BEP-69) have a smaller supply and an M suffix,
+// e.g. XYZ-000M.
+const MiniTokenMinSupply int64 = 1e8
+const MiniTokenMaxSupply int64 = 1000000 * 1e8
+const MiniTokenMaxNameLength = 32
+const MiniTokenMaxURILength = 2048
+
+// Symbols passed when issuing a mini-token, the chain adds the suffix
+var miniTokenIssueSymbolRegexp = regexp.MustCompile(`^[A-Z0-9]{3,8}$`)
+
+// Symbols of issued mini-tokens
+var miniTokenSymbolRegexp = regexp.MustCompile(`^[A-Z0-9]{3,8}-[0-9A-F]{3}M$`)
+
+// Number of tokens fetched per page when looking up a token
+const tokenPageSize = 1000
+
+type TokenInfoMessage struct {
+	QueryMessage
+	Symbol string
+}
+
+// Page size of issued token queries
+const DefaultIssuedTokensLimit = 100
+const MaxIssuedTokensLimit = 1000
+
+// The token list of a host is refreshed at most once a minute
+var tokenListCache = newTTLCache(time.Minute)
+
+type IssuedTokensMessage struct {
+	QueryMessage
+	Owner  string
+	Offset int
+	Limit  int
+}
+
+type IssuedTokensResponse struct {
+	Owner string
+	// Number of tokens issued by the owner, across all pages
+	Total  int
+	Tokens []TokenInfo
+}
+
+type SetTokenURIResponse struct {
+	Symbol   string
+	TokenURI string
+	Tx       string
+	// Only set if the transaction was broadcast
+	Broadcast *BroadcastResponse `json:",omitempty"`
+}
+
+type TokenInfo struct {
+	Symbol         string
+	OriginalSymbol string
+	Name           string
+	Owner          string
+	TotalSupply    int64
+	Mintable       bool
+	MiniToken      bool
+	TokenURI       string `json:",omitempty"`
+}
+
+func isMiniTokenSymbol(symbol string) bool {
+	return miniTokenSymbolRegexp.MatchString(symbol)
+}
+
+// Checks a mini-token issuance against the rules of the chain, which
+// would otherwise reject it after charging the fee.
+func validateMiniTokenIssue(name string, symbol string, supply int64, tokenURI string) error {
+	if name == "" || len(name) > MiniTokenMaxNameLength {
+		return fmt.Errorf("Mini-token name must be 1 to %d characters.", MiniTokenMaxNameLength)
+	}
+	if !miniTokenIssueSymbolRegexp.MatchString(symbol) {
+		return errors.New("Mini-token symbol must be 3 to 8 alphanumeric characters without suffix.")
+	}
+	if supply < MiniTokenMinSupply || supply > MiniTokenMaxSupply {
+		return fmt.Errorf("Mini-token supply must be between %d and %d.", MiniTokenMinSupply, MiniTokenMaxSupply)
+	}
+	return validateTokenURI(tokenURI)
+}
+
+// Token URIs are optional and must be http(s) or ipfs URLs.
+func validateTokenURI(tokenURI string) error {
+	if tokenURI == "" {
+		return nil
+	}
+	if len(tokenURI) > MiniTokenMaxURILength {
+		return fmt.Errorf("Token URI must be at most %d characters.", MiniTokenMaxURILength)
+	}
+	u, err := url.Parse(tokenURI)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ipfs") {
+		return errors.New("Token URI must be an http, https or ipfs URL.")
+	}
+	return nil
+}
+
+func tokenInfo(t types.Token) TokenInfo {
+	return TokenInfo{
+		Symbol:         t.Symbol,
+		OriginalSymbol: t.OrigSymbol,
+		Name:           t.Name,
+		Owner:          t.Owner.String(),
+		TotalSupply:    t.TotalSupply.ToInt64(),
+		Mintable:       t.Mintable,
+	}
+}
+
+func miniTokenInfo(t types.MiniToken) TokenInfo {
+	return TokenInfo{
+		Symbol:         t.Symbol,
+		OriginalSymbol: t.OrigSymbol,
+		Name:           t.Name,
+		Owner:          t.Owner.String(),
+		TotalSupply:    t.TotalSupply.ToInt64(),
+		Mintable:       t.Mintable,
+		MiniToken:      true,
+		TokenURI:       t.TokenURI,
+	}
+}
+
+// Looks the symbol up among mini-tokens or regular tokens, depending
+// on its format.
+func getTokenInfo(client sdk.DexClient, symbol string) (*TokenInfo, error) {
+	var offset uint32 = 0
+	for {
+		if isMiniTokenSymbol(symbol) {
+			// Mini-tokens are paged with the same query as tokens.
+			tokens, err := client.GetMiniTokens(types.NewTokensQuery().WithOffset(offset).WithLimit(tokenPageSize))
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range tokens {
+				if t.Symbol == symbol {
+					info := miniTokenInfo(t)
+					return &info, nil
+				}
+			}
+			if len(tokens) < tokenPageSize {
+				break
+			}
+		} else {
+			tokens, err := client.GetTokens(types.NewTokensQuery().WithOffset(offset).WithLimit(tokenPageSize))
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range tokens {
+				if t.Symbol == symbol {
+					info := tokenInfo(t)
+					return &info, nil
+				}
+			}
+			if len(tokens) < tokenPageSize {
+				break
+			}
+		}
+		offset += tokenPageSize
+	}
+	return nil, errors.New("Unknown token: " + symbol)
+}
+
+// Returns all regular and mini-tokens of the chain, cached per host
+// as listing them takes a request per page.
+func listTokens(client sdk.DexClient, host string) ([]TokenInfo, error) {
+	if cached, ok := tokenListCache.Get(host); ok {
+		return cached.([]TokenInfo), nil
+	}
+	all := []TokenInfo{}
+	for offset := uint32(0); ; offset += tokenPageSize {
+		tokens, err := client.GetTokens(types.NewTokensQuery().WithOffset(offset).WithLimit(tokenPageSize))
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tokens {
+			all = append(all, tokenInfo(t))
+		}
+		if len(tokens) < tokenPageSize {
+			break
+		}
+	}
+	for offset := uint32(0); ; offset += tokenPageSize {
+		tokens, err := client.GetMiniTokens(types.NewTokensQuery().WithOffset(offset).WithLimit(tokenPageSize))
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tokens {
+			all = append(all, miniTokenInfo(t))
+		}
+		if len(tokens) < tokenPageSize {
+			break
+		}
+	}
+	tokenListCache.Set(host, all)
+	return all, nil
+}
+
+// Lists the tokens issued by an address. Nodes can not filter tokens
+// by owner, so all tokens are listed and filtered.
+func getIssuedTokensHandler(w http.ResponseWriter, r *http.Request) {
+	data := &IssuedTokensMessage{}
+	if !decodeReadRequest(w, r, data) {
+		return
+	}
+	validation := validateAddress(data.Owner)
+	if !validation.Valid {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Invalid owner address: "+validation.Error)))
+		return
+	}
+	if data.Offset < 0 {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Offset must not be negative.")))
+		return
+	}
+	if data.Limit == 0 {
+		data.Limit = DefaultIssuedTokensLimit
+	}
+	if data.Limit < 0 || data.Limit > MaxIssuedTokensLimit {
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("Limit must be between 1 and %d.", MaxIssuedTokensLimit)))
+		return
+	}
+
+	hosts, network, err := queryHostsForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	var tokens []TokenInfo
+	err = queryWithFailover(w, hosts, func(host string) error {
+		client, err := newQueryClient(host, network)
+		if err != nil {
+			return err
+		}
+		tokens, err = listTokens(client, host)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	// Compare the address bytes, the prefix of the owners depends on
+	// the network of the SDK.
+	_, owner, _ := bech32.DecodeAndConvert(data.Owner)
+	issued := []TokenInfo{}
+	for _, t := range tokens {
+		_, tokenOwner, err := bech32.DecodeAndConvert(t.Owner)
+		if err == nil && bytes.Equal(tokenOwner, owner) {
+			issued = append(issued, t)
+		}
+	}
+	response := IssuedTokensResponse{Owner: data.Owner, Total: len(issued), Tokens: []TokenInfo{}}
+	if data.Offset < len(issued) {
+		end := data.Offset + data.Limit
+		if end > len(issued) {
+			end = len(issued)
+		}
+		response.Tokens = issued[data.Offset:end]
+	}
+	WriteTypedResponse(w, r, ResponseTypeIssuedTokens, response)
+}
+
+func getTokenInfoHandler(w http.ResponseWriter, r *http.Request) {
+	data := &TokenInfoMessage{}
+	if !decodeReadRequest(w, r, data) {
+		return
+	}
+	if !tokenSymbolRegexp.MatchString(data.Symbol) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Invalid symbol: "+data.Symbol)))
+		return
+	}
+
+	hosts, network, err := queryHostsForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	var info *TokenInfo
+	err = queryWithFailover(w, hosts, func(host string) error {
+		client, err := newQueryClient(host, network)
+		if err != nil {
+			return err
+		}
+		info, err = getTokenInfo(client, data.Symbol)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	WriteTypedResponse(w, r, ResponseTypeTokenInfo, *info)
+}
+
+// Updates the URI of a mini-token. If a broadcast host is supplied,
+// the token must have been issued by the wallet.
+func setTokenURIHandler(w http.ResponseWriter, r *http.Request) {
+	data := &SetTokenURI{}
+	datastore, _, keyManager, err := decodeRequest(r, data, PermissionSetTokenURI)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if !isMiniTokenSymbol(data.Symbol) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Token URIs can only be set on mini-tokens.")))
+		return
+	}
+	if data.TokenURI == "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("No TokenURI supplied.")))
+		return
+	}
+	err = validateTokenURI(data.TokenURI)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	var options BroadcastOptions
+	if data.BroadcastHost != "" {
+		err = checkWalletNetwork(datastore, data.Wallet, data.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(codedError(ErrorCodeNetworkMismatch, err)))
+			return
+		}
+		options, err = resolveBroadcastOptions(GetRequestConfig(r), PermissionSetTokenURI, &data.SignedMessage)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if options.Mode == BroadcastModeQueued {
+			options.Mode = BroadcastModeSync
+		}
+
+		client, err := newQueryClient(data.BroadcastHost, data.BroadcastNetwork)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		info, err := getTokenInfo(client, data.Symbol)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		if info.Owner != keyManager.GetAddr().String() {
+			render.Render(w, r, ErrInvalidRequest(errors.New("Token "+data.Symbol+" was not issued by this wallet.")))
+			return
+		}
+	}
+	if requireApproval(w, r, PermissionSetTokenURI) {
+		return
+	}
+
+	hexTx, err := createSignedSetTokenURIMsg(keyManager, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	auditLog(r, "Signed "+string(PermissionSetTokenURI)+" with wallet "+data.Wallet)
+	err = recordSigning(r, data.Wallet, PermissionSetTokenURI, hexTx)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	response := SetTokenURIResponse{
+		Symbol:   data.Symbol,
+		TokenURI: data.TokenURI,
+		Tx:       string(hexTx),
+	}
+	if data.BroadcastHost != "" {
+		response.Broadcast, err = broadcastMessage(data.BroadcastHost, data.BroadcastNetwork, hexTx, options)
+		signingEvent(r, data.Wallet, PermissionSetTokenURI, hexTx, data.BroadcastHost, broadcastOutcome(err), err)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(broadcastError(err)))
+			return
+		}
+		auditBroadcast(r, data.BroadcastHost, response.Broadcast)
+	} else {
+		signingEvent(r, data.Wallet, PermissionSetTokenURI, hexTx, "", SigningOutcomeSigned, nil)
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeTokenURI, response)
+}
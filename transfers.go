@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	sdk "github.com/binance-chain/go-sdk/client"
+	"github.com/binance-chain/go-sdk/types/msg"
+)
+
+// Account flag of accounts that only accept transfers with a memo
+const AccountFlagMemoRequired uint64 = 0x1
+
+// Deployment policy requiring approvals by other users for large
+// transfers, in addition to approval_thresholds.
+type TransferApprovalPolicy struct {
+	Approvals int `yaml:"approvals"`
+	// Amount per symbol, in the smallest unit (1e-8), from which on a
+	// transfer needs approval
+	Thresholds map[string]int64 `yaml:"thresholds"`
+}
+
+func (p *TransferApprovalPolicy) Validate() error {
+	if len(p.Thresholds) > 0 && p.Approvals <= 0 {
+		return errors.New("approvals must be positive.")
+	}
+	for symbol, threshold := range p.Thresholds {
+		if threshold <= 0 {
+			return errors.New("Threshold of " + symbol + " must be positive.")
+		}
+	}
+	return nil
+}
+
+// Returns the approvals required for the transfers. The amounts of
+// all recipients are added up, so splitting a transfer does not
+// avoid the approval.
+func (p *TransferApprovalPolicy) Required(transfers []msg.Transfer) int {
+	totals := map[string]int64{}
+	for _, t := range transfers {
+		for _, c := range t.Coins {
+			totals[c.Denom] += c.Amount
+		}
+	}
+	for symbol, total := range totals {
+		if threshold, ok := p.Thresholds[symbol]; ok && total >= threshold {
+			return p.Approvals
+		}
+	}
+	return 0
+}
+
+// Approvals required for sending the tokens, the stricter of the
+// action threshold and the transfer policy.
+func transferApprovals(cfg *DexVaultConfiguration, action Permission, transfers []msg.Transfer) int {
+	required := cfg.ApprovalThresholds[action]
+	if r := cfg.TransferApproval.Required(transfers); r > required {
+		required = r
+	}
+	return required
+}
+
+// The chain rejects transactions with longer memos
+const MaxMemoLength = 128
+
+func validateMemo(memo string) error {
+	if len(memo) > MaxMemoLength {
+		return fmt.Errorf("Memo must be at most %d bytes.", MaxMemoLength)
+	}
+	return nil
+}
+
+// Sets the memo of a transfer to the default memo of the wallet,
+// unless the request has a memo. An empty memo in the request
+// overrides the default.
+func applyDefaultMemo(datastore *DexVaultDatastore, st *SendToken) error {
+	if st.Memo == nil {
+		if w := datastore.GetWallet(st.Wallet); w != nil && w.DefaultMemo != "" {
+			memo := w.DefaultMemo
+			st.Memo = &memo
+		}
+	}
+	if st.Memo != nil {
+		return validateMemo(*st.Memo)
+	}
+	return nil
+}
+
+// Sets the default memo of a wallet, an empty memo removes it.
+func (b *DexVaultDatastore) SetDefaultMemo(wallet string, memo string) error {
+	err := validateMemo(memo)
+	if err != nil {
+		return err
+	}
+	walletsMutex.Lock()
+	for i := range b.Wallets {
+		if b.Wallets[i].Name == wallet {
+			b.Wallets[i].DefaultMemo = memo
+		}
+	}
+	walletsMutex.Unlock()
+	return b.persist()
+}
+
+func getAccountFlags(client sdk.DexClient, address string) (uint64, error) {
+	account, err := client.GetAccount(address)
+	if err != nil {
+		return 0, err
+	}
+	return account.Flags, nil
+}
+
+// Dereferences an optional memo.
+func memoText(memo *string) string {
+	if memo == nil {
+		return ""
+	}
+	return *memo
+}
+
+// Rejects transfers without a memo to recipients that require one, as
+// the chain would reject them after charging the fee.
+func checkMemoRequired(client sdk.DexClient, memo string, transfers []msg.Transfer) error {
+	if memo != "" {
+		return nil
+	}
+	for _, t := range transfers {
+		address := t.ToAddr.String()
+		flags, err := getAccountFlags(client, address)
+		if err != nil {
+			// Accounts that never received funds have no flags set.
+			fmt.Println("Failed to get account flags of " + address + ": " + err.Error())
+			continue
+		}
+		if flags&AccountFlagMemoRequired != 0 {
+			return errors.New("Recipient " + address + " requires a memo.")
+		}
+	}
+	return nil
+}
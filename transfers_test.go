@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMemoRoundTrips(t *testing.T) {
+	cfg, datastore := limitsTest(t, 10000)
+	memo := "deposit 12345"
+	send := sendTokenPayload(500, "")
+	send.Memo = &memo
+	r := testRequest("POST", "/v1/token/send", "alice", send, datastore, cfg)
+	w := serveSigning(sendTokenHandler, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	stdTx, err := decodeStdTx(signedTx(t, w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdTx.Memo != memo {
+		t.Errorf("transfer memo %q, want %q", stdTx.Memo, memo)
+	}
+
+	order := &CreateOrder{BaseAssetSymbol: "XYZ-000", QuoteAssetSymbol: "BNB", Op: 1, Price: 100000000, Quantity: 100000000}
+	order.Wallet = "hot"
+	order.ChainId = "Binance-Chain-Test"
+	order.Sequence = 1
+	order.Memo = "order tag"
+	r = testRequest("POST", "/v1/order/create", "alice", order, datastore, cfg)
+	w = serveSigning(createOrderHandler, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	summary, err := decodeSignedTx(signedTx(t, w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Memo != "order tag" {
+		t.Errorf("order memo %q, want %q", summary.Memo, "order tag")
+	}
+}
+
+func TestLongMemoRejected(t *testing.T) {
+	cfg, datastore := limitsTest(t, 10000)
+	memo := strings.Repeat("m", MaxMemoLength+1)
+	send := sendTokenPayload(500, "")
+	send.Memo = &memo
+	r := testRequest("POST", "/v1/token/send", "alice", send, datastore, cfg)
+	w := serveSigning(sendTokenHandler, r)
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != ErrorCodeInvalidPayload {
+		t.Errorf("status %d for a %d byte memo, want 400: %s", w.Code, len(memo), w.Body.String())
+	}
+	if spent(datastore) != 0 {
+		t.Errorf("spent %d on a rejected transfer", spent(datastore))
+	}
+
+	if validateMemo(strings.Repeat("m", MaxMemoLength)) != nil {
+		t.Errorf("%d byte memo rejected", MaxMemoLength)
+	}
+	// Counted in bytes, not characters.
+	if validateMemo(strings.Repeat("é", MaxMemoLength/2+1)) == nil {
+		t.Error("memo over the limit in bytes accepted")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"github.com/go-chi/render"
+	"net/http"
+	"strings"
+)
+
+// What a signature covers, allowing an external verifier to check
+// the signature without trusting this service.
+type SignAudit struct {
+	// Canonical JSON of the StdSignMsg that was signed
+	SignBytes string
+	// Hex encoded
+	Signature string
+	PubKey    string
+}
+
+// Decodes a hex encoded, signed transaction as returned by the
+// key manager.
+func decodeStdTx(hexTx []byte) (*tx.StdTx, error) {
+	bz, err := hex.DecodeString(string(hexTx))
+	if err != nil {
+		return nil, err
+	}
+	var stdTx tx.StdTx
+	err = tx.Cdc.UnmarshalBinaryLengthPrefixed(bz, &stdTx)
+	if err != nil {
+		return nil, err
+	}
+	return &stdTx, nil
+}
+
+// Reconstructs the sign-bytes of a signed transaction.
+func signAuditFromTx(chainId string, hexTx []byte) (*SignAudit, error) {
+	stdTx, err := decodeStdTx(hexTx)
+	if err != nil {
+		return nil, err
+	}
+	if len(stdTx.Signatures) != 1 {
+		return nil, errors.New("Expected exactly one signature.")
+	}
+	sig := stdTx.Signatures[0]
+
+	signMsg := tx.StdSignMsg{
+		ChainID:       chainId,
+		AccountNumber: sig.AccountNumber,
+		Sequence:      sig.Sequence,
+		Memo:          stdTx.Memo,
+		Msgs:          stdTx.Msgs,
+		Source:        stdTx.Source,
+		Data:          stdTx.Data,
+	}
+
+	return &SignAudit{
+		SignBytes: string(signMsg.Bytes()),
+		Signature: hex.EncodeToString(sig.Signature),
+		PubKey:    hex.EncodeToString(sig.PubKey.Bytes()),
+	}, nil
+}
+
+// Hashes the messages of a signed transaction, so transactions with
+// the same intent have the same fingerprint whatever their account
+// number, sequence, memo and signature. Order IDs are derived from
+// the sequence, so they are left out.
+func txFingerprint(hexTx []byte) (string, error) {
+	stdTx, err := decodeStdTx(hexTx)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, m := range stdTx.Msgs {
+		if order, ok := m.(msg.CreateOrderMsg); ok {
+			order.ID = ""
+			m = order
+		}
+		// The sign-bytes are canonical JSON, the type separates
+		// messages with the same fields.
+		h.Write([]byte(m.Type()))
+		h.Write([]byte{0})
+		h.Write(m.GetSignBytes())
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Human readable summary of a signed transaction
+type TxSummary struct {
+	Memo     string `json:",omitempty"`
+	Messages []MsgSummary
+}
+
+type TransferSummary struct {
+	To    string
+	Coins types.Coins
+}
+
+// Summary of a message, only the fields of its type are set
+type MsgSummary struct {
+	Type string
+	From string
+	// Recipients of transfers and HTLTs
+	Outputs  []TransferSummary `json:",omitempty"`
+	Symbol   string            `json:",omitempty"`
+	Side     string            `json:",omitempty"`
+	Price    int64             `json:",omitempty"`
+	Quantity int64             `json:",omitempty"`
+	// Amount of the symbol, or Coins for messages with several
+	Amount int64       `json:",omitempty"`
+	Coins  types.Coins `json:",omitempty"`
+	RefId  string      `json:",omitempty"`
+	SwapId string      `json:",omitempty"`
+}
+
+func summarizeMsg(m msg.Msg) MsgSummary {
+	s := MsgSummary{Type: m.Type()}
+	if signers := m.GetSigners(); len(signers) > 0 {
+		s.From = signers[0].String()
+	}
+	switch m := m.(type) {
+	case msg.SendMsg:
+		for _, o := range m.Outputs {
+			s.Outputs = append(s.Outputs, TransferSummary{To: o.Address.String(), Coins: o.Coins})
+		}
+	case msg.CreateOrderMsg:
+		s.Symbol, s.Price, s.Quantity = m.Symbol, m.Price, m.Quantity
+		s.Side = "buy"
+		if m.Side == msg.OrderSide.SELL {
+			s.Side = "sell"
+		}
+	case msg.CancelOrderMsg:
+		s.Symbol, s.RefId = m.Symbol, m.RefID
+	case msg.TokenBurnMsg:
+		s.Symbol, s.Amount = m.Symbol, m.Amount
+	case msg.TokenFreezeMsg:
+		s.Symbol, s.Amount = m.Symbol, m.Amount
+	case msg.TokenUnfreezeMsg:
+		s.Symbol, s.Amount = m.Symbol, m.Amount
+	case msg.MintMsg:
+		s.Symbol, s.Amount = m.Symbol, m.Amount
+	case msg.TokenIssueMsg:
+		s.Symbol, s.Amount = m.Symbol, m.TotalSupply
+	case msg.MiniTokenIssueMsg:
+		s.Symbol, s.Amount = m.Symbol, m.TotalSupply
+	case msg.SetURIMsg:
+		s.Symbol = m.Symbol
+	case msg.DepositMsg:
+		s.Coins = m.Amount
+	case msg.HTLTMsg:
+		s.Outputs = []TransferSummary{{To: m.To.String(), Coins: m.Amount}}
+	case msg.DepositHTLTMsg:
+		s.Coins, s.SwapId = m.Amount, hex.EncodeToString(m.SwapID)
+	case msg.ClaimHTLTMsg:
+		s.SwapId = hex.EncodeToString(m.SwapID)
+	case msg.RefundHTLTMsg:
+		s.SwapId = hex.EncodeToString(m.SwapID)
+	}
+	return s
+}
+
+// Summarizes a hex encoded, signed transaction, so clients can check
+// what was signed without decoding it themselves.
+func decodeSignedTx(hexTx []byte) (TxSummary, error) {
+	stdTx, err := decodeStdTx(hexTx)
+	if err != nil {
+		return TxSummary{}, err
+	}
+	summary := TxSummary{Memo: stdTx.Memo, Messages: []MsgSummary{}}
+	for _, m := range stdTx.Msgs {
+		summary.Messages = append(summary.Messages, summarizeMsg(m))
+	}
+	return summary, nil
+}
+
+type TxDecodeMessage struct {
+	// Hex encoded, signed transaction
+	Tx string
+}
+
+type TxDecodeResponse struct {
+	// Amino JSON of the transaction
+	Decoded json.RawMessage
+	// Hex of the decoded transaction encoded again
+	Reencoded string
+	// Whether Reencoded matches the input
+	RoundTrip bool
+	// Where the encodings differ, unless they match
+	Mismatch string `json:",omitempty"`
+}
+
+// Describes the first difference between two encodings.
+func encodingMismatch(input []byte, reencoded []byte) string {
+	if bytes.Equal(input, reencoded) {
+		return ""
+	}
+	for i := 0; i < len(input) && i < len(reencoded); i++ {
+		if input[i] != reencoded[i] {
+			return fmt.Sprintf("Encodings differ at byte %d: input has %02x, re-encoded has %02x.", i, input[i], reencoded[i])
+		}
+	}
+	return fmt.Sprintf("Input is %d bytes, re-encoded is %d bytes.", len(input), len(reencoded))
+}
+
+// Stateless, so only a valid token is required.
+func decodeTxHandler(w http.ResponseWriter, r *http.Request) {
+	data := &TxDecodeMessage{}
+	err := decodePayload(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	input, err := hex.DecodeString(strings.TrimPrefix(data.Tx, "0x"))
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	var stdTx tx.StdTx
+	err = tx.Cdc.UnmarshalBinaryLengthPrefixed(input, &stdTx)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	decoded, err := tx.Cdc.MarshalJSON(stdTx)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	reencoded, err := tx.Cdc.MarshalBinaryLengthPrefixed(stdTx)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	response := TxDecodeResponse{
+		Decoded:   decoded,
+		Reencoded: hex.EncodeToString(reencoded),
+		Mismatch:  encodingMismatch(input, reencoded),
+	}
+	response.RoundTrip = response.Mismatch == ""
+	WriteTypedResponse(w, r, ResponseTypeTxDecode, response)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/keys"
+	"github.com/binance-chain/go-sdk/types/msg"
+)
+
+func testSignedMessage() SignedMessage {
+	return SignedMessage{ChainId: "Binance-Chain-Test", AccountNumber: 1, Sequence: 1}
+}
+
+func TestDecodeSignedTx(t *testing.T) {
+	keyManager, err := keys.NewMnemonicKeyManager(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := keyManager.GetAddr().String()
+
+	send := &SendToken{SignedMessage: testSignedMessage(), Transfers: testTransfers(500)}
+	order := &CreateOrder{SignedMessage: testSignedMessage(), BaseAssetSymbol: "XYZ-000", QuoteAssetSymbol: "BNB", Op: msg.OrderSide.SELL, Price: 200, Quantity: 300}
+	cancel := &CancelOrder{SignedMessage: testSignedMessage(), BaseAssetSymbol: "XYZ-000", QuoteAssetSymbol: "BNB", RefId: "ref-1"}
+	burn := &TokenBurn{SignedMessage: testSignedMessage(), Symbol: "XYZ-000", Amount: 700}
+	freeze := &FreezeToken{SignedMessage: testSignedMessage(), Symbol: "XYZ-000", Amount: 800}
+
+	for _, test := range []struct {
+		sign func() ([]byte, error)
+		want MsgSummary
+	}{
+		{func() ([]byte, error) { return createSignedSendTokenMsg(keyManager, send) }, MsgSummary{Type: "send"}},
+		{func() ([]byte, error) { return createSignedCreateOrderMessage(keyManager, order) }, MsgSummary{Type: "orderNew", Symbol: "XYZ-000_BNB", Side: "sell", Price: 200, Quantity: 300}},
+		{func() ([]byte, error) { return createSignedCancelOrderMsg(keyManager, cancel) }, MsgSummary{Type: "orderCancel", Symbol: "XYZ-000_BNB", RefId: "ref-1"}},
+		{func() ([]byte, error) { return createSignedTokenBurnMsg(keyManager, burn) }, MsgSummary{Type: "tokensBurn", Symbol: "XYZ-000", Amount: 700}},
+		{func() ([]byte, error) { return createSignedFreezeTokenMsg(keyManager, freeze) }, MsgSummary{Type: "tokensFreeze", Symbol: "XYZ-000", Amount: 800}},
+	} {
+		hexTx, err := test.sign()
+		if err != nil {
+			t.Fatalf("%s: %v", test.want.Type, err)
+		}
+		summary, err := decodeSignedTx(hexTx)
+		if err != nil {
+			t.Fatalf("%s: %v", test.want.Type, err)
+		}
+		if len(summary.Messages) != 1 {
+			t.Fatalf("%s: %d messages, want 1", test.want.Type, len(summary.Messages))
+		}
+		s := summary.Messages[0]
+		if s.Type != test.want.Type || s.From != from || s.Symbol != test.want.Symbol || s.Side != test.want.Side ||
+			s.Price != test.want.Price || s.Quantity != test.want.Quantity || s.Amount != test.want.Amount || s.RefId != test.want.RefId {
+			t.Errorf("summary %+v, want %+v from %s", s, test.want, from)
+		}
+		if test.want.Type == "send" {
+			to := send.Transfers[0]
+			if len(s.Outputs) != 1 || s.Outputs[0].To != to.ToAddr.String() || !s.Outputs[0].Coins.IsEqual(to.Coins) {
+				t.Errorf("outputs %+v, want %v to %s", s.Outputs, to.Coins, to.ToAddr)
+			}
+		}
+	}
+
+	if _, err := decodeSignedTx([]byte("not hex")); err == nil {
+		t.Error("invalid transaction decoded")
+	}
+}
+
+func TestSignedResponseSummary(t *testing.T) {
+	cfg, datastore := limitsTest(t, 10000)
+	for query, want := range map[string]bool{"": false, "?decode=true": true} {
+		r := testRequest("POST", "/v1/token/send"+query, "alice", sendTokenPayload(500, ""), datastore, cfg)
+		w := serveSigning(sendTokenHandler, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		response := struct {
+			Data SignedTxResponse
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if got := response.Data.Summary != nil; got != want {
+			t.Errorf("%q: summary %t, want %t", query, got, want)
+			continue
+		}
+		if want && (len(response.Data.Summary.Messages) != 1 || response.Data.Summary.Messages[0].Type != "send") {
+			t.Errorf("summary %+v, want the transfer", response.Data.Summary)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var txHashRegexp = regexp.MustCompile(`^[0-9A-Fa-f]{64}$`)
+
+// Commit status of a transaction, the result of a broadcast plus the
+// code and log of the node.
+type TxStatusResponse struct {
+	BroadcastResult
+	Code int32
+	Log  string `json:",omitempty"`
+}
+
+var errTxNotFound = &RequestError{
+	HTTPStatusCode: http.StatusNotFound,
+	StatusText:     "Not found.",
+	AppCode:        ErrorCodeTxNotFound,
+	Err:            errors.New("No committed transaction with the hash could be found."),
+}
+
+// Looks up a transaction by hash, e.g. after an async broadcast.
+// Transactions that are not committed yet are not found.
+func getTxStatusHandler(w http.ResponseWriter, r *http.Request) {
+	data := &QueryMessage{}
+	if !decodeReadRequest(w, r, data) {
+		return
+	}
+	hash := chi.URLParam(r, "hash")
+	if !txHashRegexp.MatchString(hash) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("Invalid transaction hash: "+hash)))
+		return
+	}
+
+	hosts, network, err := queryHostsForRequest(r, data)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	var result *CommittedTx
+	err = queryWithFailover(w, hosts, func(host string) error {
+		client, err := newQueryClient(host, network)
+		if err != nil {
+			return err
+		}
+		result, err = getCommittedTx(client, strings.ToUpper(hash))
+		return err
+	})
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "not found") {
+			render.Render(w, r, ErrInvalidRequest(errTxNotFound))
+			return
+		}
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	WriteTypedResponse(w, r, ResponseTypeTxStatus, TxStatusResponse{
+		BroadcastResult: BroadcastResult{
+			Ok:     result.Code == 0,
+			Hash:   result.Hash,
+			Data:   result.Data,
+			Height: result.Height,
+		},
+		Code: result.Code,
+		Log:  result.Log,
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+// Page size of reward queries
+const DefaultRewardsLimit = 20
+const MaxRewardsLimit = 100
+
+type ValidatorRewardsMessage struct {
+	QueryMessage
+	ValoperAddress string
+	// Block range, ToHeight 0 is the latest block
+	FromHeight int64
+	ToHeight   int64
+	Offset     int
+	Limit      int
+}
+
+var errDistributionUnsupported = &RequestError{
+	HTTPStatusCode: http.StatusNotImplemented,
+	StatusText:     "Not supported.",
+	AppCode:        ErrorCodeNotSupported,
+	Err:            errors.New("Binance Chain nodes have no distribution module, commission and rewards can not be queried."),
+}
+
+func validateValoperAddress(address string) error {
+	hrp, data, err := bech32.DecodeAndConvert(address)
+	if err != nil {
+		return err
+	}
+	if hrp != HrpValoper || len(data) != AddressLength {
+		return errors.New("Not a validator operator address: " + address)
+	}
+	return nil
+}
+
+func (m *ValidatorRewardsMessage) Validate() error {
+	err := validateValoperAddress(m.ValoperAddress)
+	if err != nil {
+		return err
+	}
+	if m.FromHeight < 0 || m.ToHeight < 0 || (m.ToHeight != 0 && m.FromHeight > m.ToHeight) {
+		return errors.New("Invalid height range.")
+	}
+	if m.Offset < 0 {
+		return errors.New("Offset must not be negative.")
+	}
+	if m.Limit == 0 {
+		m.Limit = DefaultRewardsLimit
+	}
+	if m.Limit < 0 || m.Limit > MaxRewardsLimit {
+		return fmt.Errorf("Limit must be between 1 and %d.", MaxRewardsLimit)
+	}
+	return nil
+}
+
+// Validates the query, but Binance Chain nodes do not serve
+// commission and reward history, so it is always rejected with 501.
+func getValidatorRewardsHandler(w http.ResponseWriter, r *http.Request) {
+	data := &ValidatorRewardsMessage{}
+	if !decodeReadRequest(w, r, data) {
+		return
+	}
+	err := data.Validate()
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	_, _, err = queryHostForRequest(r, &data.QueryMessage)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	render.Render(w, r, ErrInvalidRequest(errDistributionUnsupported))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set when building, e.g.
+// go build -ldflags "-X main.Version=1.2.0 -X main.GitCommit=$(git rev-parse HEAD) -X main.BuildTime=$(date -u +%FT%TZ)"
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildTime = ""
+)
+
+const sdkModule = "github.com/binance-chain/go-sdk"
+
+type VersionResponse struct {
+	Version   string
+	GitCommit string `json:",omitempty"`
+	BuildTime string `json:",omitempty"`
+	GoVersion string
+	// Version of the Binance Chain SDK, which determines the supported
+	// transaction types
+	SdkVersion string
+}
+
+// Returns the version of the SDK module the binary was built with.
+func sdkVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == sdkModule {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// Describes the running build. No token is required.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	WriteJSONResponse(w, r, VersionResponse{
+		Version:    Version,
+		GitCommit:  GitCommit,
+		BuildTime:  BuildTime,
+		GoVersion:  runtime.Version(),
+		SdkVersion: sdkVersion(),
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type SigningOutcome string
+
+// Signed and returned to the client
+const SigningOutcomeSigned SigningOutcome = "signed"
+
+// Signed and accepted by the node
+const SigningOutcomeBroadcast SigningOutcome = "broadcast"
+
+// Signed, but the node rejected the broadcast
+const SigningOutcomeBroadcastFailed SigningOutcome = "broadcast_failed"
+
+// Signed and queued for broadcasting, see jobs.go
+const SigningOutcomeQueued SigningOutcome = "queued"
+
+const webhookTimeout = 10 * time.Second
+const webhookAttempts = 4
+
+// First retry delay, doubled for every further attempt
+const webhookRetryDelay = time.Second
+
+// Endpoint notified of every signing with a wallet. Requests carry an
+// HMAC-SHA256 of the body with the secret.
+type WalletWebhook struct {
+	URL    string
+	Secret string
+}
+
+type SigningEvent struct {
+	Wallet    string
+	Action    Permission
+	Timestamp time.Time
+	TxHash    string
+	Outcome   SigningOutcome
+}
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// Sets or, with nil, removes the webhook of a wallet.
+func (b *DexVaultDatastore) SetWebhook(wallet string, webhook *WalletWebhook) {
+	walletsMutex.Lock()
+	for i := range b.Wallets {
+		if b.Wallets[i].Name == wallet {
+			b.Wallets[i].Webhook = webhook
+		}
+	}
+	walletsMutex.Unlock()
+	b.persist()
+}
+
+// Rejects URLs whose host is not in webhook_allowlist, so webhooks can
+// not be used to reach internal services.
+func validateWebhookURL(cfg *DexVaultConfiguration, webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("Webhook URL must be an http or https URL.")
+	}
+	for _, host := range cfg.WebhookAllowlist {
+		if strings.EqualFold(host, u.Hostname()) {
+			return nil
+		}
+	}
+	return errors.New("Webhook host is not in webhook_allowlist: " + u.Hostname())
+}
+
+// Hash of a hex encoded transaction, as reported by the chain.
+func txHash(hexTx []byte) string {
+	bz, err := hex.DecodeString(string(hexTx))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(bz)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(webhook WalletWebhook, body []byte) error {
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-DexVault-Signature", "sha256="+webhookSignature(webhook.Secret, body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook returned status %d.", resp.StatusCode)
+	}
+	return nil
+}
+
+// Delivers the event in the background, retrying with backoff.
+func deliverWebhook(webhook WalletWebhook, event SigningEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println("Failed to encode webhook event: " + err.Error())
+		return
+	}
+	go func() {
+		delay := webhookRetryDelay
+		for attempt := 1; ; attempt++ {
+			err := postWebhook(webhook, body)
+			if err == nil {
+				return
+			}
+			if attempt == webhookAttempts {
+				fmt.Printf("Webhook of wallet %s failed after %d attempts: %s\n", event.Wallet, attempt, err.Error())
+				return
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}()
+}
+
+// Outcome of a broadcast that returned err.
+func broadcastOutcome(err error) SigningOutcome {
+	if err != nil {
+		return SigningOutcomeBroadcastFailed
+	}
+	return SigningOutcomeBroadcast
+}
+
+// Records a signing with the wallet: it is audited, its cached
+// sequences are dropped, what the request reserved is kept unless the
+// broadcast failed, and its webhook, if it has one, is notified.
+// host and err are those of the broadcast, if there was one.
+func signingEvent(r *http.Request, wallet string, action Permission, hexTx []byte, host string, outcome SigningOutcome, err error) {
+	auditSigning(r, wallet, action, hexTx, host, outcome, err)
+	invalidateSequence(wallet)
+	settleReservations(r, outcome)
+	w := GetRequestDatastore(r).GetWallet(wallet)
+	if w == nil || w.Webhook == nil {
+		return
+	}
+	webhook := *w.Webhook
+	err = validateWebhookURL(GetRequestConfig(r), webhook.URL)
+	if err != nil {
+		fmt.Println("Not notifying webhook of wallet " + wallet + ": " + err.Error())
+		return
+	}
+	deliverWebhook(webhook, SigningEvent{
+		Wallet:    wallet,
+		Action:    action,
+		Timestamp: time.Now().UTC(),
+		TxHash:    txHash(hexTx),
+		Outcome:   outcome,
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type WhoamiResponse struct {
+	User string
+	// Permissions of the user, PermissionAll expanded
+	Permissions []Permission
+	// Wallets the user may read or sign with
+	Wallets    []string
+	AllowedIPs []string `json:",omitempty"`
+}
+
+// Expands PermissionAll into every permission it grants, and adds
+// the strict permissions granted explicitly.
+func (u *DexVaultAuth) EffectivePermissions() []Permission {
+	permissions := []Permission{}
+	for _, p := range append(append([]Permission{}, AllPermissions...), StrictPermissions...) {
+		if u.HasPermission(p) {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+// Only a valid token is required, the response describes the
+// access of the token itself.
+func whoamiHandler(w http.ResponseWriter, r *http.Request) {
+	datastore := GetRequestDatastore(r)
+	user := GetRequestUser(r)
+	u := datastore.GetUser(user)
+	if u == nil {
+		render.Render(w, r, ErrPermissionDenied())
+		return
+	}
+
+	permissions := u.EffectivePermissions()
+	response := WhoamiResponse{
+		User:        u.Name,
+		Permissions: permissions,
+		Wallets:     []string{},
+		AllowedIPs:  u.AllowedIPs,
+	}
+	for _, wallet := range datastore.ListWallets() {
+		for _, p := range permissions {
+			if p == PermissionRead || isSigningPermission(p) {
+				response.Wallets = append(response.Wallets, wallet.Name)
+				break
+			}
+		}
+	}
+	WriteTypedResponse(w, r, ResponseTypeWhoami, response)
+}